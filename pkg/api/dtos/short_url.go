@@ -7,4 +7,6 @@ type ShortURL struct {
 
 type CreateShortURLCmd struct {
 	Path string `json:"path"`
+	// IdempotencyKey identifies the creation, if set, so that retrying it returns the same short URL.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
@@ -3,7 +3,6 @@ package api
 import (
 	"errors"
 	"fmt"
-	"path"
 	"strings"
 
 	"github.com/grafana/grafana/pkg/api/dtos"
@@ -16,15 +15,25 @@ import (
 func (hs *HTTPServer) createShortURL(c *models.ReqContext, cmd dtos.CreateShortURLCmd) Response {
 	hs.log.Debug("Received request to create short URL", "path", cmd.Path)
 
-	cmd.Path = strings.TrimSpace(cmd.Path)
-
-	if path.IsAbs(cmd.Path) {
-		hs.log.Error("Invalid short URL path", "path", cmd.Path)
-		return Error(400, "Path should be relative", nil)
-	}
-
-	shortURL, err := hs.ShortURLService.CreateShortURL(c.Req.Context(), c.SignedInUser, cmd.Path)
+	shortURL, err := hs.createOrGetShortURL(c, cmd)
 	if err != nil {
+		if errors.Is(err, models.ErrShortURLBadRequest) {
+			hs.log.Error("Invalid short URL path", "path", cmd.Path)
+			return Error(400, "Path should be relative", err)
+		}
+		if errors.Is(err, models.ErrShortURLRateLimited) {
+			return Error(429, "Too many short URLs created", err)
+		}
+		if errors.Is(err, models.ErrShortURLPathTooLong) {
+			hs.log.Error("Too long short URL path", "length", len(cmd.Path))
+			return Error(400, "Path is too long", err)
+		}
+		if errors.Is(err, models.ErrShortURLIdempotencyKeyTooLong) {
+			return Error(400, "Idempotency key is too long", err)
+		}
+		if errors.Is(err, models.ErrShortURLIdempotencyKeyReused) {
+			return Error(422, "Idempotency key was used for another path", err)
+		}
 		return Error(500, "Failed to create short URL", err)
 	}
 
@@ -39,6 +48,45 @@ func (hs *HTTPServer) createShortURL(c *models.ReqContext, cmd dtos.CreateShortU
 	return JSON(200, dto)
 }
 
+// createOrGetShortURL creates the short URL of an idempotent request,
+// otherwise it reuses the user's existing short URL for the path if there is one.
+func (hs *HTTPServer) createOrGetShortURL(c *models.ReqContext, cmd dtos.CreateShortURLCmd) (*models.ShortUrl, error) {
+	if cmd.IdempotencyKey == "" {
+		return hs.ShortURLService.GetOrCreateShortURL(c.Req.Context(), c.SignedInUser, cmd.Path)
+	}
+
+	createCmd := models.CreateShortUrlCommand{
+		OrgId:          c.OrgId,
+		UserId:         c.UserId,
+		Path:           cmd.Path,
+		IdempotencyKey: cmd.IdempotencyKey,
+	}
+	if err := hs.ShortURLService.CreateShortURLIdempotently(c.Req.Context(), &createCmd); err != nil {
+		return nil, err
+	}
+	return createCmd.Result, nil
+}
+
+// recordShortURLAccess records the client IP address and user agent of a visit of the short URL
+// if the access log is enabled. Failing to record it doesn't prevent the redirection.
+func (hs *HTTPServer) recordShortURLAccess(c *models.ReqContext, shortURL *models.ShortUrl) {
+	clientIP, err := util.ParseIPAddress(c.RemoteAddr())
+	if err != nil {
+		hs.log.Debug("Failed to parse client IP address", "clientAddr", c.RemoteAddr(), "err", err)
+		clientIP = ""
+	}
+
+	cmd := models.RecordShortUrlAccessCommand{
+		ShortUrl:  shortURL,
+		UserId:    c.UserId,
+		ClientIp:  clientIP,
+		UserAgent: c.Req.UserAgent(),
+	}
+	if err := hs.ShortURLService.RecordShortURLAccess(c.Req.Context(), &cmd); err != nil {
+		hs.log.Error("Failed to record short URL access", "error", err)
+	}
+}
+
 func (hs *HTTPServer) redirectFromShortURL(c *models.ReqContext) {
 	shortURLUID := c.Params(":uid")
 
@@ -52,6 +100,14 @@ func (hs *HTTPServer) redirectFromShortURL(c *models.ReqContext) {
 			hs.log.Debug("Not redirecting short URL since not found")
 			return
 		}
+		if errors.Is(err, models.ErrShortURLExpired) {
+			hs.log.Debug("Not redirecting short URL since expired")
+			return
+		}
+		if errors.Is(err, models.ErrShortURLInvalidUID) {
+			hs.log.Debug("Not redirecting short URL since its uid is invalid", "error", err)
+			return
+		}
 
 		hs.log.Error("Short URL redirection error", "err", err)
 		return
@@ -61,7 +117,14 @@ func (hs *HTTPServer) redirectFromShortURL(c *models.ReqContext) {
 	if err := hs.ShortURLService.UpdateLastSeenAt(c.Req.Context(), shortURL); err != nil {
 		hs.log.Error("Failed to update short URL last seen at", "error", err)
 	}
+	hs.recordShortURLAccess(c, shortURL)
+
+	redirectURL, err := shortURL.RedirectURL(hs.Cfg.AppSubURL)
+	if err != nil {
+		hs.log.Warn("Not redirecting short URL since its path doesn't stay within Grafana", "uid", shortURL.Uid, "path", shortURL.Path)
+		return
+	}
 
 	hs.log.Debug("Redirecting short URL", "path", shortURL.Path)
-	c.Redirect(setting.ToAbsUrl(shortURL.Path), 302)
+	c.Redirect(redirectURL, 302)
 }
@@ -2,11 +2,38 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// MaxShortUrlPathLength is the maximum length in bytes of short URL paths,
+// which is the size of the TEXT column storing them in MySQL.
+const MaxShortUrlPathLength = 65535
+
+// MaxShortUrlIdempotencyKeyLength is the maximum length of the idempotency keys of short URL creations.
+const MaxShortUrlIdempotencyKeyLength = 128
+
 var (
-	ErrShortURLNotFound = errors.New("short URL not found")
+	ErrShortURLNotFound    = errors.New("short URL not found")
+	ErrShortURLForbidden   = errors.New("short URL was created by another user")
+	ErrShortURLExpired     = errors.New("short URL expired")
+	ErrShortURLConflict    = errors.New("short URL uid already exists")
+	ErrShortURLBadRequest  = errors.New("short URL path should be relative to the Grafana root")
+	ErrShortURLRateLimited = errors.New("too many short URLs created, try again later")
+	ErrShortURLPathTooLong = fmt.Errorf("short URL path should be at most %d bytes long", MaxShortUrlPathLength)
+	ErrShortURLInvalidUID  = errors.New("short URL uid is invalid")
+
+	ErrShortURLInvalidRedirect = errors.New("short URL path doesn't redirect within Grafana")
+
+	// ErrShortURLUIDCaseConflict matches ErrShortURLConflict. Case-insensitive uids resolve
+	// regardless of the typed case but can't tell apart the uids differing only by case,
+	// which may have been created before they were made case-insensitive.
+	ErrShortURLUIDCaseConflict = fmt.Errorf("%w with another case, which case-insensitive uids can't tell apart", ErrShortURLConflict)
+
+	ErrShortURLIdempotencyKeyReused  = errors.New("short URL idempotency key was already used for another path")
+	ErrShortURLIdempotencyKeyTooLong = fmt.Errorf("short URL idempotency key should be at most %d characters long", MaxShortUrlIdempotencyKeyLength)
 )
 
 type ShortUrl struct {
@@ -17,10 +44,209 @@ type ShortUrl struct {
 	CreatedBy  int64
 	CreatedAt  int64
 	LastSeenAt int64
+	ExpiresAt  int64
+	HitCount   int64
+	DeletedAt  int64
+	UpdatedAt  int64
+}
+
+// RedirectURL returns the URL visiting the short URL redirects to: its path, relative to the Grafana
+// root, joined onto the app sub path, such as "/grafana" or "" if Grafana is served from the root.
+// It returns ErrShortURLInvalidRedirect if the URL would leave the Grafana origin or sub path,
+// e.g. for paths stored before they were validated, so that short URLs can't be open redirects.
+func (s *ShortUrl) RedirectURL(appSubURL string) (string, error) {
+	// Browsers treat backslashes as slashes, so that "/\\evil.com" is a protocol-relative URL.
+	if strings.HasPrefix(s.Path, "//") || strings.Contains(s.Path, "\\") {
+		return "", ErrShortURLInvalidRedirect
+	}
+	if p, err := url.Parse(s.Path); err != nil || p.Scheme != "" || p.Host != "" || p.Opaque != "" {
+		return "", ErrShortURLInvalidRedirect
+	}
+
+	appSubURL = strings.TrimSuffix(appSubURL, "/")
+	redirectURL := appSubURL + "/" + strings.TrimPrefix(s.Path, "/")
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" || !strings.HasPrefix(u.Path, appSubURL+"/") {
+		return "", ErrShortURLInvalidRedirect
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == ".." {
+			return "", ErrShortURLInvalidRedirect
+		}
+	}
+	return redirectURL, nil
+}
+
+// ShortUrlIdempotencyKey records the short URL created by a user with an idempotency key.
+type ShortUrlIdempotencyKey struct {
+	Id             int64
+	OrgId          int64
+	UserId         int64
+	IdempotencyKey string
+	ShortUrlId     int64
+	CreatedAt      int64
+}
+
+// ShortUrlAccess is a recorded visit of a short URL, for security auditing.
+type ShortUrlAccess struct {
+	Id         int64
+	ShortUrlId int64
+	OrgId      int64
+	UserId     int64
+	ClientIp   string
+	UserAgent  string
+	AccessedAt int64
+}
+
+type RecordShortUrlAccessCommand struct {
+	ShortUrl  *ShortUrl
+	UserId    int64
+	ClientIp  string
+	UserAgent string
+}
+
+type DeleteShortUrlAccessesCommand struct {
+	// OlderThan is the time before which recorded visits are deleted.
+	OlderThan time.Time
+
+	NumDeleted int64
+}
+
+type CreateShortUrlCommand struct {
+	OrgId  int64
+	UserId int64
+	Path   string
+	// IdempotencyKey identifies the creation, if set, so that retrying it returns the same short URL.
+	IdempotencyKey string
+
+	Result *ShortUrl
+}
+
+type CreateShortUrlsBatchCommand struct {
+	OrgId  int64
+	UserId int64
+	Paths  []string
+
+	Result []*ShortUrl
+}
+
+type UpdateShortUrlPathCommand struct {
+	OrgId  int64
+	UserId int64
+	Uid    string
+	Path   string
+
+	Result *ShortUrl
+}
+
+type TransferShortUrlOwnershipCommand struct {
+	OrgId int64
+	Uids  []string
+	// UserId is the user the short URLs are transferred to.
+	UserId int64
+	// NewOrgId is the org the short URLs are moved to, if set.
+	NewOrgId int64
+
+	NumTransferred int64
 }
 
 type DeleteShortUrlCommand struct {
+	// OlderThan is the creation time before which never visited short URLs are deleted.
 	OlderThan time.Time
+	// LastSeenOlderThan is the last visit time before which visited short URLs are deleted, if set.
+	LastSeenOlderThan time.Time
 
 	NumDeleted int64
 }
+
+type DeleteExpiredShortUrlIdempotencyKeysCommand struct {
+	NumDeleted int64
+}
+
+type DeleteShortUrlByUidCommand struct {
+	OrgId int64
+	Uid   string
+}
+
+type DeleteShortUrlsByUserCommand struct {
+	UserId int64
+
+	NumDeleted int64
+}
+
+type PurgeDeletedShortUrlsCommand struct {
+	DeletedBefore time.Time
+
+	NumDeleted int64
+}
+
+type ShortUrlStats struct {
+	// Total is the number of short URLs, including expired ones.
+	Total int64
+	// Active is the number of non-expired short URLs.
+	Active int64
+	// Hits is the total number of visits of the short URLs.
+	Hits int64
+	// CreatedRecently is the number of short URLs created within the last CreatedWithinDays days.
+	CreatedRecently int64
+}
+
+type GetShortUrlStatsQuery struct {
+	OrgId             int64
+	CreatedWithinDays int
+
+	Result *ShortUrlStats
+}
+
+type GetShortUrlPathsByUidsQuery struct {
+	OrgId int64
+	Uids  []string
+
+	// Result maps the uids of the existing short URLs to their path.
+	Result map[string]string
+}
+
+type GetShortUrlsByUserQuery struct {
+	OrgId  int64
+	UserId int64
+	Limit  int
+	Offset int
+	// CreatedAfter and CreatedBefore are the optional unix timestamps
+	// the short URLs were created strictly after and before.
+	CreatedAfter  int64
+	CreatedBefore int64
+
+	Result []*ShortUrl
+}
+
+// ShortUrlExport is a short URL as exported from an org to be imported in another Grafana instance.
+type ShortUrlExport struct {
+	Uid        string `json:"uid"`
+	Path       string `json:"path"`
+	CreatedBy  int64  `json:"createdBy"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastSeenAt int64  `json:"lastSeenAt,omitempty"`
+	ExpiresAt  int64  `json:"expiresAt,omitempty"`
+	HitCount   int64  `json:"hitCount,omitempty"`
+}
+
+type ExportShortUrlsQuery struct {
+	OrgId int64
+
+	Result []*ShortUrlExport
+}
+
+type ShortUrlImportReport struct {
+	// Imported are the uids of the short URLs created or updated by the import.
+	Imported []string
+	// Skipped are the uids of the short URLs not imported since their uid is already used for another path,
+	// or only differs by case from a used uid if uids are case-insensitive.
+	Skipped []string
+}
+
+type ImportShortUrlsCommand struct {
+	OrgId     int64
+	ShortUrls []*ShortUrlExport
+
+	Result *ShortUrlImportReport
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortUrlRedirectURL(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		path        string
+		appSubURL   string
+		expectedURL string
+	}{
+		{desc: "a path is redirected from the root", path: "d/abc?orgId=1", expectedURL: "/d/abc?orgId=1"},
+		{desc: "a path is redirected within the sub path", path: "d/abc?orgId=1", appSubURL: "/grafana", expectedURL: "/grafana/d/abc?orgId=1"},
+		{desc: "a path with a leading slash is redirected", path: "/d/abc", appSubURL: "/grafana/", expectedURL: "/grafana/d/abc"},
+		{desc: "an empty path is redirected to the root", path: "", appSubURL: "/grafana", expectedURL: "/grafana/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			shortURL := ShortUrl{Path: tc.path}
+			redirectURL, err := shortURL.RedirectURL(tc.appSubURL)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedURL, redirectURL)
+		})
+	}
+
+	invalidPaths := []string{
+		"//evil.com",
+		"/\\evil.com",
+		"https://evil.com",
+		"../other/d/abc",
+		"d/%2e%2e/%2e%2e/other",
+		"javascript:alert(1)",
+	}
+	for _, p := range invalidPaths {
+		t.Run("path "+p+" is rejected", func(t *testing.T) {
+			shortURL := ShortUrl{Path: p}
+			_, err := shortURL.RedirectURL("/grafana")
+			require.Equal(t, ErrShortURLInvalidRedirect, err)
+			_, err = shortURL.RedirectURL("")
+			require.Equal(t, ErrShortURLInvalidRedirect, err)
+		})
+	}
+}
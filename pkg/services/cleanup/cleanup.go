@@ -49,7 +49,7 @@ func (srv *CleanUpService) Run(ctx context.Context) error {
 			srv.deleteExpiredDashboardVersions()
 			srv.cleanUpOldAnnotations(ctxWithTimeout)
 			srv.expireOldUserInvites()
-			srv.deleteStaleShortURLs()
+			srv.purgeDeletedShortURLs()
 			err := srv.ServerLockService.LockAndExecute(ctx, "delete old login attempts",
 				time.Minute*10, func() {
 					srv.deleteOldLoginAttempts()
@@ -156,13 +156,13 @@ func (srv *CleanUpService) expireOldUserInvites() {
 	}
 }
 
-func (srv *CleanUpService) deleteStaleShortURLs() {
-	cmd := models.DeleteShortUrlCommand{
-		OlderThan: time.Now().Add(-time.Hour * 24 * 7),
+func (srv *CleanUpService) purgeDeletedShortURLs() {
+	cmd := models.PurgeDeletedShortUrlsCommand{
+		DeletedBefore: time.Now().Add(-time.Hour * 24 * 30),
 	}
-	if err := srv.ShortURLService.DeleteStaleShortURLs(context.Background(), &cmd); err != nil {
-		srv.log.Error("Problem deleting stale short urls", "error", err.Error())
+	if err := srv.ShortURLService.PurgeDeletedShortURLs(context.Background(), &cmd); err != nil {
+		srv.log.Error("Problem purging deleted short urls", "error", err.Error())
 	} else {
-		srv.log.Debug("Deleted short urls", "rows affected", cmd.NumDeleted)
+		srv.log.Debug("Purged deleted short urls", "rows affected", cmd.NumDeleted)
 	}
 }
@@ -2,10 +2,12 @@ package ngalert
 
 import (
 	"context"
+	"time"
 
 	"github.com/grafana/grafana/pkg/services/ngalert/eval"
 
 	"github.com/go-macaron/binding"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana/pkg/api"
 	"github.com/grafana/grafana/pkg/api/routing"
@@ -33,26 +35,16 @@ func (ng *AlertNG) conditionEval(c *models.ReqContext, dto evalAlertConditionCom
 	alertCtx, cancelFn := context.WithTimeout(context.Background(), setting.AlertingEvaluationTimeout)
 	defer cancelFn()
 
-	alertExecCtx := eval.AlertExecCtx{Ctx: alertCtx, SignedInUser: c.SignedInUser}
+	// the intermediate results show what each query and expression produced
+	alertExecCtx := eval.AlertExecCtx{Ctx: alertCtx, SignedInUser: c.SignedInUser, Metrics: ng.metrics, IncludeIntermediateResults: true}
 
+	// if from and to are missing, every query uses its own relative time range
 	fromStr := c.Query("from")
-	if fromStr == "" {
-		fromStr = "now-3h"
-	}
-
 	toStr := c.Query("to")
-	if toStr == "" {
-		toStr = "now"
-	}
 
-	execResult, err := dto.Condition.Execute(alertExecCtx, fromStr, toStr)
+	execResult, evalResults, err := dto.Condition.Preview(alertExecCtx, fromStr, toStr)
 	if err != nil {
-		return api.Error(400, "Failed to execute conditions", err)
-	}
-
-	evalResults, err := eval.EvaluateExecutionResult(execResult)
-	if err != nil {
-		return api.Error(400, "Failed to evaluate results", err)
+		return api.Error(400, "Failed to evaluate conditions", err)
 	}
 
 	frame := evalResults.AsDataFrame()
@@ -62,8 +54,23 @@ func (ng *AlertNG) conditionEval(c *models.ReqContext, dto evalAlertConditionCom
 		return api.Error(400, "Failed to encode result dataframes", err)
 	}
 
+	frames, err := tsdb.NewDecodedDataFrames(execResult.Results).Encoded()
+	if err != nil {
+		return api.Error(400, "Failed to encode query dataframes", err)
+	}
+
+	intermediateFrames := make(map[string][][]byte, len(execResult.IntermediateResults))
+	for refID, f := range execResult.IntermediateResults {
+		if intermediateFrames[refID], err = tsdb.NewDecodedDataFrames(f).Encoded(); err != nil {
+			return api.Error(400, "Failed to encode intermediate dataframes", err)
+		}
+	}
+
 	return api.JSON(200, util.DynMap{
-		"instances": instances,
+		"instances":          instances,
+		"frames":             frames,
+		"intermediateFrames": intermediateFrames,
+		"timeRange":          timeRangeJSON(execResult.TimeRange),
 	})
 }
 
@@ -71,15 +78,9 @@ func (ng *AlertNG) conditionEval(c *models.ReqContext, dto evalAlertConditionCom
 func (ng *AlertNG) alertDefinitionEval(c *models.ReqContext) api.Response {
 	alertDefinitionID := c.ParamsInt64(":alertDefinitionId")
 
+	// if from and to are missing, every query uses its own relative time range
 	fromStr := c.Query("from")
-	if fromStr == "" {
-		fromStr = "now-3h"
-	}
-
 	toStr := c.Query("to")
-	if toStr == "" {
-		toStr = "now"
-	}
 
 	conditions, err := ng.LoadAlertCondition(alertDefinitionID, c.SignedInUser, c.SkipCache)
 	if err != nil {
@@ -89,14 +90,14 @@ func (ng *AlertNG) alertDefinitionEval(c *models.ReqContext) api.Response {
 	alertCtx, cancelFn := context.WithTimeout(context.Background(), setting.AlertingEvaluationTimeout)
 	defer cancelFn()
 
-	alertExecCtx := eval.AlertExecCtx{Ctx: alertCtx, SignedInUser: c.SignedInUser}
+	alertExecCtx := eval.AlertExecCtx{Ctx: alertCtx, SignedInUser: c.SignedInUser, Metrics: ng.metrics}
 
 	execResult, err := conditions.Execute(alertExecCtx, fromStr, toStr)
-	if err != nil {
+	if err != nil && execResult == nil {
 		return api.Error(400, "Failed to execute conditions", err)
 	}
 
-	evalResults, err := eval.EvaluateExecutionResult(execResult)
+	evalResults, err := eval.EvaluateExecutionResult(conditions, execResult, eval.StrictEvaluation)
 	if err != nil {
 		return api.Error(400, "Failed to evaluate results", err)
 	}
@@ -111,9 +112,18 @@ func (ng *AlertNG) alertDefinitionEval(c *models.ReqContext) api.Response {
 
 	return api.JSON(200, util.DynMap{
 		"instances": instances,
+		"timeRange": timeRangeJSON(execResult.TimeRange),
 	})
 }
 
+// timeRangeJSON returns the evaluated time range as epoch milliseconds, for the frontend to display.
+func timeRangeJSON(tr backend.TimeRange) util.DynMap {
+	return util.DynMap{
+		"from": tr.From.UnixNano() / int64(time.Millisecond),
+		"to":   tr.To.UnixNano() / int64(time.Millisecond),
+	}
+}
+
 // getAlertDefinitionEndpoint handles GET /api/alert-definitions/:alertDefinitionId.
 func (ng *AlertNG) getAlertDefinitionEndpoint(c *models.ReqContext) api.Response {
 	alertDefinitionID := c.ParamsInt64(":alertDefinitionId")
@@ -7,6 +7,7 @@ import (
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana/pkg/expr"
+	"github.com/grafana/grafana/pkg/tsdb"
 )
 
 const defaultMaxDataPoints float64 = 100
@@ -56,6 +57,33 @@ func (rtr *RelativeTimeRange) toTimeRange(now time.Time) backend.TimeRange {
 	}
 }
 
+// parseTimeRange resolves the from and to expressions of an evaluation (e.g. "now-5m" and "now")
+// relatively to now.
+// It returns nil if both are empty, in which case each query uses its own relative time range.
+func parseTimeRange(fromStr, toStr string, now time.Time) (*backend.TimeRange, error) {
+	if fromStr == "" && toStr == "" {
+		return nil, nil
+	}
+	if toStr == "" {
+		toStr = "now"
+	}
+
+	tr := tsdb.NewFakeTimeRange(fromStr, toStr, now)
+	from, err := tr.ParseFrom()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse from %q: %w", fromStr, err)
+	}
+	to, err := tr.ParseTo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse to %q: %w", toStr, err)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid time range: from %q is not before to %q", fromStr, toStr)
+	}
+
+	return &backend.TimeRange{From: from, To: to}, nil
+}
+
 // AlertQuery represents a single query associated with an alert definition.
 type AlertQuery struct {
 	// RefID is the unique identifier of the query, set by the frontend call.
@@ -237,6 +265,18 @@ func (aq *AlertQuery) getModel() ([]byte, error) {
 	return model, nil
 }
 
+// withSampling returns the query model with its maxDataPoints and intervalMs replaced,
+// since GEL reads them from the model rather than from the data query.
+func withSampling(model []byte, maxDataPoints int64, interval time.Duration) ([]byte, error) {
+	props := make(map[string]interface{})
+	if err := json.Unmarshal(model, &props); err != nil {
+		return nil, err
+	}
+	props["maxDataPoints"] = maxDataPoints
+	props["intervalMs"] = interval.Milliseconds()
+	return json.Marshal(props)
+}
+
 func (aq *AlertQuery) setOrgID(orgID int64) error {
 	if aq.modelProps == nil {
 		err := aq.setModelProps()
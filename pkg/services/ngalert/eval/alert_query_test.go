@@ -295,3 +295,36 @@ func TestAlertQueryMarshalling(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2020, time.November, 27, 6, 5, 0, 0, time.UTC)
+
+	t.Run("returns nil if from and to are empty", func(t *testing.T) {
+		tr, err := parseTimeRange("", "", now)
+		require.NoError(t, err)
+		require.Nil(t, tr)
+	})
+
+	t.Run("resolves relative expressions", func(t *testing.T) {
+		tr, err := parseTimeRange("now-5m", "now", now)
+		require.NoError(t, err)
+		require.Equal(t, now.Add(-5*time.Minute), tr.From)
+		require.Equal(t, now, tr.To)
+	})
+
+	t.Run("to defaults to now", func(t *testing.T) {
+		tr, err := parseTimeRange("now-1h", "", now)
+		require.NoError(t, err)
+		require.Equal(t, now, tr.To)
+	})
+
+	t.Run("fails if from is not before to", func(t *testing.T) {
+		_, err := parseTimeRange("now", "now-5m", now)
+		require.Error(t, err)
+	})
+
+	t.Run("fails on invalid expressions", func(t *testing.T) {
+		_, err := parseTimeRange("now-5x", "now", now)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,50 @@
+package eval
+
+import "fmt"
+
+// BaselineComparison is how the value of each alert instance is compared to the Baseline
+// of a condition before applying its thresholds, so that deviations from an expected value
+// can alert without a math expression.
+type BaselineComparison string
+
+const (
+	// BaselineDifference applies the thresholds to the value minus the baseline.
+	BaselineDifference BaselineComparison = "difference"
+	// BaselineRatio applies the thresholds to the value divided by the baseline.
+	BaselineRatio BaselineComparison = "ratio"
+)
+
+// validateBaseline checks that the baseline comparison is supported and that the baseline can be compared to.
+func (c Condition) validateBaseline() error {
+	switch c.BaselineComparison {
+	case "":
+		if c.Baseline != 0 {
+			return fmt.Errorf("condition cannot have a baseline without a baseline comparison")
+		}
+		return nil
+	case BaselineDifference, BaselineRatio:
+	default:
+		return fmt.Errorf("invalid baseline comparison: %q", c.BaselineComparison)
+	}
+
+	if !isFinite(c.Baseline) {
+		return fmt.Errorf("invalid baseline: %v is not finite", c.Baseline)
+	}
+	if c.BaselineComparison == BaselineRatio && c.Baseline == 0 {
+		return fmt.Errorf("invalid baseline: a ratio to a zero baseline is not finite")
+	}
+	return nil
+}
+
+// comparedValue returns the value the thresholds are applied to: the value compared
+// to the Baseline according to the BaselineComparison, if any, or else the value itself.
+func (c *Condition) comparedValue(val float64) float64 {
+	switch c.BaselineComparison {
+	case BaselineDifference:
+		return val - c.Baseline
+	case BaselineRatio:
+		return val / c.Baseline
+	default:
+		return val
+	}
+}
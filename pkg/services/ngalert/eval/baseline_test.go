@@ -0,0 +1,94 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateExecutionResultWithBaseline(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		condition     Condition
+		value         float64
+		expectedState state
+	}{
+		{
+			desc:          "a difference beyond the threshold is alerting",
+			condition:     Condition{Baseline: 100, BaselineComparison: BaselineDifference, Threshold: &Threshold{Operator: GreaterThan, Value: 20}},
+			value:         125,
+			expectedState: Alerting,
+		},
+		{
+			desc:          "a difference within the threshold is normal",
+			condition:     Condition{Baseline: 100, BaselineComparison: BaselineDifference, Threshold: &Threshold{Operator: GreaterThan, Value: 20}},
+			value:         115,
+			expectedState: Normal,
+		},
+		{
+			desc:          "a value equal to the baseline is normal without a threshold",
+			condition:     Condition{Baseline: 100, BaselineComparison: BaselineDifference},
+			value:         100,
+			expectedState: Normal,
+		},
+		{
+			desc:          "a ratio beyond the threshold is alerting",
+			condition:     Condition{Baseline: 200, BaselineComparison: BaselineRatio, Threshold: &Threshold{Operator: LessThan, Value: 0.5}},
+			value:         80,
+			expectedState: Alerting,
+		},
+		{
+			desc:          "a ratio within the threshold is normal",
+			condition:     Condition{Baseline: 200, BaselineComparison: BaselineRatio, Threshold: &Threshold{Operator: LessThan, Value: 0.5}},
+			value:         120,
+			expectedState: Normal,
+		},
+		{
+			desc: "severities apply to the difference",
+			condition: Condition{Baseline: 100, BaselineComparison: BaselineDifference, Severities: []SeverityLevel{
+				{Severity: "warning", Threshold: Threshold{Operator: GreaterThan, Value: 10}},
+				{Severity: "critical", Threshold: Threshold{Operator: GreaterThan, Value: 50}},
+			}},
+			value:         120,
+			expectedState: Alerting,
+		},
+		{
+			desc:          "a non-finite value isn't compared to the baseline",
+			condition:     Condition{Baseline: 100, BaselineComparison: BaselineDifference, NonFiniteState: NonFiniteStateNoData},
+			value:         math.Inf(1),
+			expectedState: NoData,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			execResults := ExecutionResults{
+				Results: data.Frames{data.NewFrame("", data.NewField("", nil, []float64{tc.value}))},
+			}
+
+			results, err := EvaluateExecutionResult(&tc.condition, &execResults, StrictEvaluation)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, tc.expectedState, results[0].State)
+			require.Equal(t, tc.value, *results[0].Value, "the value of the query is kept")
+		})
+	}
+
+	t.Run("threshold rules apply to the difference", func(t *testing.T) {
+		execResults := ExecutionResults{
+			Results: data.Frames{data.NewFrame("", data.NewField("", nil, []float64{70}))},
+		}
+
+		c := Condition{Baseline: 100, BaselineComparison: BaselineDifference, ThresholdRules: []ThresholdRule{
+			{Name: "too_high", Threshold: Threshold{Operator: GreaterThan, Value: 20}},
+			{Name: "too_low", Threshold: Threshold{Operator: LessThan, Value: -20}},
+		}}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, Alerting, results[0].State)
+		require.Equal(t, "too_low", results[0].Instance[ThresholdRuleLabel])
+	})
+}
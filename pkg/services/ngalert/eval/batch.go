@@ -0,0 +1,62 @@
+package eval
+
+import "sync"
+
+// defaultBatchConcurrency is the maximum number of conditions executed concurrently by EvaluateBatch
+// if no concurrency is set in the AlertExecCtx.
+const defaultBatchConcurrency = 10
+
+// EvaluateBatch executes and evaluates the conditions concurrently, like Preview, with at most
+// BatchConcurrency conditions executed at a time. The results and errors are aligned with the conditions.
+// If the context is canceled, the executing conditions are aborted, and the error of every condition
+// that didn't complete is the context error. The conditions must not share their queries and expressions.
+func EvaluateBatch(ctx AlertExecCtx, conditions []Condition, fromStr, toStr string) ([]Results, []error) {
+	results := make([]Results, len(conditions))
+	errs := make([]error, len(conditions))
+
+	concurrency := ctx.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(conditions); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = evaluateBatched(ctx, &conditions[i], fromStr, toStr)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range conditions {
+		select {
+		case indexes <- i:
+		case <-ctx.Ctx.Done():
+			for j := i; j < len(conditions); j++ {
+				errs[j] = ctx.Ctx.Err()
+			}
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results, errs
+}
+
+// evaluateBatched executes and evaluates a condition of a batch.
+// Its execution failing because the batch is canceled is an error rather than an Error state.
+func evaluateBatched(ctx AlertExecCtx, c *Condition, fromStr, toStr string) (Results, error) {
+	execResults, err := c.Execute(ctx, fromStr, toStr)
+	if ctxErr := ctx.Ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil && execResults == nil {
+		return nil, err
+	}
+	return EvaluateExecutionResult(c, execResults, StrictEvaluation)
+}
@@ -0,0 +1,110 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateBatch(t *testing.T) {
+	newConditions := func(n int) []Condition {
+		conditions := make([]Condition, 0, n)
+		for i := 0; i < n; i++ {
+			conditions = append(conditions, Condition{
+				RefID: "A",
+				QueriesAndExpressions: []AlertQuery{
+					{RefID: "A", Model: json.RawMessage(fmt.Sprintf(`{"datasource": "prom", "datasourceId": 1, "value": %d}`, i))},
+				},
+				Threshold: &Threshold{Operator: GreaterThan, Value: 1},
+			})
+		}
+		return conditions
+	}
+
+	t.Run("results are aligned with the conditions", func(t *testing.T) {
+		var (
+			mu                  sync.Mutex
+			running, maxRunning int
+		)
+		ctx := AlertExecCtx{
+			Ctx:              context.Background(),
+			BatchConcurrency: 2,
+			TransformClient: TransformFunc(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					running--
+					mu.Unlock()
+				}()
+
+				var model struct {
+					Value float64 `json:"value"`
+				}
+				if err := json.Unmarshal(r.Queries[0].JSON, &model); err != nil {
+					return nil, err
+				}
+				if model.Value == 3 {
+					return &backend.QueryDataResponse{Responses: backend.Responses{}}, nil
+				}
+				return &backend.QueryDataResponse{
+					Responses: backend.Responses{
+						"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(model.Value)}))}},
+					},
+				}, nil
+			}),
+		}
+
+		conditions := newConditions(5)
+		conditions[4].Threshold.Operator = "gt1"
+		results, errs := EvaluateBatch(ctx, conditions, "", "")
+		require.Len(t, results, 5)
+		require.Len(t, errs, 5)
+
+		for i, expected := range []state{Normal, Normal, Alerting, NoData} {
+			require.NoError(t, errs[i])
+			require.Len(t, results[i], 1)
+			require.Equal(t, expected, results[i][0].State)
+		}
+		require.True(t, errors.Is(errs[4], ErrInvalidCondition))
+		require.Nil(t, results[4])
+		require.LessOrEqual(t, maxRunning, 2)
+	})
+
+	t.Run("canceling the context aborts the evaluations", func(t *testing.T) {
+		cancelCtx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		var once sync.Once
+		ctx := AlertExecCtx{
+			Ctx:              cancelCtx,
+			BatchConcurrency: 1,
+			TransformClient: TransformFunc(func(execCtx context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+				once.Do(func() { close(started) })
+				<-execCtx.Done()
+				return nil, execCtx.Err()
+			}),
+		}
+
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		results, errs := EvaluateBatch(ctx, newConditions(3), "", "")
+		require.Len(t, results, 3)
+		for _, err := range errs {
+			require.Equal(t, context.Canceled, err)
+		}
+	})
+}
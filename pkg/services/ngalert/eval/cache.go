@@ -0,0 +1,154 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ExecutionResultsCache stores the ExecutionResults of condition executions so that conditions
+// with the same queries and expressions over the same time range don't query datasources again.
+// Executions over the same relative time range, such as "now-5m", share their results within
+// the TTL of the cache, evaluated at the time of each execution. Executions on behalf of different
+// users don't share their results, since the users may not have access to the same datasources.
+// The cached ExecutionResults are shared and must not be modified.
+type ExecutionResultsCache interface {
+	Get(key string) (*ExecutionResults, bool)
+	Set(key string, results *ExecutionResults)
+}
+
+// InMemoryCache is an ExecutionResultsCache keeping ExecutionResults in memory for a TTL.
+type InMemoryCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is cached ExecutionResults and the time they expire at.
+type cacheEntry struct {
+	results   *ExecutionResults
+	expiresAt time.Time
+}
+
+// NewInMemoryCache returns an InMemoryCache keeping ExecutionResults for the TTL.
+// If the clock is nil, the wall clock is used.
+func NewInMemoryCache(ttl time.Duration, c Clock) *InMemoryCache {
+	if c == nil {
+		c = clock.New()
+	}
+	return &InMemoryCache{
+		ttl:     ttl,
+		clock:   c,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the ExecutionResults cached for the key, unless they expired.
+func (c *InMemoryCache) Get(key string) (*ExecutionResults, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.clock.Now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.results, true
+}
+
+// Set caches the ExecutionResults for the key, and evicts the expired ones.
+func (c *InMemoryCache) Set(key string, results *ExecutionResults) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{results: results, expiresAt: now.Add(c.ttl)}
+}
+
+// executionCacheKey returns the cache key of the execution of a condition: the QueryHash
+// of the condition along with the org and user executing it, the time range and sampling of every query, and the
+// offset of the comparison window, if any.
+// Relative time ranges, such as "now-5m", are keyed by their unresolved expressions, or by the
+// RelativeTimeRange of each query if the time range key is empty, so that executions within the
+// TTL of the cache share their results even though they resolve to slightly different times.
+// Absolute time ranges are keyed by the time range key as resolved.
+func executionCacheKey(c *Condition, user *models.SignedInUser, req *backend.QueryDataRequest, timeRangeKey string) string {
+	type queryKey struct {
+		RefID         string `json:"refId"`
+		TimeRange     string `json:"timeRange"`
+		MaxDataPoints int64  `json:"maxDataPoints"`
+		IntervalMS    int64  `json:"intervalMs"`
+	}
+
+	relativeTimeRanges := make(map[string]RelativeTimeRange, len(c.QueriesAndExpressions))
+	for _, q := range c.QueriesAndExpressions {
+		relativeTimeRanges[q.RefID] = q.RelativeTimeRange
+	}
+
+	queries := make([]queryKey, 0, len(req.Queries))
+	for _, q := range req.Queries {
+		tr := timeRangeKey
+		if tr == "" {
+			rtr := relativeTimeRanges[q.RefID]
+			tr = fmt.Sprintf("now-%s:now-%s", time.Duration(rtr.From), time.Duration(rtr.To))
+		}
+		queries = append(queries, queryKey{
+			RefID:         q.RefID,
+			TimeRange:     tr,
+			MaxDataPoints: q.MaxDataPoints,
+			IntervalMS:    q.Interval.Milliseconds(),
+		})
+	}
+
+	// API keys aren't users, and are told apart from them by their id
+	var userID, apiKeyID int64
+	if user != nil {
+		userID, apiKeyID = user.UserId, user.ApiKeyId
+	}
+
+	h := sha256.New()
+	// json.Encoder doesn't fail on strings and integers
+	_ = json.NewEncoder(h).Encode(struct {
+		QueryHash        string     `json:"queryHash"`
+		OrgID            int64      `json:"orgId"`
+		UserID           int64      `json:"userId"`
+		APIKeyID         int64      `json:"apiKeyId,omitempty"`
+		Queries          []queryKey `json:"queries"`
+		ComparisonOffset int64      `json:"comparisonOffset,omitempty"`
+	}{c.QueryHash(), req.PluginContext.OrgID, userID, apiKeyID, queries, int64(c.ComparisonOffset)})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// relativeTimeRangeKey returns the time range key of an execution over the from and to expressions,
+// or an empty key if they're unset and each query uses its own relative time range.
+func relativeTimeRangeKey(fromStr, toStr string) string {
+	if fromStr == "" && toStr == "" {
+		return ""
+	}
+	if toStr == "" {
+		toStr = "now"
+	}
+	return fromStr + ":" + toStr
+}
+
+// absoluteTimeRangeKey returns the time range key of an execution over an absolute time range.
+func absoluteTimeRangeKey(tr backend.TimeRange) string {
+	return fmt.Sprintf("%d:%d", tr.From.UnixNano(), tr.To.UnixNano())
+}
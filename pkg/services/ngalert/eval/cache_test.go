@@ -0,0 +1,148 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryCache(t *testing.T) {
+	mockClock := clock.NewMock()
+	cache := NewInMemoryCache(time.Minute, mockClock)
+
+	_, ok := cache.Get("key")
+	require.False(t, ok)
+
+	results := &ExecutionResults{EvaluatedAt: mockClock.Now()}
+	cache.Set("key", results)
+
+	mockClock.Add(59 * time.Second)
+	cached, ok := cache.Get("key")
+	require.True(t, ok)
+	require.Same(t, results, cached)
+
+	mockClock.Add(time.Second)
+	_, ok = cache.Get("key")
+	require.False(t, ok)
+}
+
+func TestExecuteWithCache(t *testing.T) {
+	condition := Condition{
+		RefID: "A",
+		QueriesAndExpressions: []AlertQuery{
+			{
+				RefID:             "A",
+				RelativeTimeRange: RelativeTimeRange{From: Duration(5 * time.Minute)},
+				Model:             json.RawMessage(`{"datasource": "prom", "datasourceId": 1, "expr": "up"}`),
+			},
+		},
+	}
+
+	mockClock := clock.NewMock()
+	metrics := NewMetrics(prometheus.NewRegistry())
+	transforms := 0
+	ctx := AlertExecCtx{
+		Ctx:     context.Background(),
+		Clock:   mockClock,
+		Metrics: metrics,
+		Cache:   NewInMemoryCache(time.Minute, mockClock),
+		TransformClient: TransformFunc(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			transforms++
+			return &backend.QueryDataResponse{
+				Responses: backend.Responses{
+					"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(1)}))}},
+				},
+			}, nil
+		}),
+	}
+
+	t.Run("executions over the same time range are cached", func(t *testing.T) {
+		first, err := condition.Execute(ctx, "", "")
+		require.NoError(t, err)
+		second, err := condition.Execute(ctx, "", "")
+		require.NoError(t, err)
+
+		require.Equal(t, 1, transforms)
+		require.Equal(t, first.Results, second.Results)
+		require.NotSame(t, first, second)
+		require.Equal(t, float64(1), testutil.ToFloat64(metrics.cacheHits))
+		require.Equal(t, float64(1), testutil.ToFloat64(metrics.cacheMisses))
+	})
+
+	t.Run("executions over the same relative time range later are cached", func(t *testing.T) {
+		transforms = 0
+		first, err := condition.Execute(ctx, "now-10m", "now")
+		require.NoError(t, err)
+		mockClock.Add(30 * time.Second)
+		second, err := condition.Execute(ctx, "now-10m", "now")
+		require.NoError(t, err)
+		mockClock.Add(10 * time.Second)
+		third, err := condition.Execute(ctx, "", "")
+		require.NoError(t, err)
+
+		require.Equal(t, 1, transforms)
+		require.Equal(t, first.Results, second.Results)
+		require.Equal(t, mockClock.Now().Add(-10*time.Second), second.EvaluatedAt, "cached results are evaluated at the time of the execution")
+		require.True(t, second.TimeRange.From.Equal(second.EvaluatedAt.Add(-10*time.Minute)))
+		require.True(t, second.TimeRange.To.Equal(second.EvaluatedAt))
+		require.Equal(t, mockClock.Now(), third.EvaluatedAt)
+		require.Equal(t, backend.TimeRange{From: mockClock.Now().Add(-5 * time.Minute), To: mockClock.Now()}, third.TimeRange)
+	})
+
+	t.Run("executions over another time range aren't cached", func(t *testing.T) {
+		transforms = 0
+		_, err := condition.Execute(ctx, "now-1h", "now")
+		require.NoError(t, err)
+		_, err = condition.Execute(ctx, "now-2h", "now")
+		require.NoError(t, err)
+		require.Equal(t, 2, transforms)
+	})
+
+	t.Run("executions at different times are cached separately", func(t *testing.T) {
+		transforms = 0
+		at := mockClock.Now().Add(-time.Hour)
+		_, err := condition.ExecuteAt(ctx, at, 5*time.Minute)
+		require.NoError(t, err)
+		_, err = condition.ExecuteAt(ctx, at, 5*time.Minute)
+		require.NoError(t, err)
+		_, err = condition.ExecuteAt(ctx, at.Add(time.Minute), 5*time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, 2, transforms)
+	})
+
+	t.Run("executions on behalf of different users are cached separately", func(t *testing.T) {
+		transforms = 0
+		for _, user := range []*models.SignedInUser{
+			{OrgId: 1, UserId: 1},
+			{OrgId: 1, UserId: 2},
+			{OrgId: 1, ApiKeyId: 1},
+			{OrgId: 1, UserId: 1},
+		} {
+			userCtx := ctx
+			userCtx.SignedInUser = user
+			_, err := condition.Execute(userCtx, "now-10m", "now")
+			require.NoError(t, err)
+		}
+		require.Equal(t, 3, transforms)
+	})
+
+	t.Run("conditions can disable caching", func(t *testing.T) {
+		transforms = 0
+		c := condition
+		c.DisableCache = true
+		_, err := c.Execute(ctx, "", "")
+		require.NoError(t, err)
+		_, err = c.Execute(ctx, "", "")
+		require.NoError(t, err)
+		require.Equal(t, 2, transforms)
+	})
+}
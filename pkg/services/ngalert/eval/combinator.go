@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Combinator is the boolean operator folding the states
+// of the alert instances of multiple RefIDs.
+type Combinator string
+
+const (
+	// And is alerting if the alert instance is alerting for every RefID.
+	And Combinator = "and"
+	// Or is alerting if the alert instance is alerting for any RefID.
+	Or Combinator = "or"
+)
+
+// validate checks that the combinator is supported.
+func (cb Combinator) validate() error {
+	switch cb {
+	case And, Or:
+		return nil
+	default:
+		return fmt.Errorf("invalid combinator: %q", cb)
+	}
+}
+
+// combine folds the evaluated results of each RefID into a single result per alert instance.
+// Alert instances are matched by identical labels, and an alert instance missing
+// from the results of a RefID is considered normal for it.
+// A combined alert instance is the result for the first RefID it appears in, such as its value and
+// annotations, with the folded state. The severity of an alerting combined alert instance is its
+// highest severity by rank, and the error of a combined alert instance in Error is the first error
+// of a RefID it's in Error for.
+// The RefIDLabel of an alerting combined alert instance lists the RefIDs it's alerting for,
+// otherwise the RefIDs it was evaluated for, separated by commas.
+func (cb Combinator) combine(refIDs []string, refResults []Results, severityRank func(Severity) int) Results {
+	combined := make(Results, 0)
+	index := make(map[string]int)
+	counts := make(map[string]map[state]int)
+	evaluatedRefIDs := make(map[string][]string)
+	alertingRefIDs := make(map[string][]string)
+	errs := make(map[string]error)
+	for i, results := range refResults {
+		for _, r := range results {
+			key := instanceKey(r.Instance)
+			if _, ok := index[key]; !ok {
+				index[key] = len(combined)
+				combined = append(combined, r)
+				counts[key] = make(map[state]int)
+			}
+			if _, ok := errs[key]; !ok && r.State == Error && r.Error != nil {
+				errs[key] = fmt.Errorf("refID %s: %w", refIDs[i], r.Error)
+			}
+			counts[key][r.State]++
+			evaluatedRefIDs[key] = append(evaluatedRefIDs[key], refIDs[i])
+			if r.State == Alerting {
+				alertingRefIDs[key] = append(alertingRefIDs[key], refIDs[i])
+			}
+			if j := index[key]; severityRank(r.Severity) > severityRank(combined[j].Severity) {
+				combined[j].Severity = r.Severity
+			}
+		}
+	}
+
+	for i := range combined {
+		key := instanceKey(combined[i].Instance)
+		combined[i].State = cb.fold(counts[key], len(refResults))
+		combined[i].Error = nil
+		if combined[i].State == Error {
+			combined[i].Error = errs[key]
+		}
+		refs := evaluatedRefIDs[key]
+		if combined[i].State == Alerting {
+			refs = alertingRefIDs[key]
+		} else {
+			combined[i].Severity = ""
+		}
+		combined[i].Instance = withLabel(combined[i].Instance, RefIDLabel, strings.Join(refs, ","))
+	}
+	return combined
+}
+
+// fold returns the state of an alert instance given how many RefIDs
+// evaluated to each state out of total.
+func (cb Combinator) fold(counts map[state]int, total int) state {
+	switch {
+	case cb == Or && counts[Alerting] > 0:
+		return Alerting
+	case cb != Or && counts[Alerting] == total:
+		return Alerting
+	case counts[Error] > 0:
+		return Error
+	case counts[NoData] > 0:
+		return NoData
+	default:
+		return Normal
+	}
+}
@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// validateComparison checks that the comparison window offset is positive, if set,
+// and that it isn't combined with a baseline, which values would be compared to instead.
+func (c Condition) validateComparison() error {
+	if c.ComparisonOffset == 0 {
+		return nil
+	}
+	if c.ComparisonOffset < 0 {
+		return fmt.Errorf("invalid comparison offset: %s is negative", time.Duration(c.ComparisonOffset))
+	}
+	if c.BaselineComparison != "" {
+		return fmt.Errorf("condition cannot have both a comparison offset and a baseline comparison")
+	}
+	return nil
+}
+
+// comparisonRequest returns a copy of the request with the time range of every query
+// shifted back by the offset.
+func comparisonRequest(req *backend.QueryDataRequest, offset time.Duration) *backend.QueryDataRequest {
+	comparison := *req
+	comparison.Queries = make([]backend.DataQuery, 0, len(req.Queries))
+	for _, q := range req.Queries {
+		q.TimeRange = backend.TimeRange{
+			From: q.TimeRange.From.Add(-offset),
+			To:   q.TimeRange.To.Add(-offset),
+		}
+		comparison.Queries = append(comparison.Queries, q)
+	}
+	return &comparison
+}
+
+// withComparison returns the condition to evaluate frames with. If the condition has a ComparisonOffset,
+// it's a copy comparing the alert instances to their values in the frames of the comparison window,
+// which are evaluated the same way without thresholds.
+func (c *Condition) withComparison(comparisonFrames data.Frames, mode EvaluationMode, matchers labelMatchers) (*Condition, error) {
+	if c.ComparisonOffset <= 0 {
+		return c, nil
+	}
+
+	base := *c
+	base.Threshold = nil
+	base.Severities = nil
+	base.ThresholdRules = nil
+	base.comparisonValues = nil
+	comparisonResults, err := base.evaluateFrames(comparisonFrames, mode, matchers)
+	if err != nil {
+		return nil, fmt.Errorf("comparison window: %w", err)
+	}
+
+	cc := *c
+	cc.comparisonValues = make(map[string]float64, len(comparisonResults))
+	for _, r := range comparisonResults {
+		if r.Value != nil {
+			cc.comparisonValues[instanceKey(r.Instance)] = *r.Value
+		}
+	}
+	return &cc, nil
+}
+
+// applyComparison evaluates the alert instance of a finite value by applying the ThresholdRules,
+// Severities or Threshold to the ratio of its value to its comparison value.
+// Alert instances without a comparison value evaluate to the state of the NoDataState,
+// and non-finite ratios, such as to a zero comparison value, to the state of the NonFiniteState.
+func (c *Condition) applyComparison(r result) []result {
+	previous, ok := c.comparisonValues[instanceKey(r.Instance)]
+	if !ok {
+		r.State = c.NoDataState.state()
+		return []result{r}
+	}
+
+	ratio := *r.Value / previous
+	if !isFinite(ratio) {
+		r.State = c.NonFiniteState.state()
+		if r.State == Error {
+			r.Error = fmt.Errorf("non-finite ratio of value %v to comparison value %v", *r.Value, previous)
+		}
+		return []result{r}
+	}
+
+	if len(c.ThresholdRules) > 0 {
+		return c.applyThresholdRules(r, ratio)
+	}
+	return []result{c.applyThreshold(r, ratio)}
+}
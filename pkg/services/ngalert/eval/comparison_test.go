@@ -0,0 +1,167 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithComparisonOffset(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Date(2021, time.January, 8, 12, 0, 0, 0, time.UTC))
+	weekAgo := mockClock.Now().Add(-7 * 24 * time.Hour)
+
+	var timeRanges []backend.TimeRange
+	ctx := AlertExecCtx{Ctx: context.Background(), Clock: mockClock}
+	ctx.TransformClient = TransformFunc(func(_ context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		tr := req.Queries[0].TimeRange
+		timeRanges = append(timeRanges, tr)
+		val := 150.0
+		if tr.To.Equal(weekAgo) {
+			val = 100
+		}
+		return &backend.QueryDataResponse{Responses: backend.Responses{
+			"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []float64{val}))}},
+		}}, nil
+	})
+
+	c := Condition{
+		RefID: "A",
+		QueriesAndExpressions: []AlertQuery{{
+			RefID:             "A",
+			RelativeTimeRange: RelativeTimeRange{From: Duration(time.Hour)},
+			Model:             json.RawMessage(`{"datasource": "fake", "datasourceId": 1}`),
+		}},
+		ComparisonOffset: Duration(7 * 24 * time.Hour),
+		Threshold:        &Threshold{Operator: GreaterThan, Value: 1.2},
+	}
+
+	execResults, err := c.Execute(ctx, "", "")
+	require.NoError(t, err)
+	require.Equal(t, []backend.TimeRange{
+		{From: mockClock.Now().Add(-time.Hour), To: mockClock.Now()},
+		{From: weekAgo.Add(-time.Hour), To: weekAgo},
+	}, timeRanges)
+	require.Equal(t, backend.TimeRange{From: mockClock.Now().Add(-time.Hour), To: mockClock.Now()}, execResults.TimeRange)
+	require.Len(t, execResults.ComparisonResultsByRefID["A"], 1)
+
+	results, err := EvaluateExecutionResult(&c, execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, Alerting, results[0].State, "the ratio of 1.5 is above the threshold")
+	require.Equal(t, 150.0, *results[0].Value, "the value of the query is kept")
+}
+
+func TestEvaluateExecutionResultWithComparison(t *testing.T) {
+	frame := func(val *float64, labels data.Labels) *data.Frame {
+		return data.NewFrame("", data.NewField("", labels, []*float64{val}))
+	}
+
+	testCases := []struct {
+		desc          string
+		condition     Condition
+		frames        data.Frames
+		comparison    data.Frames
+		expectedState state
+		expectedErr   string
+	}{
+		{
+			desc:          "a ratio beyond the threshold is alerting",
+			condition:     Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 1.2}},
+			frames:        data.Frames{frame(nullableFloat(130), nil)},
+			comparison:    data.Frames{frame(nullableFloat(100), nil)},
+			expectedState: Alerting,
+		},
+		{
+			desc:          "a ratio within the threshold is normal",
+			condition:     Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 1.2}},
+			frames:        data.Frames{frame(nullableFloat(110), nil)},
+			comparison:    data.Frames{frame(nullableFloat(100), nil)},
+			expectedState: Normal,
+		},
+		{
+			desc:          "an alert instance without a comparison value evaluates to the no data state",
+			condition:     Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 1.2}, NoDataState: NoDataStateOK},
+			frames:        data.Frames{frame(nullableFloat(130), data.Labels{"host": "a"})},
+			comparison:    data.Frames{frame(nullableFloat(100), data.Labels{"host": "b"})},
+			expectedState: Normal,
+		},
+		{
+			desc:          "a null comparison value is no comparison value",
+			condition:     Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 1.2}},
+			frames:        data.Frames{frame(nullableFloat(130), nil)},
+			comparison:    data.Frames{frame(nil, nil)},
+			expectedState: NoData,
+		},
+		{
+			desc:          "a ratio to a zero comparison value evaluates to the non-finite state",
+			condition:     Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 1.2}},
+			frames:        data.Frames{frame(nullableFloat(130), nil)},
+			comparison:    data.Frames{frame(nullableFloat(0), nil)},
+			expectedState: Error,
+			expectedErr:   "non-finite ratio of value 130 to comparison value 0",
+		},
+		{
+			desc: "severities apply to the ratio",
+			condition: Condition{Severities: []SeverityLevel{
+				{Severity: "warning", Threshold: Threshold{Operator: LessThan, Value: 0.8}},
+				{Severity: "critical", Threshold: Threshold{Operator: LessThan, Value: 0.5}},
+			}},
+			frames:        data.Frames{frame(nullableFloat(70), nil)},
+			comparison:    data.Frames{frame(nullableFloat(100), nil)},
+			expectedState: Alerting,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.condition.RefID = "A"
+			tc.condition.ComparisonOffset = Duration(24 * time.Hour)
+			execResults := ExecutionResults{
+				Results:                  tc.frames,
+				ComparisonResultsByRefID: map[string]data.Frames{"A": tc.comparison},
+			}
+
+			results, err := EvaluateExecutionResult(&tc.condition, &execResults, StrictEvaluation)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, tc.expectedState, results[0].State)
+			if tc.expectedErr != "" {
+				require.EqualError(t, results[0].Error, tc.expectedErr)
+			}
+		})
+	}
+
+	t.Run("threshold rules apply to the ratio of each alert instance", func(t *testing.T) {
+		c := Condition{
+			RefID:            "A",
+			ComparisonOffset: Duration(24 * time.Hour),
+			ThresholdRules: []ThresholdRule{
+				{Name: "too_high", Threshold: Threshold{Operator: GreaterThan, Value: 1.5}},
+				{Name: "too_low", Threshold: Threshold{Operator: LessThan, Value: 0.5}},
+			},
+		}
+		execResults := ExecutionResults{
+			Results: data.Frames{
+				frame(nullableFloat(40), data.Labels{"host": "a"}),
+				frame(nullableFloat(100), data.Labels{"host": "b"}),
+			},
+			ComparisonResultsByRefID: map[string]data.Frames{"A": {
+				frame(nullableFloat(100), data.Labels{"host": "a"}),
+				frame(nullableFloat(50), data.Labels{"host": "b"}),
+			}},
+		}
+
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, "too_low", results[0].Instance[ThresholdRuleLabel])
+		require.Equal(t, "too_high", results[1].Instance[ThresholdRuleLabel])
+	})
+}
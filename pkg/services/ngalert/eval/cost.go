@@ -0,0 +1,51 @@
+package eval
+
+// The weights of the cost score of a condition. Datasource queries dominate the cost of an execution
+// since they leave the process and scan data, each distinct datasource adds the overhead of a request,
+// while expressions are computed in-process on the data already returned.
+const (
+	queryCostWeight      = 10
+	datasourceCostWeight = 5
+	expressionCostWeight = 1
+)
+
+// Cost is the estimated cost of executing a condition, e.g. for a scheduler to throttle
+// expensive alert rules or to warn their authors.
+type Cost struct {
+	// Queries is the number of datasource queries.
+	Queries int
+	// Expressions is the number of expressions.
+	Expressions int
+	// Datasources is the number of distinct datasources queried.
+	Datasources int
+	// UsesExpressions is true if the condition has expressions, which require the transform.
+	UsesExpressions bool
+	// Score is the weighted sum of the queries, datasources and expressions, for comparing conditions.
+	Score int
+}
+
+// EstimateCost estimates the cost of executing the condition from its queries and expressions,
+// without executing it. Queries whose datasource can't be told are counted as datasource queries
+// but not as distinct datasources.
+func (c *Condition) EstimateCost() Cost {
+	var cost Cost
+	datasources := make(map[int64]struct{}, len(c.QueriesAndExpressions))
+	for i := range c.QueriesAndExpressions {
+		q := &c.QueriesAndExpressions[i]
+		isExpression, err := q.IsExpression()
+		switch {
+		case err != nil:
+			cost.Queries++
+		case isExpression:
+			cost.Expressions++
+		default:
+			cost.Queries++
+			datasources[q.DatasourceID] = struct{}{}
+		}
+	}
+
+	cost.Datasources = len(datasources)
+	cost.UsesExpressions = cost.Expressions > 0
+	cost.Score = cost.Queries*queryCostWeight + cost.Datasources*datasourceCostWeight + cost.Expressions*expressionCostWeight
+	return cost
+}
@@ -0,0 +1,33 @@
+package eval
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionEstimateCost(t *testing.T) {
+	c := Condition{
+		RefID: "D",
+		QueriesAndExpressions: []AlertQuery{
+			{RefID: "A", Model: json.RawMessage(`{"datasource": "prom", "datasourceId": 1}`)},
+			{RefID: "B", Model: json.RawMessage(`{"datasource": "prom", "datasourceId": 1}`)},
+			{RefID: "C", Model: json.RawMessage(`{"datasource": "loki", "datasourceId": 2}`)},
+			{RefID: "D", Model: json.RawMessage(`{"datasource": "__expr__", "type": "math", "expression": "$A + $B + $C"}`)},
+		},
+	}
+	require.Equal(t, Cost{Queries: 3, Expressions: 1, Datasources: 2, UsesExpressions: true, Score: 41}, c.EstimateCost())
+
+	simple := Condition{
+		RefID:                 "A",
+		QueriesAndExpressions: []AlertQuery{{RefID: "A", Model: json.RawMessage(`{"datasource": "prom", "datasourceId": 1}`)}},
+	}
+	require.Equal(t, Cost{Queries: 1, Datasources: 1, Score: 15}, simple.EstimateCost())
+
+	invalid := Condition{
+		RefID:                 "A",
+		QueriesAndExpressions: []AlertQuery{{RefID: "A", Model: json.RawMessage(`{}`)}},
+	}
+	require.Equal(t, Cost{Queries: 1, Score: 10}, invalid.EstimateCost(), "queries of unknown datasources are still queries")
+}
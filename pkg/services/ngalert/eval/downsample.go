@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// validateDownsample checks that the frames of the condition can be downsampled before being reduced.
+// Counting reduced buckets would count buckets rather than values, so the count reducer is rejected.
+func (c Condition) validateDownsample() error {
+	if c.Downsample == 0 {
+		return nil
+	}
+	if c.Downsample < 0 {
+		return fmt.Errorf("invalid downsample: %d is negative", c.Downsample)
+	}
+	if c.Reducer == "" {
+		return fmt.Errorf("condition cannot downsample without a reducer")
+	}
+	if c.Reducer == ReduceCount {
+		return fmt.Errorf("condition cannot downsample with reducer %q", c.Reducer)
+	}
+	return nil
+}
+
+// bucketAggregation returns how the values of the buckets of a downsampled field are aggregated
+// for the reducer, so that the reduced value is the same as at full resolution for last, min, max
+// and sum, and close to it for mean, median and the registered reducers, which use bucket means.
+func bucketAggregation(r ReducerType) ReducerType {
+	switch r {
+	case ReduceLast, ReduceMin, ReduceMax, ReduceSum:
+		return r
+	default:
+		return ReduceMean
+	}
+}
+
+// downsample returns the field with its rows bucketed into the given number of buckets of consecutive
+// rows, each aggregated for the reducer. Buckets without non-null values are null.
+// Fields with no more rows than buckets are returned unchanged.
+func downsample(field *data.Field, buckets int, r ReducerType) (*data.Field, error) {
+	rowLen := field.Len()
+	if rowLen <= buckets {
+		return field, nil
+	}
+
+	agg := bucketAggregation(r)
+	vals := make([]*float64, buckets)
+	for b := 0; b < buckets; b++ {
+		var acc float64
+		var n int
+		for i := b * rowLen / buckets; i < (b+1)*rowLen/buckets; i++ {
+			if _, ok := field.ConcreteAt(i); !ok {
+				continue
+			}
+			val, err := field.FloatAt(i)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case n == 0, agg == ReduceLast:
+				acc = val
+			case agg == ReduceMin && val < acc, agg == ReduceMax && val > acc:
+				acc = val
+			case agg == ReduceSum, agg == ReduceMean:
+				acc += val
+			}
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		if agg == ReduceMean {
+			acc /= float64(n)
+		}
+		vals[b] = &acc
+	}
+	return data.NewField(field.Name, field.Labels, vals), nil
+}
@@ -0,0 +1,113 @@
+package eval
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+// seasonalField returns a field of a noisy daily pattern with every seventh value missing.
+func seasonalField(n int) *data.Field {
+	vals := make([]*float64, n)
+	for i := range vals {
+		if i%7 == 3 {
+			continue
+		}
+		val := 100 + 20*math.Sin(float64(i)/float64(n)*2*math.Pi) + float64(i%13)
+		vals[i] = &val
+	}
+	return data.NewField("", data.Labels{"host": "a"}, vals)
+}
+
+func TestDownsample(t *testing.T) {
+	field := seasonalField(10000)
+
+	for _, r := range []ReducerType{ReduceLast, ReduceMin, ReduceMax, ReduceSum} {
+		t.Run(string(r)+" is exact", func(t *testing.T) {
+			downsampled, err := downsample(field, 100, r)
+			require.NoError(t, err)
+			require.Equal(t, 100, downsampled.Len())
+
+			expected, _, err := r.reduce(field)
+			require.NoError(t, err)
+			actual, _, err := r.reduce(downsampled)
+			require.NoError(t, err)
+			require.InDelta(t, expected, actual, 1e-6)
+		})
+	}
+
+	for _, r := range []ReducerType{ReduceMean, ReduceMedian} {
+		t.Run(string(r)+" is close", func(t *testing.T) {
+			downsampled, err := downsample(field, 100, r)
+			require.NoError(t, err)
+
+			expected, _, err := r.reduce(field)
+			require.NoError(t, err)
+			actual, _, err := r.reduce(downsampled)
+			require.NoError(t, err)
+			require.InEpsilon(t, expected, actual, 0.01)
+		})
+	}
+
+	t.Run("buckets of null values are null", func(t *testing.T) {
+		field := data.NewField("", nil, []*float64{nil, nil, nullableFloat(1), nullableFloat(3)})
+		downsampled, err := downsample(field, 2, ReduceMean)
+		require.NoError(t, err)
+		require.Nil(t, downsampled.At(0))
+		require.Equal(t, nullableFloat(2), downsampled.At(1))
+	})
+
+	t.Run("fields with fewer rows are unchanged", func(t *testing.T) {
+		downsampled, err := downsample(field, 20000, ReduceMean)
+		require.NoError(t, err)
+		require.Same(t, field, downsampled)
+	})
+}
+
+func TestEvaluateExecutionResultWithDownsample(t *testing.T) {
+	times := make([]time.Time, 10000)
+	for i := range times {
+		times[i] = time.Unix(int64(i), 0)
+	}
+	execResults := ExecutionResults{
+		Results: data.Frames{data.NewFrame("", data.NewField("time", nil, times), seasonalField(len(times)))},
+	}
+
+	c := Condition{RefID: "A", Reducer: ReduceMax, Downsample: 100, Threshold: &Threshold{Operator: GreaterThan, Value: 130}}
+	results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, Alerting, results[0].State)
+
+	full := Condition{RefID: "A", Reducer: ReduceMax, Threshold: &Threshold{Operator: GreaterThan, Value: 130}}
+	fullResults, err := EvaluateExecutionResult(&full, &execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Equal(t, *fullResults[0].Value, *results[0].Value)
+}
+
+func BenchmarkDownsample(b *testing.B) {
+	execResults := ExecutionResults{Results: data.Frames{data.NewFrame("", seasonalField(100000))}}
+
+	for _, r := range []ReducerType{ReduceMean, ReduceMedian} {
+		b.Run(string(r)+"/full", func(b *testing.B) {
+			c := Condition{RefID: "A", Reducer: r}
+			for i := 0; i < b.N; i++ {
+				if _, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(string(r)+"/downsampled", func(b *testing.B) {
+			c := Condition{RefID: "A", Reducer: r, Downsample: 100}
+			for i := 0; i < b.N; i++ {
+				if _, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,15 +4,101 @@ package eval
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana/pkg/expr"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins/datasource/wrapper"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tlog "github.com/opentracing/opentracing-go/log"
 )
 
+// defaultEvaluationTimeout is the maximum duration of a condition execution
+// if no timeout is set in the AlertExecCtx.
+const defaultEvaluationTimeout = 30 * time.Second
+
+// defaultMaxFrames is the maximum number of frames of an evaluated RefID
+// if no maximum is set in the AlertExecCtx.
+const defaultMaxFrames = 10000
+
+var (
+	// ErrInvalidCondition is an error for a condition that cannot be executed.
+	// Its execution should not be retried.
+	ErrInvalidCondition = errors.New("invalid condition")
+
+	// ErrNoResults is an error for a condition execution without results for an evaluated RefID.
+	ErrNoResults = errors.New("no GEL results")
+
+	// ErrTransformFailed is an error for a failed transform of the condition queries and expressions.
+	// It may be transient and its execution can be retried.
+	ErrTransformFailed = errors.New("failed to transform data")
+
+	// ErrTransformUnavailable is an error for a condition execution without a usable TransformClient,
+	// e.g. a nil TransformFunc, which can't execute anything but a simplified condition.
+	ErrTransformUnavailable = errors.New("transform is unavailable")
+
+	// ErrTooManyFrames is an error for a condition execution returning more frames for an evaluated RefID
+	// than the maximum of the AlertExecCtx, which would be costly to evaluate.
+	ErrTooManyFrames = errors.New("too many frames")
+
+	// ErrQueryFailed is an error for a condition execution whose response has an error for an evaluated RefID.
+	ErrQueryFailed = errors.New("query failed")
+)
+
+// transformError is an error for a failed transform of the condition queries and expressions.
+// It matches ErrTransformFailed and wraps the underlying error.
+type transformError struct {
+	reason string
+	err    error
+}
+
+func (e *transformError) Error() string {
+	s := ErrTransformFailed.Error()
+	if e.reason != "" {
+		s = fmt.Sprintf("%s: %s", s, e.reason)
+	}
+	return fmt.Sprintf("%s: %s", s, e.err.Error())
+}
+
+func (e *transformError) Is(target error) bool {
+	return target == ErrTransformFailed
+}
+
+func (e *transformError) Unwrap() error {
+	return e.err
+}
+
+// queryError is an error for a failed query or expression of the condition.
+// It matches ErrQueryFailed and wraps the error of the response for its refID.
+type queryError struct {
+	refID string
+	err   error
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("%s for refID %s: %s", ErrQueryFailed.Error(), e.refID, e.err.Error())
+}
+
+func (e *queryError) Is(target error) bool {
+	return target == ErrQueryFailed
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
 // invalidEvalResultFormatError is an error for invalid format of the alert definition evaluation results.
 type invalidEvalResultFormatError struct {
 	refID  string
@@ -32,12 +118,108 @@ func (e *invalidEvalResultFormatError) Unwrap() error {
 	return e.err
 }
 
+// conditionVersion is the current version of the Condition JSON schema.
+// Version 0 conditions predate RefIDs and only have a RefID.
+const conditionVersion = 1
+
 // Condition contains backend expressions and queries and the RefID
 // of the query or expression that will be evaluated.
 type Condition struct {
+	// Version is the version of the Condition JSON schema.
+	Version int `json:"version"`
+
 	RefID string `json:"refId"`
 
+	// RefIDs are the optional RefIDs of the queries or expressions that will be evaluated
+	// instead of RefID. Their alert instance states are folded using the Combinator.
+	RefIDs []string `json:"refIds,omitempty"`
+
+	// Combinator folds the states of the alert instances of multiple RefIDs.
+	// If it's missing, And is used.
+	Combinator Combinator `json:"combinator,omitempty"`
+
 	QueriesAndExpressions []AlertQuery `json:"queriesAndExpressions"`
+
+	// Threshold is the optional comparison applied to the evaluated value.
+	// If it's missing, any non-zero value is alerting.
+	Threshold *Threshold `json:"threshold,omitempty"`
+
+	// Severities are the optional severity levels, ordered from the lowest to the highest,
+	// replacing the Threshold. An alert instance is alerting with the highest severity
+	// whose threshold its value satisfies.
+	Severities []SeverityLevel `json:"severities,omitempty"`
+
+	// ThresholdRules are the optional named thresholds replacing the Threshold, such as
+	// "too high" and "too low" bounds. An alert instance is evaluated to an Alerting alert
+	// instance per threshold rule its value satisfies, labeled with the name of the rule.
+	ThresholdRules []ThresholdRule `json:"thresholdRules,omitempty"`
+
+	// Baseline is the expected value the value of each alert instance is compared to according
+	// to the BaselineComparison, if set, before applying the Threshold, Severities or ThresholdRules.
+	// The evaluated value of the alert instance remains the value of the query.
+	Baseline           float64            `json:"baseline,omitempty"`
+	BaselineComparison BaselineComparison `json:"baselineComparison,omitempty"`
+
+	// ComparisonOffset optionally executes the queries a second time over their time ranges
+	// shifted back by the offset, e.g. a week, and applies the Threshold, Severities or
+	// ThresholdRules to the ratio of the value of each alert instance to its value in the
+	// comparison window. Alert instances without a comparison value evaluate to the NoDataState.
+	// The evaluated value of the alert instance remains the value of the query.
+	ComparisonOffset Duration `json:"comparisonOffset,omitempty"`
+
+	// Reducer is the optional function collapsing multi-row frames to a single value.
+	// If it's missing, frames are expected to have a single row.
+	Reducer ReducerType `json:"reducer,omitempty"`
+
+	// Downsample is the optional number of points the value fields of frames with more rows are
+	// bucketed to before being reduced by the Reducer, so that long windows aren't reduced at full
+	// resolution. Buckets are consecutive rows aggregated according to the Reducer.
+	Downsample int `json:"downsample,omitempty"`
+
+	// NoDataState is the state of the alert instances if the condition returns no data.
+	// If it's missing, NoData is used.
+	NoDataState NoDataState `json:"noDataState,omitempty"`
+
+	// ExecErrState is the state of the alert instances if the condition fails to execute.
+	// If it's missing, Error is used.
+	ExecErrState ExecErrState `json:"execErrState,omitempty"`
+
+	// NonFiniteState is the state of the alert instances whose value is NaN or infinite,
+	// which no threshold is applied to. If it's missing, Error is used.
+	NonFiniteState NonFiniteState `json:"nonFiniteState,omitempty"`
+
+	// AlertingStrings are the values of string fields that are alerting.
+	// Boolean fields are alerting if they're true.
+	AlertingStrings []string `json:"alertingStrings,omitempty"`
+
+	// LabelMatchers optionally restrict the evaluated alert instances to those whose labels
+	// match all of them, so that a query can back differently scoped alerts.
+	LabelMatchers []LabelMatcher `json:"labelMatchers,omitempty"`
+
+	// LabelTemplates optionally derive labels of the evaluated alert instances from their labels,
+	// such as renaming or combining them, before alert instances are grouped.
+	LabelTemplates []LabelTemplate `json:"labelTemplates,omitempty"`
+
+	// MaxDataPoints and Interval optionally override those of every query
+	// so that the evaluation cost doesn't depend on how queries were authored.
+	MaxDataPoints int64    `json:"maxDataPoints,omitempty"`
+	Interval      Duration `json:"interval,omitempty"`
+
+	// RejectMixedQueryTypes rejects conditions whose queries of the same datasource have different
+	// query types, since some datasources misbehave when query types are unexpectedly mixed.
+	// By default, query types can be mixed, as conditions saved before the check was added may do.
+	RejectMixedQueryTypes bool `json:"rejectMixedQueryTypes,omitempty"`
+
+	// DisableCache prevents the execution results of the condition from being cached,
+	// so that its queries are always executed.
+	DisableCache bool `json:"disableCache,omitempty"`
+
+	// simplified is set by Simplify if the condition is a single datasource query.
+	simplified bool
+
+	// comparisonValues are the values of the alert instances in the comparison window
+	// by instanceKey while evaluating a condition with a ComparisonOffset.
+	comparisonValues map[string]float64
 }
 
 // ExecutionResults contains the unevaluated results from executing
@@ -45,9 +227,35 @@ type Condition struct {
 type ExecutionResults struct {
 	AlertDefinitionID int64
 
+	// EvaluatedAt is the time of the condition execution.
+	EvaluatedAt time.Time
+
+	// TimeRange is the window the datasource queries were executed over, from the earliest
+	// start to the latest end of their resolved time ranges.
+	TimeRange backend.TimeRange
+
 	Error error
 
+	// ErrorsByRefID contains the errors of the responses of the failed queries and expressions,
+	// evaluated or not, to tell which of them caused the failure of a condition.
+	ErrorsByRefID map[string]error
+
+	// Results contains the frames of the condition RefID.
 	Results data.Frames
+
+	// ResultsByRefID contains the frames of each evaluated RefID.
+	ResultsByRefID map[string]data.Frames
+
+	// ComparisonResultsByRefID contains the frames of each evaluated RefID over the comparison window,
+	// if the condition has a ComparisonOffset.
+	ComparisonResultsByRefID map[string]data.Frames
+
+	// IntermediateResults contains the frames of each query or expression that isn't evaluated,
+	// such as the inputs of the evaluated expressions. It's only set if the AlertExecCtx includes them.
+	IntermediateResults map[string]data.Frames
+
+	// metrics records the evaluated states of the alert instances of the execution.
+	metrics *Metrics
 }
 
 // Results is a slice of evaluated alert instances states.
@@ -58,8 +266,38 @@ type Results []result
 type result struct {
 	Instance data.Labels
 	State    state // Enum
+	// Value is the evaluated value of the alert instance.
+	// It's nil if the alert instance has no value.
+	Value *float64
+	// EvaluatedAt is the time of the condition execution.
+	EvaluatedAt time.Time
+	// TimeRange is the window the condition was evaluated over.
+	TimeRange backend.TimeRange
+	// Error is the reason of the Error state of an alert instance whose frame could not be evaluated.
+	Error error
+	// Severity is the highest severity level reached by the value of an alerting instance.
+	// It's only set if the condition has Severities.
+	Severity Severity
+	// Annotations describe the evaluated value of the alert instance, such as its display name
+	// and unit, from the config of its field, for notifications to render. They're nil if there is none.
+	Annotations map[string]string
+	// Firing is the change of the alerting state of the alert instance since the previous evaluation.
+	// It's only set by EvaluateWithHistory.
+	Firing Firing
 }
 
+// EvaluationMode selects how frames that cannot be evaluated are handled.
+type EvaluationMode int
+
+const (
+	// StrictEvaluation fails the whole evaluation on the first frame that cannot be evaluated.
+	StrictEvaluation EvaluationMode = iota
+
+	// LenientEvaluation evaluates the alert instance of a frame that cannot be evaluated
+	// to Error, and still evaluates the other frames.
+	LenientEvaluation
+)
+
 // state is an enum of the evaluation state for an alert instance.
 type state int
 
@@ -69,18 +307,354 @@ const (
 	Normal state = iota
 
 	// Alerting is the eval state for an alert instance condition
-	// that evaluated to false.
+	// that evaluated to true.
 	Alerting
+
+	// NoData is the eval state for an alert instance condition
+	// that returned no data.
+	NoData
+
+	// Error is the eval state for an alert instance condition
+	// that failed to execute.
+	Error
 )
 
 func (s state) String() string {
-	return [...]string{"Normal", "Alerting"}[s]
+	return [...]string{"Normal", "Alerting", "NoData", "Error"}[s]
+}
+
+// UnmarshalCondition parses the JSON encoded condition and migrates it
+// from older versions of the schema to the current one.
+func UnmarshalCondition(b []byte) (*Condition, error) {
+	var c Condition
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	switch c.Version {
+	case 0:
+		// the RefID is kept as is since a single RefID isn't combined with others
+		c.Version = conditionVersion
+	case conditionVersion:
+	default:
+		return nil, fmt.Errorf("unsupported condition version: %d", c.Version)
+	}
+	return &c, nil
 }
 
 // IsValid checks the condition's validity.
 func (c Condition) IsValid() bool {
-	// TODO search for refIDs in QueriesAndExpressions
-	return len(c.QueriesAndExpressions) != 0
+	return c.Validate() == nil
+}
+
+// Validate checks the condition's validity and returns
+// an error describing the first problem found.
+func (c Condition) Validate() error {
+	if len(c.QueriesAndExpressions) == 0 {
+		return fmt.Errorf("condition must contain at least one query or expression")
+	}
+
+	if c.Threshold != nil {
+		if err := c.Threshold.validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Severities) > 0 {
+		if c.Threshold != nil {
+			return fmt.Errorf("condition cannot have both a threshold and severities")
+		}
+		if err := validateSeverities(c.Severities); err != nil {
+			return err
+		}
+	}
+
+	if len(c.ThresholdRules) > 0 {
+		if c.Threshold != nil || len(c.Severities) > 0 {
+			return fmt.Errorf("condition cannot have threshold rules along with a threshold or severities")
+		}
+		if err := validateThresholdRules(c.ThresholdRules); err != nil {
+			return err
+		}
+	}
+
+	if err := c.validateBaseline(); err != nil {
+		return err
+	}
+
+	if err := c.validateComparison(); err != nil {
+		return err
+	}
+
+	if err := c.validateDownsample(); err != nil {
+		return err
+	}
+
+	if c.Reducer != "" {
+		if err := c.Reducer.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Combinator != "" {
+		if err := c.Combinator.validate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := newLabelMatchers(c.LabelMatchers); err != nil {
+		return err
+	}
+
+	if err := validateLabelTemplates(c.LabelTemplates); err != nil {
+		return err
+	}
+
+	if c.MaxDataPoints < 0 {
+		return fmt.Errorf("invalid maxDataPoints: %d is negative", c.MaxDataPoints)
+	}
+
+	if c.Interval < 0 {
+		return fmt.Errorf("invalid interval: %s is negative", c.Interval)
+	}
+
+	if c.NoDataState != "" {
+		if err := c.NoDataState.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.ExecErrState != "" {
+		if err := c.ExecErrState.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.NonFiniteState != "" {
+		if err := c.NonFiniteState.validate(); err != nil {
+			return err
+		}
+	}
+
+	refIDs := make(map[string]struct{}, len(c.QueriesAndExpressions))
+	for i, q := range c.QueriesAndExpressions {
+		if q.RefID == "" {
+			return fmt.Errorf("query or expression %d has no refID", i)
+		}
+		if _, ok := refIDs[q.RefID]; ok {
+			return fmt.Errorf("refID %q is used by more than one query or expression", q.RefID)
+		}
+		refIDs[q.RefID] = struct{}{}
+	}
+	for _, refID := range c.refIDs() {
+		if _, ok := refIDs[refID]; !ok {
+			return fmt.Errorf("condition refID %q does not match any query or expression", refID)
+		}
+	}
+
+	if c.RejectMixedQueryTypes {
+		if err := c.validateQueryTypes(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateQueryTypes checks that the queries of each datasource have the same query type.
+// Queries without a query type use the default one of their datasource and match any.
+// Expressions are skipped.
+func (c Condition) validateQueryTypes() error {
+	typedQueries := make([]*AlertQuery, 0, len(c.QueriesAndExpressions))
+	queryTypes := make(map[string]struct{}, len(c.QueriesAndExpressions))
+	for i := range c.QueriesAndExpressions {
+		if q := &c.QueriesAndExpressions[i]; q.QueryType != "" {
+			typedQueries = append(typedQueries, q)
+			queryTypes[q.QueryType] = struct{}{}
+		}
+	}
+	// the datasources are only needed if there's more than one query type
+	if len(queryTypes) < 2 {
+		return nil
+	}
+
+	datasourceQueries := make(map[int64]*AlertQuery, len(typedQueries))
+	for _, q := range typedQueries {
+		isExpression, err := q.IsExpression()
+		if err != nil {
+			return fmt.Errorf("failed to get the datasource of refID %s: %w", q.RefID, err)
+		}
+		if isExpression {
+			continue
+		}
+
+		other, ok := datasourceQueries[q.DatasourceID]
+		if !ok {
+			datasourceQueries[q.DatasourceID] = q
+			continue
+		}
+		if other.QueryType != q.QueryType {
+			return fmt.Errorf("refIDs %s and %s of the same datasource have different query types %q and %q", other.RefID, q.RefID, other.QueryType, q.QueryType)
+		}
+	}
+	return nil
+}
+
+// maxStringQueries is the maximum number of queries and expressions listed by Condition.String.
+const maxStringQueries = 10
+
+// String summarizes the evaluated RefIDs and the RefID and datasource of the queries and expressions,
+// e.g. "refIds=[C] queries=[A(prom) B(loki) C(__expr__)]", listing at most maxStringQueries of them.
+func (c Condition) String() string {
+	n := len(c.QueriesAndExpressions)
+	if n > maxStringQueries {
+		n = maxStringQueries
+	}
+
+	queries := make([]string, 0, n+1)
+	for _, q := range c.QueriesAndExpressions[:n] {
+		var model struct {
+			Datasource string `json:"datasource"`
+		}
+		// the model isn't validated yet, so an invalid model just has no datasource
+		_ = json.Unmarshal(q.Model, &model)
+		queries = append(queries, fmt.Sprintf("%s(%s)", q.RefID, model.Datasource))
+	}
+	if more := len(c.QueriesAndExpressions) - n; more > 0 {
+		queries = append(queries, fmt.Sprintf("... %d more", more))
+	}
+	return fmt.Sprintf("refIds=[%s] queries=[%s]", strings.Join(c.refIDs(), " "), strings.Join(queries, " "))
+}
+
+// refIDs returns the RefIDs of the queries or expressions that will be evaluated.
+func (c Condition) refIDs() []string {
+	if len(c.RefIDs) != 0 {
+		return c.RefIDs
+	}
+	return []string{c.RefID}
+}
+
+// Simplify detects whether the condition is a single datasource query evaluated by its RefID,
+// in which case Execute queries the datasource directly instead of building the expression
+// pipeline, unless a TransformClient is set. The datasource frames are then evaluated as returned
+// by the datasource. It returns true if the condition is simplified.
+// Simplify should be called again if the queries and expressions change.
+func (c *Condition) Simplify() bool {
+	c.simplified = false
+	if len(c.QueriesAndExpressions) != 1 || len(c.RefIDs) > 1 {
+		return false
+	}
+
+	q := &c.QueriesAndExpressions[0]
+	if q.RefID != c.refIDs()[0] {
+		return false
+	}
+	isExpression, err := q.IsExpression()
+	if err != nil || isExpression {
+		return false
+	}
+	// hidden queries are excluded from the results of the expression pipeline
+	if hide, _ := q.modelProps["hide"].(bool); hide {
+		return false
+	}
+
+	c.simplified = true
+	return true
+}
+
+// queryDatasource executes the single datasource query of a simplified condition
+// the same way the expression pipeline does, without building it.
+func (c *Condition) queryDatasource(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	q := &c.QueriesAndExpressions[0]
+	orgID, ok := q.modelProps["orgId"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("no orgId in datasource query for refId %v", q.RefID)
+	}
+
+	req.PluginContext.OrgID = int64(orgID)
+	req.PluginContext.DataSourceInstanceSettings = &backend.DataSourceInstanceSettings{
+		ID: q.DatasourceID,
+	}
+	return expr.QueryData(ctx, req)
+}
+
+// RequiredDatasources returns the IDs of the datasources queried by the condition, in the order
+// they're first queried, so that the caller can check that they can be accessed before executing it.
+// Expressions don't query a datasource of their own and are skipped.
+func (c *Condition) RequiredDatasources() ([]int64, error) {
+	ids := make([]int64, 0, len(c.QueriesAndExpressions))
+	seen := make(map[int64]struct{}, len(c.QueriesAndExpressions))
+	for i := range c.QueriesAndExpressions {
+		q := &c.QueriesAndExpressions[i]
+		isExpression, err := q.IsExpression()
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to get the datasource of refID %s: %s", ErrInvalidCondition, q.RefID, err)
+		}
+		if isExpression {
+			continue
+		}
+		if _, ok := seen[q.DatasourceID]; ok {
+			continue
+		}
+		seen[q.DatasourceID] = struct{}{}
+		ids = append(ids, q.DatasourceID)
+	}
+	return ids, nil
+}
+
+// QueryHash returns a hash of the evaluated RefIDs and of the queries and expressions,
+// which changes only if they materially change: the keys of the query models are sorted
+// so that their order doesn't matter.
+func (c Condition) QueryHash() string {
+	type normalizedQuery struct {
+		RefID             string            `json:"refId"`
+		QueryType         string            `json:"queryType"`
+		RelativeTimeRange RelativeTimeRange `json:"relativeTimeRange"`
+		Model             interface{}       `json:"model"`
+	}
+
+	queries := make([]normalizedQuery, 0, len(c.QueriesAndExpressions))
+	for _, q := range c.QueriesAndExpressions {
+		var model interface{} = q.Model
+		var decoded interface{}
+		// maps are marshaled with sorted keys
+		if err := json.Unmarshal(q.Model, &decoded); err == nil {
+			model = decoded
+		}
+		queries = append(queries, normalizedQuery{
+			RefID:             q.RefID,
+			QueryType:         q.QueryType,
+			RelativeTimeRange: q.RelativeTimeRange,
+			Model:             model,
+		})
+	}
+
+	h := sha256.New()
+	// json.Encoder only fails on unsupported values, which decoded JSON cannot contain
+	_ = json.NewEncoder(h).Encode(struct {
+		RefIDs  []string          `json:"refIds"`
+		Queries []normalizedQuery `json:"queries"`
+	}{c.refIDs(), queries})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Clock provides the current time.
+// It's satisfied by clock.Clock so that tests can use clock.NewMock.
+type Clock interface {
+	Now() time.Time
+}
+
+// TransformClient executes the queries and expressions of a condition.
+// Tests can provide one returning canned responses instead of querying datasources.
+type TransformClient interface {
+	TransformData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error)
+}
+
+// TransformFunc is an adapter to use a function, such as expr.TransformData, as a TransformClient.
+type TransformFunc func(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error)
+
+// TransformData calls f(ctx, req).
+func (f TransformFunc) TransformData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	return f(ctx, req)
 }
 
 // AlertExecCtx is the context provided for executing an alert condition.
@@ -88,37 +662,183 @@ type AlertExecCtx struct {
 	AlertDefitionID int64
 	SignedInUser    *models.SignedInUser
 
+	// Timeout is the maximum duration of the condition execution.
+	// If it's not set, defaultEvaluationTimeout is used.
+	Timeout time.Duration
+
+	// Metrics records the duration of the condition execution, if set.
+	Metrics *Metrics
+
+	// Clock provides the time of the condition execution.
+	// If it's not set, the wall clock is used.
+	Clock Clock
+
+	// TransformClient executes the condition queries and expressions.
+	// If it's not set, expr.TransformData is used. If it holds a nil value, only simplified
+	// conditions can be executed, and others fail with ErrTransformUnavailable.
+	TransformClient TransformClient
+
+	// BatchConcurrency is the maximum number of conditions executed concurrently by EvaluateBatch.
+	// If it's not set, defaultBatchConcurrency is used.
+	BatchConcurrency int
+
+	// Cache stores the results of successful condition executions, if set,
+	// unless the condition disables caching.
+	Cache ExecutionResultsCache
+
+	// IncludeIntermediateResults includes the frames of the queries and expressions that aren't evaluated
+	// in the ExecutionResults, for debugging. The results of such executions aren't cached.
+	IncludeIntermediateResults bool
+
+	// MaxFrames is the maximum number of frames returned for each evaluated RefID.
+	// If it's not set, defaultMaxFrames is used.
+	MaxFrames int
+
 	Ctx context.Context
 }
 
+// now returns the current time of the execution clock.
+func (ctx AlertExecCtx) now() time.Time {
+	if ctx.Clock == nil {
+		return clock.New().Now()
+	}
+	return ctx.Clock.Now()
+}
+
+// maxFrames returns the maximum number of frames returned for each evaluated RefID.
+func (ctx AlertExecCtx) maxFrames() int {
+	if ctx.MaxFrames <= 0 {
+		return defaultMaxFrames
+	}
+	return ctx.MaxFrames
+}
+
+// pluginContext returns the plugin context of the org and user evaluating the condition.
+func (ctx AlertExecCtx) pluginContext() backend.PluginContext {
+	if ctx.SignedInUser == nil {
+		return backend.PluginContext{}
+	}
+	return backend.PluginContext{
+		OrgID: ctx.SignedInUser.OrgId,
+		User:  wrapper.BackendUserFromSignedInUser(ctx.SignedInUser),
+	}
+}
+
+// transformClient returns the client executing the condition queries and expressions.
+func (ctx AlertExecCtx) transformClient() TransformClient {
+	if ctx.TransformClient == nil {
+		return TransformFunc(expr.TransformData)
+	}
+	if isNilTransformClient(ctx.TransformClient) {
+		return nil
+	}
+	return ctx.TransformClient
+}
+
+// isNilTransformClient returns true if the TransformClient holds a nil value, such as a nil TransformFunc
+// or a nil pointer, whose TransformData would panic.
+func isNilTransformClient(client TransformClient) bool {
+	v := reflect.ValueOf(client)
+	switch v.Kind() {
+	case reflect.Func, reflect.Ptr, reflect.Map, reflect.Interface, reflect.Chan, reflect.Slice:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
 // Execute runs the Condition's expressions or queries.
+// If fromStr or toStr are set (e.g. "now-5m" and "now"), they override the time range of every query,
+// otherwise each query uses its own relative time range.
+// If the execution fails or has no results, the error is also set in the returned ExecutionResults
+// so that they can still be evaluated according to the ExecErrState or NoDataState.
 func (c *Condition) Execute(ctx AlertExecCtx, fromStr, toStr string) (*ExecutionResults, error) {
-	result := ExecutionResults{}
-	if !c.IsValid() {
-		return nil, fmt.Errorf("invalid conditions")
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCondition, err)
+	}
+
+	evaluatedAt := ctx.now()
+	timeRange, err := parseTimeRange(fromStr, toStr, evaluatedAt)
+	if err != nil {
+		return nil, err
 	}
+	return c.execute(ctx, evaluatedAt, timeRange, relativeTimeRangeKey(fromStr, toStr))
+}
+
+// ExecuteAt runs the Condition's expressions or queries as if it was executed at the given time,
+// with the time range of every query set to the window ending then, so that alert states can be
+// replayed over a past period. The returned ExecutionResults are evaluated at that time.
+func (c *Condition) ExecuteAt(ctx AlertExecCtx, at time.Time, window time.Duration) (*ExecutionResults, error) {
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCondition, err)
+	}
+
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid time range: window %s is not positive", window)
+	}
+	timeRange := &backend.TimeRange{From: at.Add(-window), To: at}
+	return c.execute(ctx, at, timeRange, absoluteTimeRangeKey(*timeRange))
+}
 
+// execute runs the Condition's expressions or queries at the evaluation time.
+// If the time range is set, it overrides the relative time range of every query.
+// The time range key identifies the time range in the cache key of the execution, see executionCacheKey.
+// The execution is traced, along with the transform and the decoding of its results.
+func (c *Condition) execute(ctx AlertExecCtx, evaluatedAt time.Time, timeRange *backend.TimeRange, timeRangeKey string) (res *ExecutionResults, err error) {
+	span, spanCtx := opentracing.StartSpanFromContext(ctx.Ctx, "ngalert.condition.execute")
+	span.SetTag("alertDefinitionId", ctx.AlertDefitionID)
+	span.SetTag("refIdCount", len(c.refIDs()))
+	defer func() {
+		span.SetTag("outcome", executionOutcome(err))
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(tlog.Error(err))
+		}
+		span.Finish()
+	}()
+
+	result := ExecutionResults{EvaluatedAt: evaluatedAt, metrics: ctx.Metrics}
 	queryDataReq := &backend.QueryDataRequest{
-		PluginContext: backend.PluginContext{
-			// TODO: Things probably
-		},
-		Queries: []backend.DataQuery{},
+		PluginContext: ctx.pluginContext(),
+		Queries:       []backend.DataQuery{},
 	}
 
 	for i := range c.QueriesAndExpressions {
 		q := c.QueriesAndExpressions[i]
 		model, err := q.getModel()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get query model: %w", err)
+			return nil, fmt.Errorf("%w: failed to get query model: %s", ErrInvalidCondition, err)
 		}
 		interval, err := q.getIntervalDuration()
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve intervalMs from the model: %w", err)
+			return nil, fmt.Errorf("%w: failed to retrieve intervalMs from the model: %s", ErrInvalidCondition, err)
 		}
 
 		maxDatapoints, err := q.getMaxDatapoints()
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve maxDatapoints from the model: %w", err)
+			return nil, fmt.Errorf("%w: failed to retrieve maxDatapoints from the model: %s", ErrInvalidCondition, err)
+		}
+
+		if c.MaxDataPoints > 0 || c.Interval > 0 {
+			if c.MaxDataPoints > 0 {
+				maxDatapoints = c.MaxDataPoints
+			}
+			if c.Interval > 0 {
+				interval = time.Duration(c.Interval)
+			}
+			model, err = withSampling(model, maxDatapoints, interval)
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to override the sampling of the model: %s", ErrInvalidCondition, err)
+			}
+		}
+
+		queryTimeRange := q.RelativeTimeRange.toTimeRange(result.EvaluatedAt)
+		if timeRange != nil {
+			queryTimeRange = *timeRange
+		}
+		// expressions don't query data of their own time range
+		if isExpression, _ := q.IsExpression(); !isExpression {
+			result.TimeRange = widenTimeRange(result.TimeRange, queryTimeRange)
 		}
 
 		queryDataReq.Queries = append(queryDataReq.Queries, backend.DataQuery{
@@ -127,81 +847,596 @@ func (c *Condition) Execute(ctx AlertExecCtx, fromStr, toStr string) (*Execution
 			RefID:         q.RefID,
 			MaxDataPoints: maxDatapoints,
 			QueryType:     q.QueryType,
-			TimeRange:     q.RelativeTimeRange.toTimeRange(time.Now()),
+			TimeRange:     queryTimeRange,
 		})
 	}
 
-	pbRes, err := expr.TransformData(ctx.Ctx, queryDataReq)
-	if err != nil {
-		return &result, err
+	var cacheKey string
+	if ctx.Cache != nil && !c.DisableCache && !ctx.IncludeIntermediateResults {
+		cacheKey = executionCacheKey(c, ctx.SignedInUser, queryDataReq, timeRangeKey)
+		if cached, ok := ctx.Cache.Get(cacheKey); ok {
+			ctx.Metrics.observeCacheHit()
+			span.SetTag("cached", true)
+			// the cached frames are reused for this execution, which is evaluated at its own time
+			res := *cached
+			res.EvaluatedAt = result.EvaluatedAt
+			res.TimeRange = result.TimeRange
+			res.metrics = ctx.Metrics
+			return &res, nil
+		}
+		ctx.Metrics.observeCacheMiss()
 	}
 
-	for refID, res := range pbRes.Responses {
-		if refID != c.RefID {
-			continue
+	start := time.Now()
+	defer func() {
+		// labeling the duration looks up the datasources, which is only needed if it's recorded
+		if ctx.Metrics != nil {
+			ctx.Metrics.observeDuration(ctx.Metrics.datasourceLabel(c, queryDataReq.PluginContext.OrgID), time.Since(start))
 		}
-		result.Results = res.Frames
+	}()
+
+	timeout := ctx.Timeout
+	if timeout <= 0 {
+		timeout = defaultEvaluationTimeout
 	}
+	execCtx, cancelFn := context.WithTimeout(spanCtx, timeout)
+	defer cancelFn()
 
-	if len(result.Results) == 0 {
-		err = fmt.Errorf("no GEL results")
+	// simplified conditions query their datasource directly, which doesn't need the transform
+	transformClient := ctx.transformClient()
+	if c.simplified && (ctx.TransformClient == nil || transformClient == nil) {
+		transformClient = TransformFunc(c.queryDatasource)
+	}
+	if transformClient == nil {
+		err = ErrTransformUnavailable
+		result.Error = err
+		return &result, err
+	}
+
+	pbRes, err := c.transform(ctx, execCtx, transformClient, queryDataReq, timeout)
+	if err != nil {
 		result.Error = err
 		return &result, err
 	}
 
+	// the comparison window is queried within the same timeout
+	var comparisonRes *backend.QueryDataResponse
+	if c.ComparisonOffset > 0 {
+		comparisonRes, err = c.transform(ctx, execCtx, transformClient, comparisonRequest(queryDataReq, time.Duration(c.ComparisonOffset)), timeout)
+		if err != nil {
+			err = fmt.Errorf("comparison window: %w", err)
+			result.Error = err
+			return &result, err
+		}
+	}
+
+	decodeSpan, _ := opentracing.StartSpanFromContext(spanCtx, "ngalert.condition.decode")
+	defer decodeSpan.Finish()
+
+	refIDs := c.refIDs()
+	if ctx.IncludeIntermediateResults {
+		result.IntermediateResults = intermediateResults(pbRes, refIDs)
+	}
+
+	result.ErrorsByRefID = responseErrors(pbRes)
+	result.ResultsByRefID = make(map[string]data.Frames, len(refIDs))
+	for _, refID := range refIDs {
+		if resErr, ok := result.ErrorsByRefID[refID]; ok {
+			err = &queryError{refID: refID, err: resErr}
+			result.Error = err
+			return &result, err
+		}
+		res, ok := pbRes.Responses[refID]
+		if !ok || len(res.Frames) == 0 {
+			err = fmt.Errorf("%w for refID %s", ErrNoResults, refID)
+			result.Error = err
+			return &result, err
+		}
+		if maxFrames := ctx.maxFrames(); len(res.Frames) > maxFrames {
+			err = fmt.Errorf("%w for refID %s: %d frames instead of at most %d", ErrTooManyFrames, refID, len(res.Frames), maxFrames)
+			result.Error = err
+			return &result, err
+		}
+		result.ResultsByRefID[refID] = res.Frames
+	}
+	result.Results = result.ResultsByRefID[refIDs[0]]
+
+	if comparisonRes != nil {
+		result.ComparisonResultsByRefID = make(map[string]data.Frames, len(refIDs))
+		for _, refID := range refIDs {
+			res := comparisonRes.Responses[refID]
+			if res.Error != nil {
+				err = fmt.Errorf("comparison window: %w", &queryError{refID: refID, err: res.Error})
+				result.Error = err
+				return &result, err
+			}
+			// alert instances without data in the comparison window evaluate to the NoDataState
+			if maxFrames := ctx.maxFrames(); len(res.Frames) > maxFrames {
+				err = fmt.Errorf("%w for refID %s in the comparison window: %d frames instead of at most %d", ErrTooManyFrames, refID, len(res.Frames), maxFrames)
+				result.Error = err
+				return &result, err
+			}
+			result.ComparisonResultsByRefID[refID] = res.Frames
+		}
+	}
+
+	if cacheKey != "" {
+		cached := result
+		ctx.Cache.Set(cacheKey, &cached)
+	}
 	return &result, nil
 }
 
-// EvaluateExecutionResult takes the ExecutionResult, and returns a frame where
+// transform executes the queries and expressions of the request with the transform client.
+// Failures, including the execution context timing out, are transform errors.
+func (c *Condition) transform(ctx AlertExecCtx, execCtx context.Context, client TransformClient, req *backend.QueryDataRequest, timeout time.Duration) (*backend.QueryDataResponse, error) {
+	transformSpan, transformCtx := opentracing.StartSpanFromContext(execCtx, "ngalert.condition.transform")
+	res, err := client.TransformData(transformCtx, req)
+	transformSpan.Finish()
+	if err == nil && res == nil {
+		err = errors.New("no response")
+	}
+	if err != nil {
+		if errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+			// the responses of the queries and expressions aren't received separately,
+			// so that the ones still pending at the deadline aren't known
+			refIDs := make([]string, 0, len(req.Queries))
+			for _, q := range req.Queries {
+				refIDs = append(refIDs, q.RefID)
+			}
+			return nil, &transformError{
+				reason: fmt.Sprintf("execution of alert definition %d (refIDs %s) did not complete within %s", ctx.AlertDefitionID, strings.Join(refIDs, ","), timeout),
+				err:    execCtx.Err(),
+			}
+		}
+		return nil, &transformError{err: err}
+	}
+	return res, nil
+}
+
+// intermediateResults returns the frames of the responses for other RefIDs than the evaluated ones.
+func intermediateResults(res *backend.QueryDataResponse, evaluated []string) map[string]data.Frames {
+	intermediate := make(map[string]data.Frames, len(res.Responses))
+	for refID, r := range res.Responses {
+		intermediate[refID] = r.Frames
+	}
+	for _, refID := range evaluated {
+		delete(intermediate, refID)
+	}
+	return intermediate
+}
+
+// responseErrors returns the errors of the responses by refID, or nil if none failed.
+func responseErrors(res *backend.QueryDataResponse) map[string]error {
+	var errs map[string]error
+	for refID, r := range res.Responses {
+		if r.Error == nil {
+			continue
+		}
+		if errs == nil {
+			errs = make(map[string]error)
+		}
+		errs[refID] = r.Error
+	}
+	return errs
+}
+
+// widenTimeRange returns the smallest time range including both time ranges.
+// A zero time range is empty.
+func widenTimeRange(tr, other backend.TimeRange) backend.TimeRange {
+	if tr == (backend.TimeRange{}) {
+		return other
+	}
+	if other.From.Before(tr.From) {
+		tr.From = other.From
+	}
+	if other.To.After(tr.To) {
+		tr.To = other.To
+	}
+	return tr
+}
+
+// executionOutcome returns the outcome of a condition execution to trace given its error.
+func executionOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrInvalidCondition):
+		return "invalid"
+	case errors.Is(err, ErrNoResults):
+		return "no_data"
+	default:
+		return "error"
+	}
+}
+
+// Preview runs the Condition's expressions or queries and evaluates their results without side effects.
+// It returns the unevaluated results along with their evaluation so that both can be displayed.
+// Failed executions and results without data are evaluated according to the ExecErrState and NoDataState.
+func (c *Condition) Preview(ctx AlertExecCtx, fromStr, toStr string) (*ExecutionResults, Results, error) {
+	execResults, err := c.Execute(ctx, fromStr, toStr)
+	if err != nil && execResults == nil {
+		return nil, nil, err
+	}
+
+	evalResults, err := EvaluateExecutionResult(c, execResults, StrictEvaluation)
+	if err != nil {
+		return execResults, nil, err
+	}
+	return execResults, evalResults, nil
+}
+
+// EvaluateExecutionResult takes the ExecutionResult of the condition, and returns a frame where
 // each column is a string type that holds a string representing its state.
-func EvaluateExecutionResult(results *ExecutionResults) (Results, error) {
+// The labels of each alert instance include the RefID it was evaluated for under the RefIDLabel.
+// Alert instances without data, and executions without results, evaluate to the state of the NoDataState.
+// Failed executions evaluate to the state of the ExecErrState.
+// The mode selects whether a frame that cannot be evaluated fails the evaluation or is an Error alert instance.
+// The state of each alert instance is recorded by the Metrics of the execution, if any.
+func EvaluateExecutionResult(c *Condition, results *ExecutionResults, mode EvaluationMode) (Results, error) {
+	evalResults, err := evaluateExecutionResult(c, results, mode)
+	if err != nil {
+		return nil, err
+	}
+	results.metrics.ObserveResults(evalResults)
+	return evalResults, nil
+}
+
+// evaluateExecutionResult evaluates the ExecutionResults of the condition, see EvaluateExecutionResult.
+func evaluateExecutionResult(c *Condition, results *ExecutionResults, mode EvaluationMode) (Results, error) {
 	evalResults := make([]result, 0)
-	labels := make(map[string]bool)
-	for _, f := range results.Results {
-		rowLen, err := f.RowLen()
+	if results.Error != nil {
+		state := c.ExecErrState.state()
+		if errors.Is(results.Error, ErrNoResults) {
+			state = c.NoDataState.state()
+		}
+		evalResults = append(evalResults, result{
+			State:       state,
+			EvaluatedAt: results.EvaluatedAt,
+			TimeRange:   results.TimeRange,
+		})
+		return evalResults, nil
+	}
+
+	matchers, err := newLabelMatchers(c.LabelMatchers)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.RefIDs) == 0 {
+		cc, err := c.withComparison(results.ComparisonResultsByRefID[c.RefID], mode, matchers)
 		if err != nil {
-			return nil, &invalidEvalResultFormatError{refID: f.RefID, reason: "unable to get frame row length", err: err}
+			return nil, err
 		}
-		if rowLen > 1 {
-			return nil, &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("unexpected row length: %d instead of 1", rowLen)}
+		evalResults, err := cc.evaluateFrames(results.Results, mode, matchers)
+		if err != nil {
+			return nil, err
+		}
+		for i := range evalResults {
+			evalResults[i].Instance = withLabel(evalResults[i].Instance, RefIDLabel, c.RefID)
+		}
+		evalResults, err = c.applyLabelTemplates(evalResults, mode)
+		if err != nil {
+			return nil, err
 		}
+		return evalResults.withExecution(results), nil
+	}
 
-		if len(f.Fields) > 1 {
-			return nil, &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("unexpected field length: %d instead of 1", len(f.Fields))}
+	refResults := make([]Results, 0, len(c.RefIDs))
+	for _, refID := range c.RefIDs {
+		cc, err := c.withComparison(results.ComparisonResultsByRefID[refID], mode, matchers)
+		if err != nil {
+			return nil, err
+		}
+		r, err := cc.evaluateFrames(results.ResultsByRefID[refID], mode, matchers)
+		if err != nil {
+			return nil, err
 		}
+		refResults = append(refResults, r)
+	}
+	combined, err := c.applyLabelTemplates(c.Combinator.combine(c.RefIDs, refResults, c.severityRank), mode)
+	if err != nil {
+		return nil, err
+	}
+	return combined.withExecution(results), nil
+}
+
+// withExecution sets the evaluation time and time range of each result to those of the execution.
+func (evalResults Results) withExecution(results *ExecutionResults) Results {
+	for i := range evalResults {
+		evalResults[i].EvaluatedAt = results.EvaluatedAt
+		evalResults[i].TimeRange = results.TimeRange
+	}
+	return evalResults
+}
 
-		if f.Fields[0].Type() != data.FieldTypeNullableFloat64 {
-			return nil, &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("invalid field type: %d", f.Fields[0].Type())}
+// evaluateFrames evaluates the state of the alert instances of each frame,
+// dropping the alert instances whose labels don't match the label matchers.
+// In LenientEvaluation mode, frames that cannot be evaluated are Error alert instances,
+// and alert instances that cannot uniquely be identified by their labels are in Error.
+func (c *Condition) evaluateFrames(frames data.Frames, mode EvaluationMode, matchers labelMatchers) (Results, error) {
+	evalResults := make([]result, 0)
+	labels := make(map[string]int)
+	for _, f := range frames {
+		frameResults, err := c.evaluateFrame(f)
+		if err != nil {
+			if mode != LenientEvaluation {
+				return nil, err
+			}
+			frameResults = []result{{Instance: frameLabels(f), State: Error, Error: err}}
 		}
 
-		labelsStr := f.Fields[0].Labels.String()
-		_, ok := labels[labelsStr]
-		if ok {
-			return nil, &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("frame cannot uniquely be identified by its labels: %s", labelsStr)}
+		for _, r := range frameResults {
+			if !matchers.matches(r.Instance) {
+				continue
+			}
+
+			key := instanceKey(r.Instance)
+			if i, ok := labels[key]; ok {
+				err := &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("frame cannot uniquely be identified by its labels: %s", r.Instance.String())}
+				if mode != LenientEvaluation {
+					return nil, err
+				}
+				evalResults[i] = result{Instance: r.Instance, State: Error, Error: err}
+				continue
+			}
+			labels[key] = len(evalResults)
+
+			evalResults = append(evalResults, r)
 		}
-		labels[labelsStr] = true
+	}
+	return evalResults, nil
+}
 
-		state := Normal
-		val, err := f.Fields[0].FloatAt(0)
-		if err != nil || val != 0 {
-			state = Alerting
+// frameLabels returns the labels of the first field of the frame, if any.
+func frameLabels(f *data.Frame) data.Labels {
+	if len(f.Fields) == 0 {
+		return nil
+	}
+	return f.Fields[0].Labels
+}
+
+// evaluateFrame evaluates the state of the alert instances of a single frame:
+// the alert instance of its value field, or of each numeric value field of a wide frame,
+// identified by the name of its field under the FieldNameLabel along with its labels.
+// With ThresholdRules, each value evaluates to the alert instances of the rules it matches.
+// With comparison values, the thresholds are applied to the ratio of each value to its comparison value.
+func (c *Condition) evaluateFrame(f *data.Frame) ([]result, error) {
+	rowLen, err := f.RowLen()
+	if err != nil {
+		return nil, &invalidEvalResultFormatError{refID: f.RefID, reason: "unable to get frame row length", err: err}
+	}
+	if rowLen == 0 {
+		return []result{{Instance: frameLabels(f), State: c.NoDataState.state()}}, nil
+	}
+
+	fields, wide, err := c.valueFields(f, rowLen)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]result, 0, len(fields))
+	for _, field := range fields {
+		r, err := c.evaluateField(f, field)
+		if err != nil {
+			return nil, err
+		}
+		r.Annotations = fieldAnnotations(field)
+		if wide {
+			r.Instance = withLabel(r.Instance, FieldNameLabel, field.Name)
+		}
+		if r.Value != nil && isFinite(*r.Value) {
+			if c.comparisonValues != nil {
+				results = append(results, c.applyComparison(r)...)
+				continue
+			}
+			if len(c.ThresholdRules) > 0 {
+				results = append(results, c.applyThresholdRules(r, c.comparedValue(*r.Value))...)
+				continue
+			}
 		}
+		results = append(results, r)
+	}
+	return results, nil
+}
 
-		evalResults = append(evalResults, result{
-			Instance: f.Fields[0].Labels,
-			State:    state,
-		})
+// evaluateField evaluates the state of the alert instance of the value field of a frame.
+func (c *Condition) evaluateField(f *data.Frame, field *data.Field) (result, error) {
+	if c.Reducer == "" && isStatusField(field) {
+		return c.evaluateStatus(field), nil
 	}
-	return evalResults, nil
+
+	// integer values are converted to float64 by FloatAt
+	if !field.Type().Numeric() {
+		return result{}, &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("invalid field type: %s is not numeric", field.Type())}
+	}
+
+	if c.Reducer != "" {
+		reduced := field
+		if c.Downsample > 0 {
+			var err error
+			if reduced, err = downsample(field, c.Downsample, c.Reducer); err != nil {
+				return result{}, &invalidEvalResultFormatError{refID: f.RefID, reason: "unable to downsample field", err: err}
+			}
+		}
+		val, ok, err := c.Reducer.reduce(reduced)
+		if err != nil {
+			return result{}, &invalidEvalResultFormatError{refID: f.RefID, reason: "unable to reduce field", err: err}
+		}
+		if !ok {
+			return result{Instance: field.Labels, State: c.NoDataState.state()}, nil
+		}
+		return c.evaluateValue(field.Labels, val), nil
+	}
+
+	// a null value isn't a zero value, it's no value
+	if _, ok := field.ConcreteAt(0); !ok {
+		return result{Instance: field.Labels, State: c.NoDataState.state()}, nil
+	}
+	val, err := field.FloatAt(0)
+	if err != nil {
+		return result{}, &invalidEvalResultFormatError{refID: f.RefID, reason: "unable to get the value of the field", err: err}
+	}
+	return c.evaluateValue(field.Labels, val), nil
+}
+
+// evaluateValue evaluates the state of the alert instance of a numeric value
+// according to the Severities, if any, or else the Threshold, compared to the Baseline if set.
+// With ThresholdRules or comparison values it's Normal until they're applied by evaluateFrame.
+// NaN and infinite values evaluate to the state of the NonFiniteState instead.
+func (c *Condition) evaluateValue(labels data.Labels, val float64) result {
+	r := result{Instance: labels, State: Normal, Value: &val}
+	if !isFinite(val) {
+		r.State = c.NonFiniteState.state()
+		if r.State == Error {
+			r.Error = fmt.Errorf("non-finite value: %v", val)
+		}
+		return r
+	}
+	if len(c.ThresholdRules) > 0 || c.comparisonValues != nil {
+		return r
+	}
+	return c.applyThreshold(r, c.comparedValue(val))
+}
+
+// applyThreshold evaluates the state of the alert instance by applying the Severities, if any,
+// or else the Threshold to the compared value.
+func (c *Condition) applyThreshold(r result, compared float64) result {
+	if len(c.Severities) > 0 {
+		r.Severity = c.severity(compared)
+		if r.Severity != "" {
+			r.State = Alerting
+		}
+		return r
+	}
+
+	if c.Threshold.isAlerting(compared) {
+		r.State = Alerting
+	}
+	return r
+}
+
+// fieldAnnotations returns the annotations of the alert instance of a field from its config:
+// its "displayName" and "unit", if set.
+func fieldAnnotations(field *data.Field) map[string]string {
+	if field.Config == nil {
+		return nil
+	}
+
+	annotations := make(map[string]string)
+	displayName := field.Config.DisplayNameFromDS
+	if displayName == "" {
+		displayName = field.Config.DisplayName
+	}
+	if displayName != "" {
+		annotations["displayName"] = displayName
+	}
+	if field.Config.Unit != "" {
+		annotations["unit"] = field.Config.Unit
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// isStatusField returns true if the field is a boolean or string field.
+func isStatusField(field *data.Field) bool {
+	switch field.Type() {
+	case data.FieldTypeBool, data.FieldTypeNullableBool, data.FieldTypeString, data.FieldTypeNullableString:
+		return true
+	default:
+		return false
+	}
+}
+
+// evaluateStatus evaluates the state of the alert instance of a boolean or string field with a single row.
+// True values and the AlertingStrings are alerting, and null values are evaluated according to the NoDataState.
+func (c *Condition) evaluateStatus(field *data.Field) result {
+	r := result{Instance: field.Labels, State: Normal}
+	v, ok := field.ConcreteAt(0)
+	if !ok {
+		r.State = c.NoDataState.state()
+		return r
+	}
+
+	switch v := v.(type) {
+	case bool:
+		if v {
+			r.State = Alerting
+		}
+	case string:
+		for _, s := range c.AlertingStrings {
+			if v == s {
+				r.State = Alerting
+				break
+			}
+		}
+	}
+	return r
+}
+
+// valueFields returns the fields of the frame holding the values to evaluate,
+// and whether the frame is a wide frame with more than one value field.
+// Without a reducer, the frame should have a single row. Time fields are ignored, unless
+// the frame has a single field, and only the numeric value fields of a wide frame are evaluated.
+func (c *Condition) valueFields(f *data.Frame, rowLen int) ([]*data.Field, bool, error) {
+	if c.Reducer == "" && rowLen > 1 {
+		return nil, false, &invalidEvalResultFormatError{refID: f.RefID, reason: fmt.Sprintf("unexpected row length: %d instead of 1", rowLen)}
+	}
+	if len(f.Fields) == 1 {
+		return f.Fields, false, nil
+	}
+
+	valueFields := make([]*data.Field, 0, len(f.Fields))
+	for _, field := range f.Fields {
+		if !field.Type().Time() {
+			valueFields = append(valueFields, field)
+		}
+	}
+	switch len(valueFields) {
+	case 0:
+		return nil, false, &invalidEvalResultFormatError{refID: f.RefID, reason: "no value field found"}
+	case 1:
+		return valueFields, false, nil
+	}
+
+	numericFields := make([]*data.Field, 0, len(valueFields))
+	for _, field := range valueFields {
+		if field.Type().Numeric() {
+			numericFields = append(numericFields, field)
+		}
+	}
+	if len(numericFields) == 0 {
+		return nil, false, &invalidEvalResultFormatError{refID: f.RefID, reason: "no numeric value field found"}
+	}
+	return numericFields, true, nil
 }
 
 // AsDataFrame forms the EvalResults in Frame suitable for displaying in the table panel of the front end.
 // This may be temporary, as there might be a fair amount we want to display in the frontend, and it might not make sense to store that in data.Frame.
-// For the first pass, I would expect a Frame with a single row, and a column for each instance with a boolean value.
+// For the first pass, I would expect a Frame with a single row, a column with the evaluation time,
+// and for each instance a column with its state ("Normal", "Alerting", "NoData" or "Error"),
+// a column with a boolean value that is true if it's alerting, and a column with the evaluated value.
+// Instances are ordered by their labels so that the columns are stable across evaluations.
 func (evalResults Results) AsDataFrame() data.Frame {
+	sorted := make(Results, len(evalResults))
+	copy(sorted, evalResults)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return instanceKey(sorted[i].Instance) < instanceKey(sorted[j].Instance)
+	})
+
 	fields := make([]*data.Field, 0)
-	for _, evalResult := range evalResults {
-		fields = append(fields, data.NewField("", evalResult.Instance, []bool{evalResult.State != Normal}))
+	if len(sorted) > 0 {
+		fields = append(fields, data.NewField("Time", nil, []time.Time{sorted[0].EvaluatedAt}))
+	}
+	for _, evalResult := range sorted {
+		fields = append(fields,
+			data.NewField("State", evalResult.Instance, []string{evalResult.State.String()}),
+			data.NewField("Firing", evalResult.Instance, []bool{evalResult.State == Alerting}),
+			data.NewField("Value", evalResult.Instance, []*float64{evalResult.Value}),
+		)
 	}
 	f := data.NewFrame("", fields...)
 	return *f
@@ -0,0 +1,1558 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+)
+
+func nullableFloat(f float64) *float64 {
+	return &f
+}
+
+func TestEvaluateExecutionResult(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		condition      Condition
+		execResults    ExecutionResults
+		expectedStates []state
+	}{
+		{
+			desc: "given a frame with a non-zero value",
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(1)})),
+				},
+			},
+			expectedStates: []state{Alerting},
+		},
+		{
+			desc: "given a frame with a zero value",
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(0)})),
+				},
+			},
+			expectedStates: []state{Normal},
+		},
+		{
+			desc: "given a frame with a null value",
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nil})),
+				},
+			},
+			expectedStates: []state{NoData},
+		},
+		{
+			desc:      "given a frame with a null value and an ok no data state",
+			condition: Condition{NoDataState: NoDataStateOK, Threshold: &Threshold{Operator: LessThan, Value: 5}},
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nil})),
+				},
+			},
+			expectedStates: []state{Normal},
+		},
+		{
+			desc:      "given a frame with a value above the threshold",
+			condition: Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 80}},
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(81)})),
+				},
+			},
+			expectedStates: []state{Alerting},
+		},
+		{
+			desc:      "given a frame with a value below the threshold",
+			condition: Condition{Threshold: &Threshold{Operator: GreaterThan, Value: 80}},
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(80)})),
+				},
+			},
+			expectedStates: []state{Normal},
+		},
+		{
+			desc:      "given a zero value and a less than threshold",
+			condition: Condition{Threshold: &Threshold{Operator: LessThan, Value: 5}},
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(0)})),
+				},
+			},
+			expectedStates: []state{Alerting},
+		},
+		{
+			desc: "given a frame with no rows",
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{})),
+				},
+			},
+			expectedStates: []state{NoData},
+		},
+		{
+			desc:      "given a frame with no rows and an alerting no data state",
+			condition: Condition{NoDataState: NoDataStateAlerting},
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{})),
+				},
+			},
+			expectedStates: []state{Alerting},
+		},
+		{
+			desc:      "given a frame with no rows and an ok no data state",
+			condition: Condition{NoDataState: NoDataStateOK},
+			execResults: ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", nil, []*float64{})),
+				},
+			},
+			expectedStates: []state{Normal},
+		},
+		{
+			desc: "given no results",
+			execResults: ExecutionResults{
+				Error: fmt.Errorf("%w for refID A", ErrNoResults),
+			},
+			expectedStates: []state{NoData},
+		},
+		{
+			desc:      "given no results and an alerting no data state",
+			condition: Condition{NoDataState: NoDataStateAlerting},
+			execResults: ExecutionResults{
+				Error: fmt.Errorf("%w for refID A", ErrNoResults),
+			},
+			expectedStates: []state{Alerting},
+		},
+		{
+			desc: "given an execution error",
+			execResults: ExecutionResults{
+				Error: fmt.Errorf("failed to execute"),
+			},
+			expectedStates: []state{Error},
+		},
+		{
+			desc:      "given an execution error and an alerting execution error state",
+			condition: Condition{ExecErrState: ExecErrStateAlerting},
+			execResults: ExecutionResults{
+				Error: fmt.Errorf("failed to execute"),
+			},
+			expectedStates: []state{Alerting},
+		},
+		{
+			desc:      "given an execution error and an ok execution error state",
+			condition: Condition{ExecErrState: ExecErrStateOK},
+			execResults: ExecutionResults{
+				Error: fmt.Errorf("failed to execute"),
+			},
+			expectedStates: []state{Normal},
+		},
+		{
+			desc:      "given no results and an alerting execution error state",
+			condition: Condition{ExecErrState: ExecErrStateAlerting},
+			execResults: ExecutionResults{
+				Error: fmt.Errorf("%w for refID A", ErrNoResults),
+			},
+			expectedStates: []state{NoData},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			results, err := EvaluateExecutionResult(&tc.condition, &tc.execResults, StrictEvaluation)
+			require.NoError(t, err)
+
+			states := make([]state, 0, len(results))
+			for _, r := range results {
+				states = append(states, r.State)
+			}
+			require.Equal(t, tc.expectedStates, states)
+		})
+	}
+}
+
+func TestStateString(t *testing.T) {
+	require.Equal(t, "Normal", Normal.String())
+	require.Equal(t, "Alerting", Alerting.String())
+	require.Equal(t, "NoData", NoData.String())
+	require.Equal(t, "Error", Error.String())
+}
+
+func TestConditionValidate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		condition   Condition
+		expectedErr string
+	}{
+		{
+			desc: "given a condition referencing an existing query",
+			condition: Condition{
+				RefID:                 "B",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}, {RefID: "B"}},
+			},
+		},
+		{
+			desc:        "given a condition without queries",
+			condition:   Condition{RefID: "A"},
+			expectedErr: "condition must contain at least one query or expression",
+		},
+		{
+			desc: "given a condition referencing a missing query",
+			condition: Condition{
+				RefID:                 "Z",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+			},
+			expectedErr: `condition refID "Z" does not match any query or expression`,
+		},
+		{
+			desc: "given a condition with duplicate query refIDs",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}, {RefID: "B"}, {RefID: "A"}},
+			},
+			expectedErr: `refID "A" is used by more than one query or expression`,
+		},
+		{
+			desc: "given a condition with a query without refID",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}, {RefID: ""}, {RefID: "B"}},
+			},
+			expectedErr: "query or expression 1 has no refID",
+		},
+		{
+			desc: "given a condition with only queries without refID",
+			condition: Condition{
+				QueriesAndExpressions: []AlertQuery{{RefID: ""}},
+			},
+			expectedErr: "query or expression 0 has no refID",
+		},
+		{
+			desc: "given a condition with an invalid threshold operator",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Threshold:             &Threshold{Operator: "gt1"},
+			},
+			expectedErr: `invalid threshold operator: "gt1"`,
+		},
+		{
+			desc: "given a condition with an invalid no data state",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				NoDataState:           "keep_state",
+			},
+			expectedErr: `invalid no data state: "keep_state"`,
+		},
+		{
+			desc: "given a condition with a negative max data points",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				MaxDataPoints:         -1,
+			},
+			expectedErr: "invalid maxDataPoints: -1 is negative",
+		},
+		{
+			desc: "given a condition with an invalid execution error state",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				ExecErrState:          "keep_state",
+			},
+			expectedErr: `invalid execution error state: "keep_state"`,
+		},
+		{
+			desc: "given a condition with mixed query types of the same datasource",
+			condition: Condition{
+				RefID: "A",
+				QueriesAndExpressions: []AlertQuery{
+					{RefID: "A", QueryType: "metrics", Model: json.RawMessage(`{"datasource": "ds", "datasourceId": 1}`)},
+					{RefID: "B", QueryType: "logs", Model: json.RawMessage(`{"datasource": "ds", "datasourceId": 1}`)},
+				},
+				RejectMixedQueryTypes: true,
+			},
+			expectedErr: `refIDs A and B of the same datasource have different query types "metrics" and "logs"`,
+		},
+		{
+			desc: "given an existing condition with mixed query types of the same datasource",
+			condition: Condition{
+				RefID: "A",
+				QueriesAndExpressions: []AlertQuery{
+					{RefID: "A", QueryType: "metrics", Model: json.RawMessage(`{"datasource": "ds", "datasourceId": 1}`)},
+					{RefID: "B", QueryType: "logs", Model: json.RawMessage(`{"datasource": "ds", "datasourceId": 1}`)},
+				},
+			},
+		},
+		{
+			desc: "given a condition with different query types of different datasources",
+			condition: Condition{
+				RefID: "A",
+				QueriesAndExpressions: []AlertQuery{
+					{RefID: "A", QueryType: "metrics", Model: json.RawMessage(`{"datasource": "ds", "datasourceId": 1}`)},
+					{RefID: "B", Model: json.RawMessage(`{"datasource": "ds", "datasourceId": 1}`)},
+					{RefID: "C", QueryType: "logs", Model: json.RawMessage(`{"datasource": "other", "datasourceId": 2}`)},
+					{RefID: "D", QueryType: "math", Model: json.RawMessage(`{"datasource": "__expr__"}`)},
+				},
+				RejectMixedQueryTypes: true,
+			},
+		},
+		{
+			desc: "given a condition with an invalid non-finite state",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				NonFiniteState:        "ok",
+			},
+			expectedErr: `invalid non-finite state: "ok"`,
+		},
+		{
+			desc: "given a condition with an invalid label matcher regular expression",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				LabelMatchers:         []LabelMatcher{{Name: "host", Type: MatchRegexp, Value: "web-("}},
+			},
+			expectedErr: "invalid regular expression of label matcher \"host\": error parsing regexp: missing closing ): `^(?:web-()$`",
+		},
+		{
+			desc: "given a condition with an invalid label matcher type",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				LabelMatchers:         []LabelMatcher{{Name: "host", Type: "~"}},
+			},
+			expectedErr: `invalid label matcher type: "~"`,
+		},
+		{
+			desc: "given a condition with both a threshold and severities",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Threshold:             &Threshold{Operator: GreaterThan, Value: 1},
+				Severities:            []SeverityLevel{{Severity: "warning", Threshold: Threshold{Operator: GreaterThan, Value: 1}}},
+			},
+			expectedErr: "condition cannot have both a threshold and severities",
+		},
+		{
+			desc: "given a condition with both a threshold and threshold rules",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Threshold:             &Threshold{Operator: GreaterThan, Value: 1},
+				ThresholdRules:        []ThresholdRule{{Name: "too_high", Threshold: Threshold{Operator: GreaterThan, Value: 1}}},
+			},
+			expectedErr: "condition cannot have threshold rules along with a threshold or severities",
+		},
+		{
+			desc: "given a condition with duplicate threshold rules",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				ThresholdRules: []ThresholdRule{
+					{Name: "too_high", Threshold: Threshold{Operator: GreaterThan, Value: 1}},
+					{Name: "too_high", Threshold: Threshold{Operator: GreaterThan, Value: 2}},
+				},
+			},
+			expectedErr: `threshold rule name "too_high" is used by more than one threshold rule`,
+		},
+		{
+			desc: "given a condition with duplicate severities",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Severities: []SeverityLevel{
+					{Severity: "warning", Threshold: Threshold{Operator: GreaterThan, Value: 1}},
+					{Severity: "warning", Threshold: Threshold{Operator: GreaterThan, Value: 2}},
+				},
+			},
+			expectedErr: `severity "warning" is used by more than one severity level`,
+		},
+		{
+			desc: "given a condition with a severity without a valid threshold",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Severities:            []SeverityLevel{{Severity: "critical"}},
+			},
+			expectedErr: `severity "critical": invalid threshold operator: ""`,
+		},
+		{
+			desc: "given a condition with a baseline without a baseline comparison",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Baseline:              100,
+			},
+			expectedErr: "condition cannot have a baseline without a baseline comparison",
+		},
+		{
+			desc: "given a condition with a ratio to a zero baseline",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				BaselineComparison:    BaselineRatio,
+			},
+			expectedErr: "invalid baseline: a ratio to a zero baseline is not finite",
+		},
+		{
+			desc: "given a condition with a negative comparison offset",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				ComparisonOffset:      Duration(-24 * time.Hour),
+			},
+			expectedErr: "invalid comparison offset: -24h0m0s is negative",
+		},
+		{
+			desc: "given a condition with both a comparison offset and a baseline comparison",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				ComparisonOffset:      Duration(24 * time.Hour),
+				Baseline:              100,
+				BaselineComparison:    BaselineDifference,
+			},
+			expectedErr: "condition cannot have both a comparison offset and a baseline comparison",
+		},
+		{
+			desc: "given a condition with a label template deriving a reserved label",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				LabelTemplates:        []LabelTemplate{{Name: RefIDLabel, Template: "{{app}}"}},
+			},
+			expectedErr: `label template "__ref_id__": labels starting with "__" are reserved`,
+		},
+		{
+			desc: "given a condition with an unbalanced label template",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				LabelTemplates:        []LabelTemplate{{Name: "service", Template: "{{app}}-{{component"}},
+			},
+			expectedErr: `label template "service": unbalanced label reference in "{{app}}-{{component"`,
+		},
+		{
+			desc: "given a condition downsampling without a reducer",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Downsample:            100,
+			},
+			expectedErr: "condition cannot downsample without a reducer",
+		},
+		{
+			desc: "given a condition downsampling counted values",
+			condition: Condition{
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+				Reducer:               ReduceCount,
+				Downsample:            100,
+			},
+			expectedErr: `condition cannot downsample with reducer "count"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.condition.Validate()
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				require.True(t, tc.condition.IsValid())
+				return
+			}
+			require.EqualError(t, err, tc.expectedErr)
+			require.False(t, tc.condition.IsValid())
+		})
+	}
+}
+
+func TestEvaluateExecutionResultValue(t *testing.T) {
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(42)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{})),
+		},
+	}
+
+	results, err := EvaluateExecutionResult(&Condition{}, &execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, nullableFloat(42), results[0].Value)
+	require.Nil(t, results[1].Value)
+
+	frame := results.AsDataFrame()
+	require.Len(t, frame.Fields, 7)
+	require.Equal(t, "Alerting", frame.Fields[1].At(0))
+	require.Equal(t, true, frame.Fields[2].At(0))
+	require.Equal(t, nullableFloat(42), frame.Fields[3].At(0))
+	require.Equal(t, "NoData", frame.Fields[4].At(0))
+	require.Equal(t, false, frame.Fields[5].At(0))
+	require.Equal(t, data.Labels{"host": "b", RefIDLabel: ""}, frame.Fields[6].Labels)
+	require.Nil(t, frame.Fields[6].At(0))
+}
+
+func TestEvaluateExecutionResultNonFiniteValues(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		nonFiniteState NonFiniteState
+		expectedState  state
+	}{
+		{
+			desc:          "non-finite values are in error by default",
+			expectedState: Error,
+		},
+		{
+			desc:           "non-finite values can have no data",
+			nonFiniteState: NonFiniteStateNoData,
+			expectedState:  NoData,
+		},
+		{
+			desc:           "non-finite values can be alerting",
+			nonFiniteState: NonFiniteStateAlerting,
+			expectedState:  Alerting,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, val := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+				execResults := ExecutionResults{
+					Results: data.Frames{
+						data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(val)})),
+					},
+				}
+
+				c := Condition{NonFiniteState: tc.nonFiniteState, Threshold: &Threshold{Operator: NotEqual, Value: 0}}
+				results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+				require.NoError(t, err)
+				require.Len(t, results, 1)
+				require.Equal(t, tc.expectedState, results[0].State, "value %v", val)
+				if tc.expectedState == Error {
+					require.EqualError(t, results[0].Error, fmt.Sprintf("non-finite value: %v", val))
+				}
+			}
+		})
+	}
+
+	t.Run("non-finite values don't match threshold rules", func(t *testing.T) {
+		execResults := ExecutionResults{
+			Results: data.Frames{
+				data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(math.NaN())})),
+			},
+		}
+
+		c := Condition{ThresholdRules: []ThresholdRule{{Name: "not_zero", Threshold: Threshold{Operator: NotEqual, Value: 0}}}}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, Error, results[0].State)
+		require.NotContains(t, results[0].Instance, ThresholdRuleLabel)
+	})
+}
+
+func TestEvaluateExecutionResultAnnotations(t *testing.T) {
+	field := data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(42)})
+	field.Config = &data.FieldConfig{DisplayName: "CPU usage", Unit: "percent"}
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("", field),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(42)}).SetConfig(&data.FieldConfig{Unit: "percent"})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "c"}, []*float64{nullableFloat(42)})),
+		},
+	}
+
+	results, err := EvaluateExecutionResult(&Condition{}, &execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, map[string]string{"displayName": "CPU usage", "unit": "percent"}, results[0].Annotations)
+	require.Equal(t, map[string]string{"unit": "percent"}, results[1].Annotations)
+	require.Nil(t, results[2].Annotations)
+}
+
+func TestEvaluateExecutionResultWideFrames(t *testing.T) {
+	now := time.Now()
+
+	t.Run("each numeric field of a wide frame is an alert instance", func(t *testing.T) {
+		execResults := ExecutionResults{
+			Results: data.Frames{
+				data.NewFrame("",
+					data.NewField("time", nil, []time.Time{now}),
+					data.NewField("cpu", data.Labels{"host": "a"}, []*float64{nullableFloat(1)}),
+					data.NewField("mem", data.Labels{"host": "a"}, []*float64{nullableFloat(0)}),
+					data.NewField("host", nil, []string{"a"}),
+				),
+			},
+		}
+
+		results, err := EvaluateExecutionResult(&Condition{RefID: "A"}, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, data.Labels{"host": "a", FieldNameLabel: "cpu", RefIDLabel: "A"}, results[0].Instance)
+		require.Equal(t, Alerting, results[0].State)
+		require.Equal(t, data.Labels{"host": "a", FieldNameLabel: "mem", RefIDLabel: "A"}, results[1].Instance)
+		require.Equal(t, Normal, results[1].State)
+	})
+
+	t.Run("multi-row wide frames are reduced field by field", func(t *testing.T) {
+		execResults := ExecutionResults{
+			Results: data.Frames{
+				data.NewFrame("",
+					data.NewField("time", nil, []time.Time{now.Add(-time.Minute), now}),
+					data.NewField("cpu", nil, []float64{90, 70}),
+					data.NewField("mem", nil, []float64{10, 30}),
+				),
+			},
+		}
+
+		c := Condition{Reducer: ReduceMax, Threshold: &Threshold{Operator: GreaterThan, Value: 50}}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, Alerting, results[0].State)
+		require.Equal(t, nullableFloat(90), results[0].Value)
+		require.Equal(t, Normal, results[1].State)
+		require.Equal(t, nullableFloat(30), results[1].Value)
+	})
+
+	t.Run("wide frames need a numeric field", func(t *testing.T) {
+		execResults := ExecutionResults{
+			Results: data.Frames{
+				data.NewFrame("", data.NewField("host", nil, []string{"a"}), data.NewField("region", nil, []string{"eu"})),
+			},
+		}
+
+		_, err := EvaluateExecutionResult(&Condition{}, &execResults, StrictEvaluation)
+		require.EqualError(t, err, "invalid format of evaluation results for the alert definition : no numeric value field found")
+	})
+}
+
+func TestEvaluateExecutionResultMultipleRefIDs(t *testing.T) {
+	execResults := ExecutionResults{
+		ResultsByRefID: map[string]data.Frames{
+			"A": {
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+				data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(1)})),
+			},
+			"B": {
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+				data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(0)})),
+			},
+		},
+	}
+
+	testCases := []struct {
+		desc           string
+		combinator     Combinator
+		expectedStates map[string]state
+	}{
+		{
+			desc:           "and is alerting if every refID is alerting",
+			combinator:     And,
+			expectedStates: map[string]state{"a": Alerting, "b": Normal},
+		},
+		{
+			desc:           "or is alerting if any refID is alerting",
+			combinator:     Or,
+			expectedStates: map[string]state{"a": Alerting, "b": Alerting},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := Condition{RefIDs: []string{"A", "B"}, Combinator: tc.combinator}
+			results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+			require.NoError(t, err)
+
+			states := make(map[string]state, len(results))
+			for _, r := range results {
+				states[r.Instance["host"]] = r.State
+			}
+			require.Equal(t, tc.expectedStates, states)
+		})
+	}
+}
+
+func TestEvaluateExecutionResultWithCombinatorErrors(t *testing.T) {
+	execResults := ExecutionResults{
+		ResultsByRefID: map[string]data.Frames{
+			"A": {
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(0)})),
+			},
+			"B": {
+				data.NewFrame("",
+					data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)}),
+					data.NewField("", nil, []*float64{nullableFloat(1), nullableFloat(2)}),
+				),
+			},
+		},
+	}
+
+	c := Condition{RefIDs: []string{"A", "B"}, Combinator: And}
+	results, err := EvaluateExecutionResult(&c, &execResults, LenientEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, Error, results[0].State)
+	require.Error(t, results[0].Error, "the error of the failed refID is kept")
+	require.True(t, strings.HasPrefix(results[0].Error.Error(), "refID B: "))
+	require.Contains(t, results[0].Error.Error(), "frame has different field lengths")
+}
+
+func TestEvaluateExecutionResultEvaluatedAt(t *testing.T) {
+	evaluatedAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	execResults := ExecutionResults{
+		EvaluatedAt: evaluatedAt,
+		Results: data.Frames{
+			data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+		},
+	}
+
+	results, err := EvaluateExecutionResult(&Condition{}, &execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, evaluatedAt, results[0].EvaluatedAt)
+
+	frame := results.AsDataFrame()
+	require.Equal(t, "Time", frame.Fields[0].Name)
+	require.Equal(t, evaluatedAt, frame.Fields[0].At(0))
+}
+
+func TestAlertExecCtxNow(t *testing.T) {
+	t.Run("uses the injected clock", func(t *testing.T) {
+		mock := clock.NewMock()
+		mock.Set(time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC))
+
+		ctx := AlertExecCtx{Clock: mock}
+		require.Equal(t, mock.Now(), ctx.now())
+	})
+
+	t.Run("defaults to the wall clock", func(t *testing.T) {
+		before := time.Now()
+		now := AlertExecCtx{}.now()
+		require.False(t, now.Before(before))
+	})
+}
+
+func TestExecuteErrors(t *testing.T) {
+	t.Run("invalid condition", func(t *testing.T) {
+		c := Condition{RefID: "B", QueriesAndExpressions: []AlertQuery{{RefID: "A"}}}
+		_, err := c.Execute(AlertExecCtx{Ctx: context.Background()}, "now-5m", "now")
+		require.True(t, errors.Is(err, ErrInvalidCondition))
+		require.False(t, errors.Is(err, ErrTransformFailed))
+	})
+
+	t.Run("transform error matches ErrTransformFailed and wraps its cause", func(t *testing.T) {
+		err := &transformError{err: context.DeadlineExceeded}
+		require.True(t, errors.Is(err, ErrTransformFailed))
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.EqualError(t, err, "failed to transform data: context deadline exceeded")
+	})
+}
+
+func TestResultsAsDataFrameOrdering(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting},
+		{Instance: data.Labels{"host": "b"}, State: Normal},
+		{Instance: data.Labels{"host": "c"}, State: Alerting},
+		{Instance: data.Labels{"host": "d"}, State: Normal},
+	}
+	expected := results.AsDataFrame()
+
+	for i := 0; i < 10; i++ {
+		shuffled := make(Results, len(results))
+		copy(shuffled, results)
+		rand.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		frame := shuffled.AsDataFrame()
+		require.Len(t, frame.Fields, len(expected.Fields))
+		for j := range frame.Fields {
+			require.Equal(t, expected.Fields[j].Labels, frame.Fields[j].Labels)
+			require.Equal(t, expected.Fields[j].At(0), frame.Fields[j].At(0))
+		}
+	}
+}
+
+func TestEvaluateExecutionResultFieldTypes(t *testing.T) {
+	nullableInt := func(i int64) *int64 {
+		return &i
+	}
+	nullableBool := func(b bool) *bool {
+		return &b
+	}
+
+	testCases := []struct {
+		desc          string
+		condition     Condition
+		field         *data.Field
+		expectedState state
+		expectedValue *float64
+		expectedErr   string
+	}{
+		{
+			desc:          "given a nullable float64 field",
+			field:         data.NewField("", nil, []*float64{nullableFloat(2.5)}),
+			expectedState: Alerting,
+			expectedValue: nullableFloat(2.5),
+		},
+		{
+			desc:          "given a float64 field",
+			field:         data.NewField("", nil, []float64{0}),
+			expectedState: Normal,
+			expectedValue: nullableFloat(0),
+		},
+		{
+			desc:          "given an int64 field",
+			field:         data.NewField("", nil, []int64{3}),
+			expectedState: Alerting,
+			expectedValue: nullableFloat(3),
+		},
+		{
+			desc:          "given a nullable int64 field",
+			field:         data.NewField("", nil, []*int64{nullableInt(0)}),
+			expectedState: Normal,
+			expectedValue: nullableFloat(0),
+		},
+		{
+			desc:        "given a time field",
+			field:       data.NewField("", nil, []time.Time{time.Now()}),
+			expectedErr: "invalid format of evaluation results for the alert definition : invalid field type: []time.Time is not numeric",
+		},
+		{
+			desc:          "given a true bool field",
+			field:         data.NewField("", nil, []bool{true}),
+			expectedState: Alerting,
+		},
+		{
+			desc:          "given a false nullable bool field",
+			field:         data.NewField("", nil, []*bool{nullableBool(false)}),
+			expectedState: Normal,
+		},
+		{
+			desc:          "given a null nullable bool field",
+			field:         data.NewField("", nil, []*bool{nil}),
+			expectedState: NoData,
+		},
+		{
+			desc:          "given an alerting string field",
+			condition:     Condition{AlertingStrings: []string{"down", "degraded"}},
+			field:         data.NewField("", nil, []string{"degraded"}),
+			expectedState: Alerting,
+		},
+		{
+			desc:          "given a non alerting string field",
+			condition:     Condition{AlertingStrings: []string{"down", "degraded"}},
+			field:         data.NewField("", nil, []string{"up"}),
+			expectedState: Normal,
+		},
+		{
+			desc:          "given a string field without alerting strings",
+			field:         data.NewField("", nil, []string{"down"}),
+			expectedState: Normal,
+		},
+		{
+			desc:        "given a bool field and a reducer",
+			condition:   Condition{Reducer: ReduceMax},
+			field:       data.NewField("", nil, []bool{true}),
+			expectedErr: "invalid format of evaluation results for the alert definition : invalid field type: []bool is not numeric",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			execResults := ExecutionResults{Results: data.Frames{data.NewFrame("", tc.field)}}
+			results, err := EvaluateExecutionResult(&tc.condition, &execResults, StrictEvaluation)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, tc.expectedState, results[0].State)
+			require.Equal(t, tc.expectedValue, results[0].Value)
+		})
+	}
+}
+
+func TestUnmarshalCondition(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		payload           string
+		expectedCondition *Condition
+		expectedErr       string
+	}{
+		{
+			desc:    "given a version 0 condition with a single refID",
+			payload: `{"refId": "A", "queriesAndExpressions": [{"refId": "A"}]}`,
+			expectedCondition: &Condition{
+				Version:               conditionVersion,
+				RefID:                 "A",
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}},
+			},
+		},
+		{
+			desc:    "given a current condition",
+			payload: `{"version": 1, "refIds": ["A", "B"], "combinator": "or", "queriesAndExpressions": [{"refId": "A"}, {"refId": "B"}]}`,
+			expectedCondition: &Condition{
+				Version:               conditionVersion,
+				RefIDs:                []string{"A", "B"},
+				Combinator:            Or,
+				QueriesAndExpressions: []AlertQuery{{RefID: "A"}, {RefID: "B"}},
+			},
+		},
+		{
+			desc:        "given a condition from a newer version",
+			payload:     `{"version": 2, "refId": "A"}`,
+			expectedErr: "unsupported condition version: 2",
+		},
+		{
+			desc:        "given an invalid payload",
+			payload:     `{"refId": 1}`,
+			expectedErr: "json: cannot unmarshal number into Go struct field Condition.refId of type string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, err := UnmarshalCondition([]byte(tc.payload))
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedCondition, c)
+
+			b, err := json.Marshal(c)
+			require.NoError(t, err)
+			roundTripped, err := UnmarshalCondition(b)
+			require.NoError(t, err)
+			require.Equal(t, c.Version, roundTripped.Version)
+			require.Equal(t, c.RefID, roundTripped.RefID)
+			require.Equal(t, c.RefIDs, roundTripped.RefIDs)
+			require.Equal(t, c.Combinator, roundTripped.Combinator)
+		})
+	}
+}
+
+func TestEvaluateExecutionResultMode(t *testing.T) {
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []time.Time{time.Now()})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "c"}, []*float64{nullableFloat(0)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "d"}, []*float64{nullableFloat(0)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "d"}, []*float64{nullableFloat(1)})),
+		},
+	}
+
+	t.Run("strict evaluation fails on the first invalid frame", func(t *testing.T) {
+		_, err := EvaluateExecutionResult(&Condition{}, &execResults, StrictEvaluation)
+		require.EqualError(t, err, "invalid format of evaluation results for the alert definition : invalid field type: []time.Time is not numeric")
+	})
+
+	t.Run("lenient evaluation evaluates invalid frames to Error", func(t *testing.T) {
+		results, err := EvaluateExecutionResult(&Condition{}, &execResults, LenientEvaluation)
+		require.NoError(t, err)
+
+		states := make(map[string]state, len(results))
+		for _, r := range results {
+			states[r.Instance["host"]] = r.State
+			if r.State == Error {
+				require.Error(t, r.Error)
+			}
+		}
+		require.Equal(t, map[string]state{"a": Alerting, "b": Error, "c": Normal, "d": Error}, states)
+	})
+}
+
+func TestConditionQueryHash(t *testing.T) {
+	condition := func(refID string, model string) Condition {
+		return Condition{
+			RefID: refID,
+			QueriesAndExpressions: []AlertQuery{
+				{
+					RefID:             "A",
+					RelativeTimeRange: RelativeTimeRange{From: Duration(5 * time.Minute)},
+					Model:             json.RawMessage(model),
+				},
+			},
+		}
+	}
+
+	hash := condition("A", `{"expr": "up", "intervalMs": 1000}`).QueryHash()
+	require.NotEmpty(t, hash)
+	require.Equal(t, hash, condition("A", `{"expr": "up", "intervalMs": 1000}`).QueryHash())
+	require.Equal(t, hash, condition("A", `{"intervalMs":1000,"expr":"up"}`).QueryHash())
+	require.NotEqual(t, hash, condition("A", `{"expr": "down", "intervalMs": 1000}`).QueryHash())
+	require.NotEqual(t, hash, condition("B", `{"expr": "up", "intervalMs": 1000}`).QueryHash())
+
+	c := condition("A", `{"expr": "up", "intervalMs": 1000}`)
+	c.QueriesAndExpressions[0].RelativeTimeRange.From = Duration(10 * time.Minute)
+	require.NotEqual(t, hash, c.QueryHash())
+}
+
+func TestExecuteWithTransformClient(t *testing.T) {
+	evaluatedAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	condition := Condition{
+		RefID: "A",
+		QueriesAndExpressions: []AlertQuery{
+			{
+				RefID:             "A",
+				RelativeTimeRange: RelativeTimeRange{From: Duration(5 * time.Minute)},
+				Model:             json.RawMessage(`{"datasource": "prom", "datasourceId": 1, "expr": "up"}`),
+			},
+		},
+		Threshold: &Threshold{Operator: GreaterThan, Value: 1},
+	}
+
+	newAlertExecCtx := func(transform TransformFunc) AlertExecCtx {
+		mockClock := clock.NewMock()
+		mockClock.Set(evaluatedAt)
+		return AlertExecCtx{Ctx: context.Background(), Clock: mockClock, TransformClient: transform}
+	}
+
+	t.Run("canned frames are evaluated", func(t *testing.T) {
+		var req *backend.QueryDataRequest
+		ctx := newAlertExecCtx(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			req = r
+			return &backend.QueryDataResponse{
+				Responses: backend.Responses{
+					"A": {Frames: data.Frames{
+						data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(2)})),
+						data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(0)})),
+					}},
+				},
+			}, nil
+		})
+
+		execResults, results, err := condition.Preview(ctx, "", "")
+		require.NoError(t, err)
+		require.Len(t, execResults.Results, 2)
+
+		require.Len(t, req.Queries, 1)
+		require.Equal(t, "A", req.Queries[0].RefID)
+		require.Equal(t, evaluatedAt.Add(-5*time.Minute), req.Queries[0].TimeRange.From)
+		require.Equal(t, evaluatedAt, req.Queries[0].TimeRange.To)
+
+		require.Len(t, results, 2)
+		require.Equal(t, Alerting, results[0].State)
+		require.Equal(t, Normal, results[1].State)
+		require.Equal(t, evaluatedAt, results[0].EvaluatedAt)
+
+		evaluatedRange := backend.TimeRange{From: evaluatedAt.Add(-5 * time.Minute), To: evaluatedAt}
+		require.Equal(t, evaluatedRange, execResults.TimeRange)
+		require.Equal(t, evaluatedRange, results[0].TimeRange)
+	})
+
+	t.Run("executions are traced", func(t *testing.T) {
+		tracer := mocktracer.New()
+		origTracer := opentracing.GlobalTracer()
+		opentracing.SetGlobalTracer(tracer)
+		t.Cleanup(func() {
+			opentracing.SetGlobalTracer(origTracer)
+		})
+
+		ctx := newAlertExecCtx(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return &backend.QueryDataResponse{
+				Responses: backend.Responses{
+					"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(2)}))}},
+				},
+			}, nil
+		})
+		ctx.AlertDefitionID = 42
+
+		_, err := condition.Execute(ctx, "", "")
+		require.NoError(t, err)
+
+		spans := tracer.FinishedSpans()
+		require.Len(t, spans, 3)
+		require.Equal(t, "ngalert.condition.transform", spans[0].OperationName)
+		require.Equal(t, "ngalert.condition.decode", spans[1].OperationName)
+		require.Equal(t, "ngalert.condition.execute", spans[2].OperationName)
+		require.Equal(t, spans[2].SpanContext.SpanID, spans[0].ParentID)
+		require.Equal(t, spans[2].SpanContext.SpanID, spans[1].ParentID)
+		require.Equal(t, int64(42), spans[2].Tag("alertDefinitionId"))
+		require.Equal(t, 1, spans[2].Tag("refIdCount"))
+		require.Equal(t, "success", spans[2].Tag("outcome"))
+
+		tracer.Reset()
+		ctx.TransformClient = TransformFunc(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return nil, errors.New("boom")
+		})
+		_, err = condition.Execute(ctx, "", "")
+		require.Error(t, err)
+
+		spans = tracer.FinishedSpans()
+		require.Len(t, spans, 2)
+		require.Equal(t, "error", spans[1].Tag("outcome"))
+		require.Equal(t, true, spans[1].Tag("error"))
+	})
+
+	t.Run("historical executions query the window ending at the given time", func(t *testing.T) {
+		var req *backend.QueryDataRequest
+		ctx := newAlertExecCtx(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			req = r
+			return &backend.QueryDataResponse{
+				Responses: backend.Responses{
+					"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(2)}))}},
+				},
+			}, nil
+		})
+
+		at := evaluatedAt.Add(-24 * time.Hour)
+		execResults, err := condition.ExecuteAt(ctx, at, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, at, execResults.EvaluatedAt)
+
+		require.Len(t, req.Queries, 1)
+		require.Equal(t, at.Add(-time.Hour), req.Queries[0].TimeRange.From)
+		require.Equal(t, at, req.Queries[0].TimeRange.To)
+		require.Equal(t, backend.TimeRange{From: at.Add(-time.Hour), To: at}, execResults.TimeRange)
+
+		_, err = condition.ExecuteAt(ctx, at, 0)
+		require.EqualError(t, err, "invalid time range: window 0s is not positive")
+	})
+
+	t.Run("condition sampling overrides every query", func(t *testing.T) {
+		var req *backend.QueryDataRequest
+		ctx := newAlertExecCtx(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			req = r
+			return &backend.QueryDataResponse{Responses: backend.Responses{}}, nil
+		})
+
+		c := condition
+		c.QueriesAndExpressions = []AlertQuery{
+			{RefID: "A", Model: json.RawMessage(`{"datasource": "prom", "datasourceId": 1, "maxDataPoints": 500, "intervalMs": 100}`)},
+			{RefID: "B", Model: json.RawMessage(`{"datasource": "prom", "datasourceId": 1}`)},
+		}
+		c.MaxDataPoints = 60
+		c.Interval = Duration(time.Minute)
+		_, _ = c.Execute(ctx, "", "")
+
+		require.Len(t, req.Queries, 2)
+		for _, q := range req.Queries {
+			require.Equal(t, int64(60), q.MaxDataPoints)
+			require.Equal(t, time.Minute, q.Interval)
+
+			var model map[string]interface{}
+			require.NoError(t, json.Unmarshal(q.JSON, &model))
+			require.Equal(t, float64(60), model["maxDataPoints"])
+			require.Equal(t, float64(60000), model["intervalMs"])
+		}
+
+		c.MaxDataPoints = 0
+		_, _ = c.Execute(ctx, "", "")
+		require.Equal(t, int64(500), req.Queries[0].MaxDataPoints)
+		require.Equal(t, time.Minute, req.Queries[0].Interval)
+	})
+
+	t.Run("plugin context is the evaluating org and user", func(t *testing.T) {
+		var req *backend.QueryDataRequest
+		ctx := newAlertExecCtx(func(_ context.Context, r *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			req = r
+			return &backend.QueryDataResponse{Responses: backend.Responses{}}, nil
+		})
+		ctx.SignedInUser = &models.SignedInUser{OrgId: 2, UserId: 3, Login: "alerter", Name: "Alerter", OrgRole: models.ROLE_EDITOR}
+
+		_, _ = condition.Execute(ctx, "", "")
+		require.Equal(t, int64(2), req.PluginContext.OrgID)
+		require.NotNil(t, req.PluginContext.User)
+		require.Equal(t, "alerter", req.PluginContext.User.Login)
+		require.Equal(t, "Alerter", req.PluginContext.User.Name)
+		require.Equal(t, "Editor", req.PluginContext.User.Role)
+
+		ctx.SignedInUser = nil
+		_, _ = condition.Execute(ctx, "", "")
+		require.Equal(t, backend.PluginContext{}, req.PluginContext)
+	})
+
+	t.Run("missing refID is no data", func(t *testing.T) {
+		ctx := newAlertExecCtx(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return &backend.QueryDataResponse{Responses: backend.Responses{}}, nil
+		})
+
+		execResults, err := condition.Execute(ctx, "", "")
+		require.True(t, errors.Is(err, ErrNoResults))
+		require.True(t, errors.Is(execResults.Error, ErrNoResults))
+
+		_, results, err := condition.Preview(ctx, "", "")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, NoData, results[0].State)
+	})
+
+	t.Run("intermediate results are included on demand", func(t *testing.T) {
+		ctx := newAlertExecCtx(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return &backend.QueryDataResponse{
+				Responses: backend.Responses{
+					"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(2)}))}},
+					"B": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []*float64{nullableFloat(0)}))}},
+				},
+			}, nil
+		})
+
+		execResults, err := condition.Execute(ctx, "", "")
+		require.NoError(t, err)
+		require.Nil(t, execResults.IntermediateResults)
+
+		ctx.IncludeIntermediateResults = true
+		execResults, results, err := condition.Preview(ctx, "", "")
+		require.NoError(t, err)
+		require.Len(t, execResults.IntermediateResults, 1)
+		require.Equal(t, nullableFloat(0), execResults.IntermediateResults["B"][0].Fields[0].At(0))
+		require.Len(t, results, 1)
+		require.Equal(t, Alerting, results[0].State, "the state derives from the evaluated refID only")
+
+		c := condition
+		c.RefID = "C"
+		c.QueriesAndExpressions = []AlertQuery{condition.QueriesAndExpressions[0], {RefID: "C", Model: json.RawMessage(`{"datasource": "prom", "datasourceId": 1, "expr": "up"}`)}}
+		execResults, err = c.Execute(ctx, "", "")
+		require.True(t, errors.Is(err, ErrNoResults))
+		require.Len(t, execResults.IntermediateResults, 2, "intermediate results of failed evaluations are included")
+	})
+
+	t.Run("too many frames fail the execution", func(t *testing.T) {
+		ctx := newAlertExecCtx(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			frames := make(data.Frames, 0, 3)
+			for i := 0; i < 3; i++ {
+				frames = append(frames, data.NewFrame("", data.NewField("", data.Labels{"host": fmt.Sprint(i)}, []*float64{nullableFloat(2)})))
+			}
+			return &backend.QueryDataResponse{Responses: backend.Responses{"A": {Frames: frames}}}, nil
+		})
+		ctx.MaxFrames = 2
+
+		execResults, err := condition.Execute(ctx, "", "")
+		require.True(t, errors.Is(err, ErrTooManyFrames))
+		require.EqualError(t, execResults.Error, "too many frames for refID A: 3 frames instead of at most 2")
+
+		_, results, err := condition.Preview(ctx, "", "")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, Error, results[0].State)
+
+		ctx.MaxFrames = 3
+		_, err = condition.Execute(ctx, "", "")
+		require.NoError(t, err)
+	})
+
+	t.Run("transform failure is evaluated to the execution error state", func(t *testing.T) {
+		ctx := newAlertExecCtx(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return nil, fmt.Errorf("datasource is down")
+		})
+
+		execResults, err := condition.Execute(ctx, "", "")
+		require.True(t, errors.Is(err, ErrTransformFailed))
+		require.EqualError(t, execResults.Error, "failed to transform data: datasource is down")
+
+		c := condition
+		c.ExecErrState = ExecErrStateAlerting
+		_, results, err := c.Preview(ctx, "", "")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, Alerting, results[0].State)
+	})
+}
+
+func TestWidenTimeRange(t *testing.T) {
+	now := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	tr := backend.TimeRange{From: now.Add(-5 * time.Minute), To: now.Add(-time.Minute)}
+
+	require.Equal(t, tr, widenTimeRange(backend.TimeRange{}, tr))
+	require.Equal(t, tr, widenTimeRange(tr, backend.TimeRange{From: now.Add(-2 * time.Minute), To: now.Add(-2 * time.Minute)}))
+	require.Equal(t, backend.TimeRange{From: now.Add(-time.Hour), To: now}, widenTimeRange(tr, backend.TimeRange{From: now.Add(-time.Hour), To: now}))
+}
+
+func TestConditionRequiredDatasources(t *testing.T) {
+	query := func(refID string, model string) AlertQuery {
+		return AlertQuery{RefID: refID, Model: json.RawMessage(model)}
+	}
+
+	t.Run("returns the queried datasources once, skipping expressions", func(t *testing.T) {
+		c := Condition{
+			RefID: "D",
+			QueriesAndExpressions: []AlertQuery{
+				query("A", `{"datasource": "prom", "datasourceId": 2}`),
+				query("B", `{"datasource": "loki", "datasourceId": 1}`),
+				query("C", `{"datasource": "prom", "datasourceId": 2}`),
+				query("D", `{"datasource": "__expr__", "type": "math", "expression": "$A + $B + $C"}`),
+			},
+		}
+		ids, err := c.RequiredDatasources()
+		require.NoError(t, err)
+		require.Equal(t, []int64{2, 1}, ids)
+	})
+
+	t.Run("fails on a query without a datasource", func(t *testing.T) {
+		c := Condition{RefID: "A", QueriesAndExpressions: []AlertQuery{query("A", `{"expr": "up"}`)}}
+		_, err := c.RequiredDatasources()
+		require.True(t, errors.Is(err, ErrInvalidCondition))
+		require.EqualError(t, err, "invalid condition: failed to get the datasource of refID A: failed to get datasource from query model")
+	})
+}
+
+func TestConditionString(t *testing.T) {
+	query := func(refID string, model string) AlertQuery {
+		return AlertQuery{RefID: refID, Model: json.RawMessage(model)}
+	}
+
+	c := Condition{
+		RefIDs: []string{"B", "C"},
+		QueriesAndExpressions: []AlertQuery{
+			query("A", `{"datasource": "prom", "datasourceId": 1}`),
+			query("B", `{"datasource": "__expr__", "type": "math", "expression": "$A"}`),
+			query("C", `invalid`),
+		},
+	}
+	require.Equal(t, "refIds=[B C] queries=[A(prom) B(__expr__) C()]", c.String())
+
+	c = Condition{RefID: "A"}
+	for i := 0; i < maxStringQueries+5; i++ {
+		c.QueriesAndExpressions = append(c.QueriesAndExpressions, query(fmt.Sprintf("Q%d", i), `{"datasource": "prom"}`))
+	}
+	s := c.String()
+	require.True(t, strings.HasSuffix(s, "Q9(prom) ... 5 more]"), s)
+}
+
+func TestConditionSimplify(t *testing.T) {
+	query := func(refID string, model string) AlertQuery {
+		return AlertQuery{RefID: refID, Model: json.RawMessage(model)}
+	}
+	dsModel := `{"datasource": "prom", "datasourceId": 1, "orgId": 1, "expr": "up"}`
+
+	testCases := []struct {
+		desc       string
+		condition  Condition
+		simplified bool
+	}{
+		{
+			desc:       "given a single datasource query",
+			condition:  Condition{RefID: "A", QueriesAndExpressions: []AlertQuery{query("A", dsModel)}},
+			simplified: true,
+		},
+		{
+			desc:      "given a single expression",
+			condition: Condition{RefID: "A", QueriesAndExpressions: []AlertQuery{query("A", `{"datasource": "__expr__", "type": "math", "expression": "1"}`)}},
+		},
+		{
+			desc:      "given a single hidden datasource query",
+			condition: Condition{RefID: "A", QueriesAndExpressions: []AlertQuery{query("A", `{"datasource": "prom", "datasourceId": 1, "hide": true}`)}},
+		},
+		{
+			desc:      "given a datasource query and an expression",
+			condition: Condition{RefID: "B", QueriesAndExpressions: []AlertQuery{query("A", dsModel), query("B", `{"datasource": "__expr__", "type": "math", "expression": "$A"}`)}},
+		},
+		{
+			desc:      "given a condition referencing another refID",
+			condition: Condition{RefID: "B", QueriesAndExpressions: []AlertQuery{query("A", dsModel)}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.simplified, tc.condition.Simplify())
+		})
+	}
+}
+
+// fakeQueryEndpoint returns a time series for every query.
+type fakeQueryEndpoint struct{}
+
+func (fakeQueryEndpoint) Query(_ context.Context, _ *models.DataSource, query *tsdb.TsdbQuery) (*tsdb.Response, error) {
+	res := &tsdb.Response{Results: make(map[string]*tsdb.QueryResult)}
+	for _, q := range query.Queries {
+		frame := data.NewFrame("",
+			data.NewField("time", nil, []time.Time{time.Unix(1, 0), time.Unix(2, 0)}),
+			data.NewField("value", data.Labels{"host": "a"}, []*float64{nullableFloat(1), nullableFloat(3)}),
+		)
+		res.Results[q.RefId] = &tsdb.QueryResult{RefId: q.RefId, Dataframes: tsdb.NewDecodedDataFrames(data.Frames{frame})}
+	}
+	return res, nil
+}
+
+// setupFakeDatasource registers a datasource of type "evalfake" answered by fakeQueryEndpoint.
+func setupFakeDatasource(tb testing.TB) {
+	tb.Helper()
+	tsdb.RegisterTsdbQueryEndpoint("evalfake", func(*models.DataSource) (tsdb.TsdbQueryEndpoint, error) {
+		return fakeQueryEndpoint{}, nil
+	})
+	bus.AddHandler("test", func(query *models.GetDataSourceByIdQuery) error {
+		query.Result = &models.DataSource{Id: query.Id, OrgId: query.OrgId, Type: "evalfake"}
+		return nil
+	})
+	tb.Cleanup(bus.ClearBusHandlers)
+}
+
+func newFakeDatasourceCondition() Condition {
+	return Condition{
+		RefID: "A",
+		QueriesAndExpressions: []AlertQuery{
+			{
+				RefID:             "A",
+				RelativeTimeRange: RelativeTimeRange{From: Duration(5 * time.Minute)},
+				Model:             json.RawMessage(`{"datasource": "fake", "datasourceId": 1, "orgId": 1}`),
+			},
+		},
+		Reducer:   ReduceLast,
+		Threshold: &Threshold{Operator: GreaterThan, Value: 2},
+	}
+}
+
+func TestSimplifiedConditionExecution(t *testing.T) {
+	setupFakeDatasource(t)
+	ctx := AlertExecCtx{Ctx: context.Background(), Clock: clock.NewMock()}
+
+	full := newFakeDatasourceCondition()
+	_, fullResults, err := full.Preview(ctx, "", "")
+	require.NoError(t, err)
+
+	simplified := newFakeDatasourceCondition()
+	require.True(t, simplified.Simplify())
+	_, simplifiedResults, err := simplified.Preview(ctx, "", "")
+	require.NoError(t, err)
+
+	require.Len(t, fullResults, 1)
+	require.Equal(t, Alerting, fullResults[0].State)
+	require.Equal(t, nullableFloat(3), fullResults[0].Value)
+	require.Equal(t, fullResults, simplifiedResults)
+}
+
+func TestExecuteWithUnavailableTransform(t *testing.T) {
+	setupFakeDatasource(t)
+	var nilTransform TransformFunc
+	ctx := AlertExecCtx{Ctx: context.Background(), Clock: clock.NewMock(), TransformClient: nilTransform}
+
+	full := newFakeDatasourceCondition()
+	execResults, err := full.Execute(ctx, "", "")
+	require.Equal(t, ErrTransformUnavailable, err)
+	require.Equal(t, ErrTransformUnavailable, execResults.Error)
+
+	_, results, err := full.Preview(ctx, "", "")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, Error, results[0].State)
+
+	simplified := newFakeDatasourceCondition()
+	require.True(t, simplified.Simplify())
+	_, results, err = simplified.Preview(ctx, "", "")
+	require.NoError(t, err, "simplified conditions query their datasource directly")
+	require.Len(t, results, 1)
+	require.Equal(t, Alerting, results[0].State)
+
+	t.Run("a nil response fails the transform", func(t *testing.T) {
+		ctx.TransformClient = TransformFunc(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return nil, nil
+		})
+		_, err := full.Execute(ctx, "", "")
+		require.True(t, errors.Is(err, ErrTransformFailed))
+		require.EqualError(t, err, "failed to transform data: no response")
+	})
+}
+
+func TestExecuteWithTimeout(t *testing.T) {
+	ctx := AlertExecCtx{Ctx: context.Background(), AlertDefitionID: 42, Timeout: 10 * time.Millisecond}
+	ctx.TransformClient = TransformFunc(func(ctx context.Context, _ *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	c := Condition{
+		RefID: "B",
+		QueriesAndExpressions: []AlertQuery{
+			{RefID: "A", Model: json.RawMessage(`{"datasource": "fake", "datasourceId": 1}`)},
+			{RefID: "B", Model: json.RawMessage(`{"datasource": "__expr__", "type": "math", "expression": "$A"}`)},
+		},
+	}
+	execResults, err := c.Execute(ctx, "", "")
+	require.True(t, errors.Is(err, ErrTransformFailed))
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Contains(t, err.Error(), "execution of alert definition 42 (refIDs A,B) did not complete within 10ms")
+	require.Equal(t, err, execResults.Error)
+}
+
+func TestExecuteWithFailedQueries(t *testing.T) {
+	queryErr := errors.New("datasource is unreachable")
+	ctx := AlertExecCtx{Ctx: context.Background(), Clock: clock.NewMock()}
+	ctx.TransformClient = TransformFunc(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		return &backend.QueryDataResponse{Responses: backend.Responses{
+			"A": {Error: queryErr},
+			"B": {Error: errors.New("input A failed")},
+			"C": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []float64{1}))}},
+		}}, nil
+	})
+
+	c := Condition{
+		QueriesAndExpressions: []AlertQuery{
+			{RefID: "A", Model: json.RawMessage(`{"datasource": "fake", "datasourceId": 1}`)},
+			{RefID: "B", Model: json.RawMessage(`{"datasource": "__expr__", "type": "math", "expression": "$A"}`)},
+			{RefID: "C", Model: json.RawMessage(`{"datasource": "__expr__", "type": "math", "expression": "1"}`)},
+		},
+	}
+
+	t.Run("the error of an evaluated refID fails the execution", func(t *testing.T) {
+		c := c
+		c.RefID = "B"
+		execResults, err := c.Execute(ctx, "", "")
+		require.True(t, errors.Is(err, ErrQueryFailed))
+		require.EqualError(t, err, "query failed for refID B: input A failed")
+		require.Equal(t, err, execResults.Error)
+		require.Len(t, execResults.ErrorsByRefID, 2)
+		require.Equal(t, queryErr, execResults.ErrorsByRefID["A"])
+	})
+
+	t.Run("errors of other refIDs are collected", func(t *testing.T) {
+		c := c
+		c.RefID = "C"
+		execResults, err := c.Execute(ctx, "", "")
+		require.NoError(t, err)
+		require.Len(t, execResults.Results, 1)
+		require.Len(t, execResults.ErrorsByRefID, 2)
+		require.Equal(t, queryErr, execResults.ErrorsByRefID["A"])
+	})
+}
+
+func BenchmarkConditionExecute(b *testing.B) {
+	setupFakeDatasource(b)
+	ctx := AlertExecCtx{Ctx: context.Background()}
+
+	b.Run("full", func(b *testing.B) {
+		c := newFakeDatasourceCondition()
+		for i := 0; i < b.N; i++ {
+			if _, err := c.Execute(ctx, "", ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("simplified", func(b *testing.B) {
+		c := newFakeDatasourceCondition()
+		c.Simplify()
+		for i := 0; i < b.N; i++ {
+			if _, err := c.Execute(ctx, "", ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
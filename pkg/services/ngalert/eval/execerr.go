@@ -0,0 +1,38 @@
+package eval
+
+import "fmt"
+
+// ExecErrState is the state of the alert instances of a condition that failed to execute.
+type ExecErrState string
+
+const (
+	// ExecErrStateError evaluates the failed condition to Error.
+	ExecErrStateError ExecErrState = "error"
+	// ExecErrStateAlerting evaluates the failed condition to Alerting.
+	ExecErrStateAlerting ExecErrState = "alerting"
+	// ExecErrStateOK evaluates the failed condition to Normal.
+	ExecErrStateOK ExecErrState = "ok"
+)
+
+// validate checks that the execution error state is supported.
+func (s ExecErrState) validate() error {
+	switch s {
+	case ExecErrStateError, ExecErrStateAlerting, ExecErrStateOK:
+		return nil
+	default:
+		return fmt.Errorf("invalid execution error state: %q", s)
+	}
+}
+
+// state returns the evaluation state of a failed condition.
+// If the execution error state is missing, it's Error.
+func (s ExecErrState) state() state {
+	switch s {
+	case ExecErrStateAlerting:
+		return Alerting
+	case ExecErrStateOK:
+		return Normal
+	default:
+		return Error
+	}
+}
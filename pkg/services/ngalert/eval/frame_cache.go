@@ -0,0 +1,42 @@
+package eval
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// FrameCache reuses the frame of the previous results of a condition when its alert instances
+// are unchanged, according to their Hash, instead of rebuilding it with AsDataFrame.
+// The zero value is ready to use.
+type FrameCache struct {
+	mu    sync.Mutex
+	hash  uint64
+	frame *data.Frame
+}
+
+// AsDataFrame returns the frame of the results like Results.AsDataFrame. If the results have
+// the same hash as the previous ones, their fields are reused and only the time is updated
+// to the evaluation time of the results, which alert instances of an evaluation share.
+// The returned frame must not be modified since its fields are shared.
+func (c *FrameCache) AsDataFrame(results Results) data.Frame {
+	hash := results.Hash()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.frame == nil || c.hash != hash {
+		f := results.AsDataFrame()
+		c.hash, c.frame = hash, &f
+		return f
+	}
+
+	f := *c.frame
+	if len(results) > 0 {
+		f.Fields = make([]*data.Field, len(c.frame.Fields))
+		copy(f.Fields, c.frame.Fields)
+		f.Fields[0] = data.NewField("Time", nil, []time.Time{results[0].EvaluatedAt})
+	}
+	return f
+}
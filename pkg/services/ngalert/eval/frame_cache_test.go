@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultsHash(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(1)},
+		{Instance: data.Labels{"host": "b"}, State: Normal, Value: nullableFloat(math.NaN())},
+		{Instance: data.Labels{"host": "c"}, State: NoData},
+	}
+	reordered := Results{results[2], results[0], results[1]}
+	require.Equal(t, results.Hash(), reordered.Hash())
+
+	evaluatedLater := Results{results[0], results[1], results[2]}
+	evaluatedLater[0].EvaluatedAt = time.Unix(60, 0)
+	require.Equal(t, results.Hash(), evaluatedLater.Hash(), "the evaluation time isn't hashed")
+
+	changes := map[string]result{
+		"labels": {Instance: data.Labels{"host": "d"}, State: Alerting, Value: nullableFloat(1)},
+		"state":  {Instance: data.Labels{"host": "a"}, State: Normal, Value: nullableFloat(1)},
+		"value":  {Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(2)},
+		"null":   {Instance: data.Labels{"host": "a"}, State: Alerting},
+	}
+	for desc, changed := range changes {
+		t.Run(desc, func(t *testing.T) {
+			other := Results{changed, results[1], results[2]}
+			require.NotEqual(t, results.Hash(), other.Hash())
+		})
+	}
+}
+
+func TestFrameCache(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(1), EvaluatedAt: time.Unix(0, 0)},
+		{Instance: data.Labels{"host": "b"}, State: Normal, Value: nullableFloat(0), EvaluatedAt: time.Unix(0, 0)},
+	}
+
+	var cache FrameCache
+	frame := cache.AsDataFrame(results)
+	require.Equal(t, results.AsDataFrame(), frame)
+
+	unchanged := Results{results[0], results[1]}
+	for i := range unchanged {
+		unchanged[i].EvaluatedAt = time.Unix(60, 0)
+	}
+	reused := cache.AsDataFrame(unchanged)
+	require.Equal(t, unchanged.AsDataFrame(), reused)
+	require.Same(t, frame.Fields[1], reused.Fields[1], "the fields of unchanged results are reused")
+	require.Equal(t, time.Unix(0, 0), frame.Fields[0].At(0), "the cached frame isn't modified")
+
+	changed := Results{results[0], {Instance: data.Labels{"host": "b"}, State: Alerting, Value: nullableFloat(2)}}
+	require.Equal(t, changed.AsDataFrame(), cache.AsDataFrame(changed))
+}
+
+func BenchmarkResultsAsDataFrame(b *testing.B) {
+	results := make(Results, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		results = append(results, result{
+			Instance: data.Labels{"host": fmt.Sprintf("host-%d", i), "env": "prod"},
+			State:    Normal,
+			Value:    nullableFloat(float64(i)),
+		})
+	}
+
+	b.Run("rebuilt", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = results.AsDataFrame()
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		var cache FrameCache
+		cache.AsDataFrame(results)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = cache.AsDataFrame(results)
+		}
+	})
+}
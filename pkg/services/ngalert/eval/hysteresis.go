@@ -0,0 +1,58 @@
+package eval
+
+import "sync"
+
+// HysteresisEvaluator evaluates the ExecutionResults of successive executions of a condition,
+// like EvaluateExecutionResult, and only reports an alert instance as Alerting once it's been
+// alerting for a number of consecutive evaluations, so that flapping instances don't fire.
+// It's safe for concurrent use, and should be used for the executions of a single condition.
+type HysteresisEvaluator struct {
+	count int
+
+	mu sync.Mutex
+	// consecutive is the number of consecutive evaluations each alert instance has been alerting for.
+	consecutive map[string]int
+}
+
+// NewHysteresisEvaluator returns a HysteresisEvaluator reporting alert instances as Alerting
+// once they've been alerting for count consecutive evaluations. A count below 1 is 1.
+func NewHysteresisEvaluator(count int) *HysteresisEvaluator {
+	if count < 1 {
+		count = 1
+	}
+	return &HysteresisEvaluator{
+		count:       count,
+		consecutive: make(map[string]int),
+	}
+}
+
+// Evaluate evaluates the ExecutionResults like EvaluateExecutionResult. Alert instances that
+// haven't been alerting for enough consecutive evaluations yet are reported as Normal.
+// Any other state clears the count of an alert instance, and so does its absence from the results.
+func (h *HysteresisEvaluator) Evaluate(c *Condition, results *ExecutionResults, mode EvaluationMode) (Results, error) {
+	evalResults, err := EvaluateExecutionResult(c, results, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	consecutive := make(map[string]int, len(evalResults))
+	for i := range evalResults {
+		r := &evalResults[i]
+		if r.State != Alerting {
+			continue
+		}
+
+		key := instanceKey(r.Instance)
+		consecutive[key] = h.consecutive[key] + 1
+		if consecutive[key] < h.count {
+			r.State = Normal
+			r.Severity = ""
+		}
+	}
+	h.consecutive = consecutive
+
+	return evalResults, nil
+}
@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHysteresisEvaluator(t *testing.T) {
+	execResults := func(values map[string]float64) *ExecutionResults {
+		frames := make(data.Frames, 0, len(values))
+		for host, v := range values {
+			frames = append(frames, data.NewFrame("", data.NewField("", data.Labels{"host": host}, []*float64{nullableFloat(v)})))
+		}
+		return &ExecutionResults{Results: frames}
+	}
+
+	h := NewHysteresisEvaluator(3)
+	evaluate := func(values map[string]float64) map[string]state {
+		results, err := h.Evaluate(&Condition{}, execResults(values), StrictEvaluation)
+		require.NoError(t, err)
+
+		states := make(map[string]state, len(results))
+		for _, r := range results {
+			states[r.Instance["host"]] = r.State
+		}
+		return states
+	}
+
+	require.Equal(t, map[string]state{"a": Normal, "b": Normal}, evaluate(map[string]float64{"a": 1, "b": 1}))
+	require.Equal(t, map[string]state{"a": Normal, "b": Normal}, evaluate(map[string]float64{"a": 1, "b": 0}))
+	require.Equal(t, map[string]state{"a": Alerting, "b": Normal}, evaluate(map[string]float64{"a": 1, "b": 1}))
+	require.Equal(t, map[string]state{"a": Alerting, "b": Normal}, evaluate(map[string]float64{"a": 1, "b": 1}))
+
+	t.Run("a normal evaluation clears the count", func(t *testing.T) {
+		require.Equal(t, map[string]state{"a": Normal, "b": Alerting}, evaluate(map[string]float64{"a": 0, "b": 1}))
+		require.Equal(t, map[string]state{"a": Normal, "b": Alerting}, evaluate(map[string]float64{"a": 1, "b": 1}))
+	})
+
+	t.Run("a missing alert instance clears the count", func(t *testing.T) {
+		require.Equal(t, map[string]state{"a": Normal}, evaluate(map[string]float64{"a": 1}))
+		require.Equal(t, map[string]state{"a": Alerting, "b": Normal}, evaluate(map[string]float64{"a": 1, "b": 1}))
+	})
+
+	t.Run("a count of one reports alerting instances right away", func(t *testing.T) {
+		results, err := NewHysteresisEvaluator(0).Evaluate(&Condition{}, execResults(map[string]float64{"a": 1}), StrictEvaluation)
+		require.NoError(t, err)
+		require.Equal(t, Alerting, results[0].State)
+	})
+}
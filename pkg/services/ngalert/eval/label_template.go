@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// labelReference matches the references to labels in the template of a LabelTemplate,
+// in the {{label}} format of legends.
+var labelReference = regexp.MustCompile(`\{\{\s*(.+?)\s*\}\}`)
+
+// LabelTemplate derives a label of each evaluated alert instance from its labels before alert
+// instances are grouped, such as a "service" label composed with the "{{app}}-{{component}}" template.
+type LabelTemplate struct {
+	// Name is the name of the derived label, replacing the label of that name if it exists.
+	Name string `json:"name"`
+
+	// Template is the value of the derived label, where each {{label}} reference is replaced
+	// with the value of that label, or removed if the alert instance doesn't have it.
+	// If the value is empty, the alert instance doesn't have the label.
+	Template string `json:"template"`
+
+	// RemoveReferenced removes the labels referenced by the template, other than the derived one
+	// and the reserved ones, so that labels can be renamed.
+	RemoveReferenced bool `json:"removeReferenced,omitempty"`
+}
+
+// references returns the names of the labels referenced by the template.
+func (t LabelTemplate) references() []string {
+	matches := labelReference.FindAllStringSubmatch(t.Template, -1)
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// validateLabelTemplates checks that the label templates derive unique labels that aren't reserved,
+// and that their templates only contain well-formed label references.
+func validateLabelTemplates(templates []LabelTemplate) error {
+	names := make(map[string]struct{}, len(templates))
+	for i, t := range templates {
+		if t.Name == "" {
+			return fmt.Errorf("label template %d has no name", i)
+		}
+		if strings.HasPrefix(t.Name, "__") {
+			return fmt.Errorf("label template %q: labels starting with \"__\" are reserved", t.Name)
+		}
+		if _, ok := names[t.Name]; ok {
+			return fmt.Errorf("label template name %q is used by more than one label template", t.Name)
+		}
+		names[t.Name] = struct{}{}
+
+		if rest := labelReference.ReplaceAllString(t.Template, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+			return fmt.Errorf("label template %q: unbalanced label reference in %q", t.Name, t.Template)
+		}
+	}
+	return nil
+}
+
+// applyLabelTemplates derives the labels of each alert instance according to the LabelTemplates,
+// in order, so that a template can reference the labels derived by the previous ones.
+// In LenientEvaluation mode, alert instances whose derived labels cannot uniquely identify them
+// are in Error, otherwise the evaluation fails.
+func (c *Condition) applyLabelTemplates(evalResults Results, mode EvaluationMode) (Results, error) {
+	if len(c.LabelTemplates) == 0 {
+		return evalResults, nil
+	}
+
+	templated := make(Results, 0, len(evalResults))
+	labels := make(map[string]int, len(evalResults))
+	for _, r := range evalResults {
+		r.Instance = templateLabels(r.Instance, c.LabelTemplates)
+
+		key := instanceKey(r.Instance)
+		if i, ok := labels[key]; ok {
+			err := fmt.Errorf("alert instances cannot uniquely be identified by their templated labels: %s", r.Instance.String())
+			if mode != LenientEvaluation {
+				return nil, err
+			}
+			templated[i] = result{Instance: r.Instance, State: Error, Error: err}
+			continue
+		}
+		labels[key] = len(templated)
+		templated = append(templated, r)
+	}
+	return templated, nil
+}
+
+// templateLabels returns a copy of the labels with the labels derived by the templates.
+func templateLabels(labels data.Labels, templates []LabelTemplate) data.Labels {
+	templated := make(data.Labels, len(labels)+len(templates))
+	for n, v := range labels {
+		templated[n] = v
+	}
+
+	for _, t := range templates {
+		value := labelReference.ReplaceAllStringFunc(t.Template, func(ref string) string {
+			return templated[labelReference.FindStringSubmatch(ref)[1]]
+		})
+		if t.RemoveReferenced {
+			for _, name := range t.references() {
+				// reserved labels identify alert instances
+				if !strings.HasPrefix(name, "__") {
+					delete(templated, name)
+				}
+			}
+		}
+		if value == "" {
+			delete(templated, t.Name)
+			continue
+		}
+		templated[t.Name] = value
+	}
+	return templated
+}
@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateLabels(t *testing.T) {
+	labels := data.Labels{"app": "checkout", "component": "api", RefIDLabel: "A"}
+
+	testCases := []struct {
+		desc      string
+		templates []LabelTemplate
+		expected  data.Labels
+	}{
+		{
+			desc:      "labels are combined",
+			templates: []LabelTemplate{{Name: "service", Template: "{{app}}-{{ component }}"}},
+			expected:  data.Labels{"app": "checkout", "component": "api", "service": "checkout-api", RefIDLabel: "A"},
+		},
+		{
+			desc:      "labels are renamed",
+			templates: []LabelTemplate{{Name: "application", Template: "{{app}}", RemoveReferenced: true}},
+			expected:  data.Labels{"application": "checkout", "component": "api", RefIDLabel: "A"},
+		},
+		{
+			desc:      "missing labels are removed from the value",
+			templates: []LabelTemplate{{Name: "service", Template: "{{app}}/{{region}}"}},
+			expected:  data.Labels{"app": "checkout", "component": "api", "service": "checkout/", RefIDLabel: "A"},
+		},
+		{
+			desc:      "an empty value removes the label",
+			templates: []LabelTemplate{{Name: "component", Template: "{{region}}"}},
+			expected:  data.Labels{"app": "checkout", RefIDLabel: "A"},
+		},
+		{
+			desc: "templates reference the labels derived by the previous ones",
+			templates: []LabelTemplate{
+				{Name: "service", Template: "{{app}}-{{component}}", RemoveReferenced: true},
+				{Name: "team", Template: "owners of {{service}}"},
+			},
+			expected: data.Labels{"service": "checkout-api", "team": "owners of checkout-api", RefIDLabel: "A"},
+		},
+		{
+			desc:      "reserved labels are kept",
+			templates: []LabelTemplate{{Name: "ref", Template: "{{__ref_id__}}", RemoveReferenced: true}},
+			expected:  data.Labels{"app": "checkout", "component": "api", "ref": "A", RefIDLabel: "A"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expected, templateLabels(labels, tc.templates))
+		})
+	}
+
+	require.Equal(t, data.Labels{"app": "checkout", "component": "api", RefIDLabel: "A"}, labels, "the labels aren't modified")
+}
+
+func TestEvaluateExecutionResultWithLabelTemplates(t *testing.T) {
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("", data.NewField("", data.Labels{"app": "checkout", "component": "api", "pod": "a"}, []float64{2})),
+			data.NewFrame("", data.NewField("", data.Labels{"app": "checkout", "component": "api", "pod": "b"}, []float64{0})),
+		},
+	}
+
+	t.Run("labels are templated after evaluation", func(t *testing.T) {
+		c := Condition{
+			RefID:          "A",
+			Threshold:      &Threshold{Operator: GreaterThan, Value: 1},
+			LabelTemplates: []LabelTemplate{{Name: "service", Template: "{{app}}-{{component}}", RemoveReferenced: true}},
+		}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Equal(t, Results{
+			{Instance: data.Labels{"service": "checkout-api", "pod": "a", RefIDLabel: "A"}, State: Alerting, Value: nullableFloat(2)},
+			{Instance: data.Labels{"service": "checkout-api", "pod": "b", RefIDLabel: "A"}, State: Normal, Value: nullableFloat(0)},
+		}, results)
+	})
+
+	t.Run("alert instances must be uniquely identified by their templated labels", func(t *testing.T) {
+		c := Condition{
+			RefID:          "A",
+			Threshold:      &Threshold{Operator: GreaterThan, Value: 1},
+			LabelTemplates: []LabelTemplate{{Name: "service", Template: "{{app}}", RemoveReferenced: true}, {Name: "pod", Template: ""}},
+		}
+		_, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.EqualError(t, err, "alert instances cannot uniquely be identified by their templated labels: __ref_id__=A, component=api, service=checkout")
+
+		results, err := EvaluateExecutionResult(&c, &execResults, LenientEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, Error, results[0].State)
+	})
+}
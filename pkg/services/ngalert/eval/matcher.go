@@ -0,0 +1,122 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// MatchType is the comparison of a label matcher.
+type MatchType string
+
+const (
+	// MatchEqual matches labels equal to the value.
+	MatchEqual MatchType = "="
+	// MatchNotEqual matches labels not equal to the value.
+	MatchNotEqual MatchType = "!="
+	// MatchRegexp matches labels fully matching the regular expression.
+	MatchRegexp MatchType = "=~"
+	// MatchNotRegexp matches labels not fully matching the regular expression.
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher matches the alert instances having a label compared to a value.
+// A missing label matches like an empty one.
+type LabelMatcher struct {
+	Name  string    `json:"name"`
+	Type  MatchType `json:"type"`
+	Value string    `json:"value"`
+}
+
+// maxCachedRegexps is the maximum number of compiled regular expressions of label matchers kept in the cache.
+const maxCachedRegexps = 1000
+
+var (
+	regexpsMu sync.Mutex
+	// regexps are the compiled regular expressions of label matchers by value.
+	regexps = make(map[string]*regexp.Regexp)
+)
+
+// matcherRegexp returns the compiled regular expression fully matching the value,
+// caching it until there are maxCachedRegexps of them.
+func matcherRegexp(value string) (*regexp.Regexp, error) {
+	regexpsMu.Lock()
+	defer regexpsMu.Unlock()
+
+	if re, ok := regexps[value]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile("^(?:" + value + ")$")
+	if err != nil {
+		return nil, err
+	}
+	if len(regexps) < maxCachedRegexps {
+		regexps[value] = re
+	}
+	return re, nil
+}
+
+// Validate checks that the label matcher has a label name, a supported type
+// and, for regular expression matchers, a valid regular expression.
+func (m LabelMatcher) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("label matcher has no label name")
+	}
+
+	switch m.Type {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		if _, err := matcherRegexp(m.Value); err != nil {
+			return fmt.Errorf("invalid regular expression of label matcher %q: %w", m.Name, err)
+		}
+	default:
+		return fmt.Errorf("invalid label matcher type: %q", m.Type)
+	}
+	return nil
+}
+
+// Matches returns true if the labels match the label matcher, so that evaluation and notification routing
+// share the same semantics. Regular expressions are compiled once and cached.
+// A label matcher that isn't valid matches no labels.
+func (m LabelMatcher) Matches(labels data.Labels) bool {
+	v := labels[m.Name]
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp, MatchNotRegexp:
+		re, err := matcherRegexp(m.Value)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(v) == (m.Type == MatchRegexp)
+	default:
+		return false
+	}
+}
+
+// labelMatchers are validated label matchers.
+type labelMatchers []LabelMatcher
+
+// newLabelMatchers validates the label matchers.
+func newLabelMatchers(matchers []LabelMatcher) (labelMatchers, error) {
+	for _, m := range matchers {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return matchers, nil
+}
+
+// matches returns true if the labels match every label matcher.
+func (ms labelMatchers) matches(labels data.Labels) bool {
+	for _, m := range ms {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateExecutionResultWithLabelMatchers(t *testing.T) {
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("", data.NewField("", data.Labels{"env": "prod", "host": "web-1"}, []*float64{nullableFloat(1)})),
+			data.NewFrame("", data.NewField("", data.Labels{"env": "prod", "host": "db-1"}, []*float64{nullableFloat(1)})),
+			data.NewFrame("", data.NewField("", data.Labels{"env": "dev", "host": "web-2"}, []*float64{nullableFloat(1)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "web-3"}, []*float64{nullableFloat(1)})),
+		},
+	}
+
+	testCases := []struct {
+		desc          string
+		matchers      []LabelMatcher
+		expectedHosts []string
+	}{
+		{
+			desc:          "without matchers every alert instance is evaluated",
+			expectedHosts: []string{"web-1", "db-1", "web-2", "web-3"},
+		},
+		{
+			desc:          "equal matchers",
+			matchers:      []LabelMatcher{{Name: "env", Type: MatchEqual, Value: "prod"}},
+			expectedHosts: []string{"web-1", "db-1"},
+		},
+		{
+			desc:          "not equal matchers match missing labels",
+			matchers:      []LabelMatcher{{Name: "env", Type: MatchNotEqual, Value: "prod"}},
+			expectedHosts: []string{"web-2", "web-3"},
+		},
+		{
+			desc:          "regular expression matchers match the whole label",
+			matchers:      []LabelMatcher{{Name: "host", Type: MatchRegexp, Value: "web-[12]"}},
+			expectedHosts: []string{"web-1", "web-2"},
+		},
+		{
+			desc: "every matcher should match",
+			matchers: []LabelMatcher{
+				{Name: "env", Type: MatchEqual, Value: "prod"},
+				{Name: "host", Type: MatchNotRegexp, Value: "db-.*"},
+			},
+			expectedHosts: []string{"web-1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := Condition{LabelMatchers: tc.matchers}
+			results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+			require.NoError(t, err)
+
+			hosts := make([]string, 0, len(results))
+			for _, r := range results {
+				hosts = append(hosts, r.Instance["host"])
+			}
+			require.Equal(t, tc.expectedHosts, hosts)
+		})
+	}
+}
+
+func TestLabelMatcherMatches(t *testing.T) {
+	labels := data.Labels{"env": "prod", "host": "web-1"}
+
+	require.True(t, LabelMatcher{Name: "env", Type: MatchEqual, Value: "prod"}.Matches(labels))
+	require.False(t, LabelMatcher{Name: "env", Type: MatchNotEqual, Value: "prod"}.Matches(labels))
+	require.True(t, LabelMatcher{Name: "host", Type: MatchRegexp, Value: "web-.*"}.Matches(labels))
+	require.False(t, LabelMatcher{Name: "host", Type: MatchRegexp, Value: "web"}.Matches(labels), "regular expressions are anchored")
+	require.True(t, LabelMatcher{Name: "host", Type: MatchNotRegexp, Value: "db-.*"}.Matches(labels))
+	require.True(t, LabelMatcher{Name: "region", Type: MatchEqual, Value: ""}.Matches(labels), "missing labels are empty")
+
+	require.False(t, LabelMatcher{Name: "host", Type: MatchRegexp, Value: "("}.Matches(labels))
+	require.False(t, LabelMatcher{Name: "host", Type: MatchNotRegexp, Value: "("}.Matches(labels))
+	require.False(t, LabelMatcher{Name: "host", Type: "~", Value: "web-1"}.Matches(labels))
+
+	t.Run("compiled regular expressions are cached", func(t *testing.T) {
+		re, err := matcherRegexp("web-.*")
+		require.NoError(t, err)
+		cached, err := matcherRegexp("web-.*")
+		require.NoError(t, err)
+		require.Same(t, re, cached)
+	})
+}
@@ -0,0 +1,165 @@
+package eval
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics contains the instrumentation of condition executions and evaluations.
+// A nil *Metrics records nothing.
+type Metrics struct {
+	evalDuration *prometheus.HistogramVec
+	evalOutcomes *prometheus.CounterVec
+	cacheHits    prometheus.Counter
+	cacheMisses  prometheus.Counter
+
+	// datasourceTypes contains the types of the labeled datasources by org and id,
+	// so that they're looked up once rather than on every execution.
+	datasourceTypes sync.Map
+}
+
+// datasourceKey identifies a datasource of an org.
+type datasourceKey struct {
+	orgID int64
+	id    int64
+}
+
+var (
+	defaultMetricsOnce sync.Once
+	defaultMetrics     *Metrics
+)
+
+// DefaultMetrics returns the evaluation metrics registered with the default registerer,
+// which are only created and registered by the first call.
+func DefaultMetrics() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics = NewMetrics(prometheus.DefaultRegisterer)
+	})
+	return defaultMetrics
+}
+
+// NewMetrics creates the evaluation metrics and registers them with the provided registerer.
+func NewMetrics(r prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		evalDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "grafana",
+			Subsystem: "alerting",
+			Name:      "ngalert_evaluation_duration_seconds",
+			Help:      "Duration of the alert condition executions.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"datasource"}),
+		evalOutcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "grafana",
+			Subsystem: "alerting",
+			Name:      "ngalert_evaluation_outcomes_total",
+			Help:      "The total number of evaluated alert instances by state.",
+		}, []string{"state"}),
+		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "grafana",
+			Subsystem: "alerting",
+			Name:      "ngalert_execution_cache_hits_total",
+			Help:      "The total number of alert condition executions served from the cache.",
+		}),
+		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "grafana",
+			Subsystem: "alerting",
+			Name:      "ngalert_execution_cache_misses_total",
+			Help:      "The total number of alert condition executions not found in the cache.",
+		}),
+	}
+
+	r.MustRegister(m.evalDuration, m.evalOutcomes, m.cacheHits, m.cacheMisses)
+	return m
+}
+
+// observeDuration records the duration of a condition execution.
+func (m *Metrics) observeDuration(datasource string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.evalDuration.WithLabelValues(datasource).Observe(d.Seconds())
+}
+
+// observeState records an evaluated state.
+func (m *Metrics) observeState(s state) {
+	if m == nil {
+		return
+	}
+	m.evalOutcomes.WithLabelValues(strings.ToLower(s.String())).Inc()
+}
+
+// observeCacheHit records a condition execution served from the cache.
+func (m *Metrics) observeCacheHit() {
+	if m == nil {
+		return
+	}
+	m.cacheHits.Inc()
+}
+
+// observeCacheMiss records a condition execution not found in the cache.
+func (m *Metrics) observeCacheMiss() {
+	if m == nil {
+		return
+	}
+	m.cacheMisses.Inc()
+}
+
+// ObserveResults records the state of each evaluated alert instance.
+func (m *Metrics) ObserveResults(results Results) {
+	for _, r := range results {
+		m.observeState(r.State)
+	}
+}
+
+// datasourceLabel returns the datasource type of the condition queries, "expression" if it only
+// has expressions, or "mixed" if they use datasources of more than one type, so that the label
+// values are bounded by the installed datasource plugins rather than by the datasource names.
+func (m *Metrics) datasourceLabel(c *Condition, orgID int64) string {
+	label := ""
+	types := make(map[int64]string, len(c.QueriesAndExpressions))
+	for i := range c.QueriesAndExpressions {
+		q := &c.QueriesAndExpressions[i]
+		isExpression, err := q.IsExpression()
+		if err != nil || isExpression {
+			continue
+		}
+
+		dsType, ok := types[q.DatasourceID]
+		if !ok {
+			dsType = m.datasourceType(q.DatasourceID, orgID)
+			types[q.DatasourceID] = dsType
+		}
+		switch label {
+		case "":
+			label = dsType
+		case dsType:
+		default:
+			return "mixed"
+		}
+	}
+	if label == "" {
+		return "expression"
+	}
+	return label
+}
+
+// datasourceType returns the type of the datasource of the org, or "unknown" if it can't be found.
+// Found types are cached, since the type of a datasource doesn't change.
+func (m *Metrics) datasourceType(id, orgID int64) string {
+	key := datasourceKey{orgID: orgID, id: id}
+	if dsType, ok := m.datasourceTypes.Load(key); ok {
+		return dsType.(string)
+	}
+
+	query := &models.GetDataSourceByIdQuery{Id: id, OrgId: orgID}
+	if err := bus.Dispatch(query); err != nil || query.Result == nil {
+		return "unknown"
+	}
+	m.datasourceTypes.Store(key, query.Result.Type)
+	return query.Result.Type
+}
@@ -0,0 +1,123 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsObserveResults(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.ObserveResults(Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting},
+		{Instance: data.Labels{"host": "b"}, State: Alerting},
+		{Instance: data.Labels{"host": "c"}, State: NoData},
+	})
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.evalOutcomes.WithLabelValues("alerting")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.evalOutcomes.WithLabelValues("nodata")))
+	require.Equal(t, float64(0), testutil.ToFloat64(m.evalOutcomes.WithLabelValues("normal")))
+}
+
+func TestConditionDatasourceLabel(t *testing.T) {
+	lookups := 0
+	bus.AddHandler("test", func(query *models.GetDataSourceByIdQuery) error {
+		lookups++
+		types := map[int64]string{1: "prometheus", 2: "prometheus", 3: "loki"}
+		dsType, ok := types[query.Id]
+		if !ok {
+			return models.ErrDataSourceNotFound
+		}
+		query.Result = &models.DataSource{Id: query.Id, OrgId: query.OrgId, Type: dsType}
+		return nil
+	})
+	t.Cleanup(bus.ClearBusHandlers)
+
+	query := func(refID string, datasourceID int64) AlertQuery {
+		return AlertQuery{
+			RefID: refID,
+			Model: json.RawMessage(fmt.Sprintf(`{"datasource": "datasource %d", "datasourceId": %d}`, datasourceID, datasourceID)),
+		}
+	}
+	expression := AlertQuery{RefID: "E", Model: json.RawMessage(`{"datasource": "__expr__"}`)}
+
+	m := NewMetrics(prometheus.NewRegistry())
+	c := Condition{QueriesAndExpressions: []AlertQuery{expression}}
+	require.Equal(t, "expression", m.datasourceLabel(&c, 1))
+
+	c.QueriesAndExpressions = append(c.QueriesAndExpressions, query("A", 1), query("B", 2))
+	require.Equal(t, "prometheus", m.datasourceLabel(&c, 1), "datasources of the same type share their label")
+
+	c.QueriesAndExpressions = append(c.QueriesAndExpressions, query("C", 3))
+	require.Equal(t, "mixed", m.datasourceLabel(&c, 1))
+	require.Equal(t, 3, lookups)
+	require.Equal(t, "mixed", m.datasourceLabel(&c, 1))
+	require.Equal(t, 3, lookups, "the types of the datasources are only looked up once")
+
+	c.QueriesAndExpressions = []AlertQuery{query("D", 4)}
+	require.Equal(t, "unknown", m.datasourceLabel(&c, 1))
+}
+
+func TestDefaultMetrics(t *testing.T) {
+	require.Same(t, DefaultMetrics(), DefaultMetrics(), "the default metrics are only registered once")
+}
+
+func TestMetricsObserveEvaluation(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	ctx := AlertExecCtx{Ctx: context.Background(), Clock: clock.NewMock(), Metrics: m}
+	ctx.TransformClient = TransformFunc(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		return &backend.QueryDataResponse{Responses: backend.Responses{
+			"A": {Frames: data.Frames{
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []float64{2})),
+				data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []float64{0})),
+			}},
+		}}, nil
+	})
+
+	c := Condition{
+		RefID:                 "A",
+		QueriesAndExpressions: []AlertQuery{{RefID: "A", Model: json.RawMessage(`{"datasource": "__expr__", "type": "math", "expression": "1"}`)}},
+		Threshold:             &Threshold{Operator: GreaterThan, Value: 1},
+	}
+	execResults, err := c.Execute(ctx, "", "")
+	require.NoError(t, err)
+	_, err = EvaluateExecutionResult(&c, execResults, StrictEvaluation)
+	require.NoError(t, err)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(m.evalOutcomes.WithLabelValues("alerting")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.evalOutcomes.WithLabelValues("normal")))
+	require.Equal(t, 1, testutil.CollectAndCount(m.evalDuration))
+}
+
+func TestExecuteWithoutMetrics(t *testing.T) {
+	bus.AddHandler("test", func(query *models.GetDataSourceByIdQuery) error {
+		t.Fatal("the datasources of the condition are looked up without metrics to label")
+		return nil
+	})
+	t.Cleanup(bus.ClearBusHandlers)
+
+	ctx := AlertExecCtx{Ctx: context.Background(), Clock: clock.NewMock()}
+	ctx.TransformClient = TransformFunc(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+		return &backend.QueryDataResponse{Responses: backend.Responses{
+			"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []float64{2}))}},
+		}}, nil
+	})
+
+	c := Condition{
+		RefID:                 "A",
+		QueriesAndExpressions: []AlertQuery{{RefID: "A", Model: json.RawMessage(`{"datasource": "datasource 1", "datasourceId": 1}`)}},
+	}
+	_, err := c.Execute(ctx, "", "")
+	require.NoError(t, err)
+}
@@ -0,0 +1,38 @@
+package eval
+
+import "fmt"
+
+// NoDataState is the state of the alert instances of a condition that returned no data.
+type NoDataState string
+
+const (
+	// NoDataStateNoData evaluates alert instances without data to NoData.
+	NoDataStateNoData NoDataState = "no_data"
+	// NoDataStateAlerting evaluates alert instances without data to Alerting.
+	NoDataStateAlerting NoDataState = "alerting"
+	// NoDataStateOK evaluates alert instances without data to Normal.
+	NoDataStateOK NoDataState = "ok"
+)
+
+// validate checks that the no data state is supported.
+func (s NoDataState) validate() error {
+	switch s {
+	case NoDataStateNoData, NoDataStateAlerting, NoDataStateOK:
+		return nil
+	default:
+		return fmt.Errorf("invalid no data state: %q", s)
+	}
+}
+
+// state returns the evaluation state of an alert instance without data.
+// If the no data state is missing, it's NoData.
+func (s NoDataState) state() state {
+	switch s {
+	case NoDataStateAlerting:
+		return Alerting
+	case NoDataStateOK:
+		return Normal
+	default:
+		return NoData
+	}
+}
@@ -0,0 +1,48 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// NonFiniteState is the state of the alert instances whose value is NaN or infinite,
+// which usually results from broken math, e.g. a division by zero, rather than from a value
+// that should fire.
+type NonFiniteState string
+
+const (
+	// NonFiniteStateError evaluates alert instances with a non-finite value to Error.
+	NonFiniteStateError NonFiniteState = "error"
+	// NonFiniteStateNoData evaluates alert instances with a non-finite value to NoData.
+	NonFiniteStateNoData NonFiniteState = "no_data"
+	// NonFiniteStateAlerting evaluates alert instances with a non-finite value to Alerting.
+	NonFiniteStateAlerting NonFiniteState = "alerting"
+)
+
+// validate checks that the non-finite state is supported.
+func (s NonFiniteState) validate() error {
+	switch s {
+	case NonFiniteStateError, NonFiniteStateNoData, NonFiniteStateAlerting:
+		return nil
+	default:
+		return fmt.Errorf("invalid non-finite state: %q", s)
+	}
+}
+
+// state returns the evaluation state of an alert instance with a non-finite value.
+// If the non-finite state is missing, it's Error so that operators notice.
+func (s NonFiniteState) state() state {
+	switch s {
+	case NonFiniteStateNoData:
+		return NoData
+	case NonFiniteStateAlerting:
+		return Alerting
+	default:
+		return Error
+	}
+}
+
+// isFinite returns true if the value is neither NaN nor infinite.
+func isFinite(val float64) bool {
+	return !math.IsNaN(val) && !math.IsInf(val, 0)
+}
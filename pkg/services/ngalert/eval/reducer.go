@@ -0,0 +1,219 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// ErrNoValue is returned by a Reducer if the field has no value to reduce to,
+// in which case the alert instance is evaluated according to the NoDataState.
+var ErrNoValue = errors.New("no value to reduce to")
+
+// Reducer reduces the values of a multi-row field into a single value.
+type Reducer func(field *data.Field) (float64, error)
+
+// ReducerType is the name of a function that reduces the values
+// of a multi-row field into a single value.
+type ReducerType string
+
+const (
+	// ReduceLast reduces the field to its last non-null value.
+	ReduceLast ReducerType = "last"
+	// ReduceMin reduces the field to its minimum non-null value.
+	ReduceMin ReducerType = "min"
+	// ReduceMax reduces the field to its maximum non-null value.
+	ReduceMax ReducerType = "max"
+	// ReduceMean reduces the field to the mean of its non-null values.
+	ReduceMean ReducerType = "mean"
+	// ReduceSum reduces the field to the sum of its non-null values.
+	ReduceSum ReducerType = "sum"
+	// ReduceCount reduces the field to the number of its non-null values.
+	ReduceCount ReducerType = "count"
+	// ReduceMedian reduces the field to the median of its non-null values.
+	ReduceMedian ReducerType = "median"
+)
+
+var (
+	reducersMu sync.RWMutex
+	reducers   = map[ReducerType]Reducer{
+		ReduceLast:   Last,
+		ReduceMin:    Min,
+		ReduceMax:    Max,
+		ReduceMean:   Mean,
+		ReduceSum:    Sum,
+		ReduceCount:  Count,
+		ReduceMedian: Median,
+	}
+)
+
+// RegisterReducer registers a reducer under the name so that conditions can use it.
+// It returns an error if a reducer is already registered under the name.
+func RegisterReducer(name ReducerType, r Reducer) error {
+	reducersMu.Lock()
+	defer reducersMu.Unlock()
+
+	if _, ok := reducers[name]; ok {
+		return fmt.Errorf("reducer %q is already registered", name)
+	}
+	reducers[name] = r
+	return nil
+}
+
+// GetReducer returns the reducer registered under the name.
+func GetReducer(name ReducerType) (Reducer, bool) {
+	reducersMu.RLock()
+	defer reducersMu.RUnlock()
+
+	r, ok := reducers[name]
+	return r, ok
+}
+
+// validate checks that the reducer is registered.
+func (r ReducerType) validate() error {
+	if _, ok := GetReducer(r); !ok {
+		return fmt.Errorf("invalid reducer: %q", r)
+	}
+	return nil
+}
+
+// reduce collapses the values of the field into a single value using the registered reducer.
+// It returns false if there is no value to reduce to.
+func (r ReducerType) reduce(field *data.Field) (float64, bool, error) {
+	reducer, ok := GetReducer(r)
+	if !ok {
+		return 0, false, fmt.Errorf("invalid reducer: %q", r)
+	}
+
+	val, err := reducer(field)
+	if errors.Is(err, ErrNoValue) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return val, true, nil
+}
+
+// values returns the non-null values of the field.
+func values(field *data.Field) ([]float64, error) {
+	vals := make([]float64, 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		if _, ok := field.ConcreteAt(i); !ok {
+			continue
+		}
+		val, err := field.FloatAt(i)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
+// Last reduces the field to its last non-null value.
+func Last(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, ErrNoValue
+	}
+	return vals[len(vals)-1], nil
+}
+
+// Min reduces the field to its minimum non-null value.
+func Min(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, ErrNoValue
+	}
+	min := vals[0]
+	for _, val := range vals[1:] {
+		if val < min {
+			min = val
+		}
+	}
+	return min, nil
+}
+
+// Max reduces the field to its maximum non-null value.
+func Max(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, ErrNoValue
+	}
+	max := vals[0]
+	for _, val := range vals[1:] {
+		if val > max {
+			max = val
+		}
+	}
+	return max, nil
+}
+
+// Mean reduces the field to the mean of its non-null values.
+func Mean(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, ErrNoValue
+	}
+	return sum(vals) / float64(len(vals)), nil
+}
+
+// Sum reduces the field to the sum of its non-null values, which is 0 if there is none.
+func Sum(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	return sum(vals), nil
+}
+
+// Count reduces the field to the number of its non-null values.
+func Count(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(vals)), nil
+}
+
+// Median reduces the field to the median of its non-null values,
+// which is the mean of the two middle values if there is an even number of them.
+func Median(field *data.Field) (float64, error) {
+	vals, err := values(field)
+	if err != nil {
+		return 0, err
+	}
+	if len(vals) == 0 {
+		return 0, ErrNoValue
+	}
+	sort.Float64s(vals)
+	mid := len(vals) / 2
+	if len(vals)%2 == 0 {
+		return (vals[mid-1] + vals[mid]) / 2, nil
+	}
+	return vals[mid], nil
+}
+
+func sum(vals []float64) float64 {
+	var acc float64
+	for _, val := range vals {
+		acc += val
+	}
+	return acc
+}
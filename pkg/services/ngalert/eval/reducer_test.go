@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReducerReduce(t *testing.T) {
+	field := data.NewField("", nil, []*float64{nullableFloat(3), nil, nullableFloat(1), nullableFloat(5), nil})
+
+	testCases := []struct {
+		reducer       ReducerType
+		expectedValue float64
+	}{
+		{reducer: ReduceLast, expectedValue: 5},
+		{reducer: ReduceMin, expectedValue: 1},
+		{reducer: ReduceMax, expectedValue: 5},
+		{reducer: ReduceMean, expectedValue: 3},
+		{reducer: ReduceSum, expectedValue: 9},
+		{reducer: ReduceCount, expectedValue: 3},
+		{reducer: ReduceMedian, expectedValue: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.reducer), func(t *testing.T) {
+			val, ok, err := tc.reducer.reduce(field)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, tc.expectedValue, val)
+		})
+	}
+
+	t.Run("all null values have no mean", func(t *testing.T) {
+		_, ok, err := ReduceMean.reduce(data.NewField("", nil, []*float64{nil, nil}))
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("the median of an even number of values is the mean of the middle ones", func(t *testing.T) {
+		val, err := Median(data.NewField("", nil, []float64{4, 1, 3, 2}))
+		require.NoError(t, err)
+		require.Equal(t, 2.5, val)
+	})
+}
+
+func TestRegisterReducer(t *testing.T) {
+	const name ReducerType = "test_first"
+	t.Cleanup(func() {
+		reducersMu.Lock()
+		delete(reducers, name)
+		reducersMu.Unlock()
+	})
+
+	require.EqualError(t, name.validate(), `invalid reducer: "test_first"`)
+
+	err := RegisterReducer(name, func(field *data.Field) (float64, error) {
+		if field.Len() == 0 {
+			return 0, ErrNoValue
+		}
+		return field.FloatAt(0)
+	})
+	require.NoError(t, err)
+	require.NoError(t, name.validate())
+
+	val, ok, err := name.reduce(data.NewField("", nil, []float64{7, 8}))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, float64(7), val)
+
+	err = RegisterReducer(ReduceLast, Last)
+	require.EqualError(t, err, `reducer "last" is already registered`)
+}
+
+func TestEvaluateExecutionResultWithReducer(t *testing.T) {
+	now := time.Now()
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("",
+				data.NewField("time", nil, []time.Time{now.Add(-time.Minute), now}),
+				data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(90), nullableFloat(70)}),
+			),
+		},
+	}
+
+	t.Run("multi-row frames are rejected without a reducer", func(t *testing.T) {
+		_, err := EvaluateExecutionResult(&Condition{}, &execResults, StrictEvaluation)
+		require.Error(t, err)
+	})
+
+	t.Run("multi-row frames are reduced before the threshold is applied", func(t *testing.T) {
+		c := Condition{
+			Reducer:   ReduceMean,
+			Threshold: &Threshold{Operator: GreaterThan, Value: 75},
+		}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, Alerting, results[0].State)
+		require.Equal(t, nullableFloat(80), results[0].Value)
+		require.Equal(t, data.Labels{"host": "a", RefIDLabel: ""}, results[0].Instance)
+	})
+}
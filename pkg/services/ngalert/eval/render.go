@@ -0,0 +1,38 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Render writes the results as a human-readable table of the labels, state and value
+// of each alert instance, sorted by labels, for command line and debug output.
+func (evalResults Results) Render(w io.Writer) error {
+	sorted := make(Results, len(evalResults))
+	copy(sorted, evalResults)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return instanceKey(sorted[i].Instance) < instanceKey(sorted[j].Instance)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "INSTANCE\tSTATE\tVALUE"); err != nil {
+		return err
+	}
+	for _, r := range sorted {
+		if _, err := fmt.Fprintf(tw, "{%s}\t%s\t%s\n", r.Instance, r.State, renderValue(r.Value)); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// renderValue formats the value of an alert instance, or "-" if it has none.
+func renderValue(val *float64) string {
+	if val == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*val, 'g', -1, 64)
+}
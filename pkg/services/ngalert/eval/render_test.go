@@ -0,0 +1,30 @@
+package eval
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultsRender(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "b"}, State: NoData},
+		{Instance: data.Labels{"host": "a", "env": "prod"}, State: Alerting, Value: nullableFloat(95.5)},
+		{Instance: data.Labels{"host": "c"}, State: Error, Value: nullableFloat(math.NaN())},
+		{Instance: data.Labels{}, State: Normal, Value: nullableFloat(1e21)},
+	}
+
+	var buf bytes.Buffer
+	err := results.Render(&buf)
+	require.NoError(t, err)
+	require.Equal(t, `INSTANCE            STATE     VALUE
+{}                  Normal    1e+21
+{env=prod, host=a}  Alerting  95.5
+{host=b}            NoData    -
+{host=c}            Error     NaN
+`, buf.String())
+	require.Equal(t, NoData, results[0].State, "the results aren't sorted in place")
+}
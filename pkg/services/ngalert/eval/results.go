@@ -0,0 +1,424 @@
+package eval
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// RefIDLabel is the label of evaluated alert instances holding the RefID they were evaluated for.
+	RefIDLabel = "__ref_id__"
+
+	// FieldNameLabel is the label of the alert instances of a wide frame holding the name of their field.
+	FieldNameLabel = "__field__"
+
+	// ThresholdRuleLabel is the label of the alert instances matching a threshold rule holding its name.
+	ThresholdRuleLabel = "__threshold_rule__"
+)
+
+// withLabel returns a copy of the labels with the label set to the value.
+// If the labels already have the label, such as one set by the query, they're returned unchanged.
+func withLabel(labels data.Labels, name, value string) data.Labels {
+	if _, ok := labels[name]; ok {
+		return labels
+	}
+	withValue := make(data.Labels, len(labels)+1)
+	for n, v := range labels {
+		withValue[n] = v
+	}
+	withValue[name] = value
+	return withValue
+}
+
+// instanceKey returns the canonical representation of the labels identifying an alert instance.
+// Labels are sorted by name, and names and values are quoted so that, unlike data.Labels.String,
+// different labels can't have the same key (e.g. {a="1, b=2"} and {a="1", b="2"}).
+func instanceKey(labels data.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(strconv.Quote(name))
+		sb.WriteString("=")
+		sb.WriteString(strconv.Quote(labels[name]))
+	}
+	return sb.String()
+}
+
+// Firing is the change of the alerting state of an alert instance between two evaluations.
+type Firing int
+
+const (
+	// NotFiring is an alert instance that is alerting neither now nor previously.
+	NotFiring Firing = iota
+	// NewlyFiring is an alert instance that is alerting now but wasn't previously.
+	NewlyFiring
+	// StillFiring is an alert instance that is alerting now and was previously.
+	StillFiring
+	// Recovered is an alert instance that was alerting previously but isn't now.
+	Recovered
+)
+
+func (f Firing) String() string {
+	return [...]string{"NotFiring", "NewlyFiring", "StillFiring", "Recovered"}[f]
+}
+
+// EvaluateWithHistory evaluates the ExecutionResults of the condition like EvaluateExecutionResult
+// and sets how the alerting state of each alert instance changed since the previous results, if any.
+// Alert instances are matched by their labels, and alert instances missing from the previous results
+// were not alerting. Alert instances missing from the current results are not returned.
+func EvaluateWithHistory(c *Condition, results *ExecutionResults, mode EvaluationMode, previous Results) (Results, error) {
+	evalResults, err := EvaluateExecutionResult(c, results, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	wasAlerting := make(map[string]bool, len(previous))
+	for _, r := range previous {
+		wasAlerting[instanceKey(r.Instance)] = r.State == Alerting
+	}
+
+	for i := range evalResults {
+		r := &evalResults[i]
+		previouslyAlerting := wasAlerting[instanceKey(r.Instance)]
+		switch {
+		case r.State == Alerting && previouslyAlerting:
+			r.Firing = StillFiring
+		case r.State == Alerting:
+			r.Firing = NewlyFiring
+		case previouslyAlerting:
+			r.Firing = Recovered
+		default:
+			r.Firing = NotFiring
+		}
+	}
+	return evalResults, nil
+}
+
+// Transition is the change of state of an alert instance between two evaluations.
+type Transition struct {
+	Instance data.Labels
+	From     state
+	To       state
+}
+
+// Diff returns the transitions of the alert instances whose state differs from the previous results.
+// Alert instances are matched by their labels, and alert instances missing from the previous results
+// are transitions from Normal, so new Normal alert instances have none.
+func (evalResults Results) Diff(previous Results) []Transition {
+	// unchanged results are the common case between evaluations
+	if evalResults.Equal(previous) {
+		return []Transition{}
+	}
+
+	previousStates := make(map[string]state, len(previous))
+	for _, r := range previous {
+		previousStates[instanceKey(r.Instance)] = r.State
+	}
+
+	transitions := make([]Transition, 0)
+	for _, r := range evalResults {
+		from, ok := previousStates[instanceKey(r.Instance)]
+		if !ok {
+			from = Normal
+		}
+		if from == r.State {
+			continue
+		}
+		transitions = append(transitions, Transition{
+			Instance: r.Instance,
+			From:     from,
+			To:       r.State,
+		})
+	}
+	return transitions
+}
+
+// Equal returns true if both results have the same alert instances, matched by their labels in any order,
+// with the same state and value. NaN values are equal to each other.
+func (evalResults Results) Equal(other Results) bool {
+	if len(evalResults) != len(other) {
+		return false
+	}
+
+	byKey := make(map[string]result, len(other))
+	for _, r := range other {
+		byKey[instanceKey(r.Instance)] = r
+	}
+	if len(byKey) != len(other) {
+		// alert instances with the same labels can't be matched
+		return false
+	}
+
+	for _, r := range evalResults {
+		o, ok := byKey[instanceKey(r.Instance)]
+		if !ok || o.State != r.State || !equalValues(o.Value, r.Value) {
+			return false
+		}
+		delete(byKey, instanceKey(r.Instance))
+	}
+	return true
+}
+
+// equalValues returns true if both values are missing, or are equal or NaN.
+func equalValues(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b || (math.IsNaN(*a) && math.IsNaN(*b))
+}
+
+// Hash returns a hash of the labels, state and value of the alert instances, which are what
+// AsDataFrame renders, regardless of their order. Results with the same hash can share their frame.
+func (evalResults Results) Hash() uint64 {
+	type hashed struct {
+		key string
+		r   result
+	}
+	sorted := make([]hashed, 0, len(evalResults))
+	for _, r := range evalResults {
+		sorted = append(sorted, hashed{key: instanceKey(r.Instance), r: r})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].key < sorted[j].key
+	})
+
+	h := fnv.New64a()
+	buf := make([]byte, 10)
+	for _, e := range sorted {
+		// hash.Hash doesn't fail on writes
+		_, _ = h.Write([]byte(e.key))
+		buf[0] = 0
+		buf[1] = byte(e.r.State)
+		switch {
+		case e.r.Value == nil:
+			binary.BigEndian.PutUint64(buf[2:], 0)
+			buf[0] = 1
+		case math.IsNaN(*e.r.Value):
+			// NaN values have many representations
+			binary.BigEndian.PutUint64(buf[2:], math.Float64bits(math.NaN()))
+		default:
+			binary.BigEndian.PutUint64(buf[2:], math.Float64bits(*e.r.Value))
+		}
+		_, _ = h.Write(buf)
+	}
+	return h.Sum64()
+}
+
+// IsFiring returns true if any evaluated alert instance is alerting.
+func (evalResults Results) IsFiring() bool {
+	for _, r := range evalResults {
+		if r.State == Alerting {
+			return true
+		}
+	}
+	return false
+}
+
+// FiringCount returns the number of evaluated alert instances that are alerting.
+func (evalResults Results) FiringCount() int {
+	count := 0
+	for _, r := range evalResults {
+		if r.State == Alerting {
+			count++
+		}
+	}
+	return count
+}
+
+// ByState returns the labels of the evaluated alert instances grouped by their state.
+func (evalResults Results) ByState() map[state][]data.Labels {
+	byState := make(map[state][]data.Labels)
+	for _, r := range evalResults {
+		byState[r.State] = append(byState[r.State], r.Instance)
+	}
+	return byState
+}
+
+// labelNameSeparators are the separators of the segments of hierarchical label names,
+// e.g. "topology.kubernetes.io/zone".
+const labelNameSeparators = "./"
+
+// FlatLabels returns the labels of the alert instance with the segments of hierarchical label names
+// joined by sep instead, e.g. {"topology_kubernetes_io_zone": "a"} with "_", so that they can be used
+// where such names aren't allowed. If several names flatten to the same one, the value of the first
+// name in lexicographic order is kept.
+func (r result) FlatLabels(sep string) map[string]string {
+	names := make([]string, 0, len(r.Instance))
+	for name := range r.Instance {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flat := make(map[string]string, len(names))
+	for _, name := range names {
+		segments := strings.FieldsFunc(name, func(c rune) bool {
+			return strings.ContainsRune(labelNameSeparators, c)
+		})
+		flatName := strings.Join(segments, sep)
+		if _, ok := flat[flatName]; ok {
+			continue
+		}
+		flat[flatName] = r.Instance[name]
+	}
+	return flat
+}
+
+// ResultGroup is a group of evaluated alert instances with the same values of the grouping labels.
+type ResultGroup struct {
+	// Labels are the grouping labels and their values, which are empty for alert instances without them.
+	Labels  data.Labels
+	Results Results
+}
+
+// GroupBy groups the evaluated alert instances by the values of the labels, e.g. to route the alerting
+// instances of each datacenter. Groups are ordered by their first alert instance, which keep their order.
+func (evalResults Results) GroupBy(names ...string) []ResultGroup {
+	groups := make([]ResultGroup, 0)
+	indexes := make(map[string]int)
+	for _, r := range evalResults {
+		labels := make(data.Labels, len(names))
+		for _, name := range names {
+			labels[name] = r.Instance[name]
+		}
+
+		key := instanceKey(labels)
+		i, ok := indexes[key]
+		if !ok {
+			i = len(groups)
+			indexes[key] = i
+			groups = append(groups, ResultGroup{Labels: labels})
+		}
+		groups[i].Results = append(groups[i].Results, r)
+	}
+	return groups
+}
+
+// resultJSON is the canonical encoding of an evaluated alert instance for storing its state over time,
+// independent of the data frame encoding.
+type resultJSON struct {
+	Labels      data.Labels `json:"labels"`
+	State       string      `json:"state"`
+	Value       resultValue `json:"value"`
+	EvaluatedAt time.Time   `json:"evaluatedAt"`
+	Severity    Severity    `json:"severity,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// resultValue is the JSON encoding of the value of an alert instance: null if it has no value, or else
+// a number, except for NaN and infinite values that JSON numbers can't hold, which are the strings
+// "NaN", "+Inf" and "-Inf".
+type resultValue struct {
+	value *float64
+}
+
+func (v resultValue) MarshalJSON() ([]byte, error) {
+	if v.value == nil {
+		return []byte("null"), nil
+	}
+	if !isFinite(*v.value) {
+		return json.Marshal(strconv.FormatFloat(*v.value, 'g', -1, 64))
+	}
+	return []byte(strconv.FormatFloat(*v.value, 'g', -1, 64)), nil
+}
+
+func (v *resultValue) UnmarshalJSON(b []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	switch raw := raw.(type) {
+	case nil:
+		v.value = nil
+	case float64:
+		v.value = &raw
+	case string:
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil || isFinite(val) {
+			return fmt.Errorf("invalid alert instance value: %q", raw)
+		}
+		v.value = &val
+	default:
+		return fmt.Errorf("invalid alert instance value: %s", b)
+	}
+	return nil
+}
+
+// MarshalJSON encodes each alert instance with its labels, keyed by name, its state,
+// its value, its evaluation time in UTC, and its severity and error, if any.
+// Firing and annotations aren't encoded.
+func (evalResults Results) MarshalJSON() ([]byte, error) {
+	encoded := make([]resultJSON, 0, len(evalResults))
+	for _, r := range evalResults {
+		rj := resultJSON{
+			Labels:      r.Instance,
+			State:       r.State.String(),
+			Value:       resultValue{value: r.Value},
+			EvaluatedAt: r.EvaluatedAt.UTC(),
+			Severity:    r.Severity,
+		}
+		if r.Error != nil {
+			rj.Error = r.Error.Error()
+		}
+		encoded = append(encoded, rj)
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes the alert instances encoded by MarshalJSON.
+// The errors of alert instances in Error are decoded to errors with the same message.
+func (evalResults *Results) UnmarshalJSON(b []byte) error {
+	var encoded []resultJSON
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return err
+	}
+
+	decoded := make(Results, 0, len(encoded))
+	for _, rj := range encoded {
+		s, err := parseState(rj.State)
+		if err != nil {
+			return err
+		}
+		r := result{
+			Instance:    rj.Labels,
+			State:       s,
+			Value:       rj.Value.value,
+			EvaluatedAt: rj.EvaluatedAt,
+			Severity:    rj.Severity,
+		}
+		if rj.Error != "" {
+			r.Error = errors.New(rj.Error)
+		}
+		decoded = append(decoded, r)
+	}
+	*evalResults = decoded
+	return nil
+}
+
+// parseState returns the state of its string representation.
+func parseState(s string) (state, error) {
+	for _, st := range []state{Normal, Alerting, NoData, Error} {
+		if st.String() == s {
+			return st, nil
+		}
+	}
+	return Normal, fmt.Errorf("invalid alert instance state: %q", s)
+}
@@ -0,0 +1,300 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultsDiff(t *testing.T) {
+	previous := Results{
+		{Instance: data.Labels{"host": "a"}, State: Normal},
+		{Instance: data.Labels{"host": "b"}, State: Alerting},
+		{Instance: data.Labels{"host": "c"}, State: Alerting},
+	}
+	current := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting},
+		{Instance: data.Labels{"host": "b"}, State: Alerting},
+		{Instance: data.Labels{"host": "c"}, State: Normal},
+		{Instance: data.Labels{"host": "d"}, State: NoData},
+		{Instance: data.Labels{"host": "e"}, State: Normal},
+	}
+
+	require.Equal(t, []Transition{
+		{Instance: data.Labels{"host": "a"}, From: Normal, To: Alerting},
+		{Instance: data.Labels{"host": "c"}, From: Alerting, To: Normal},
+		{Instance: data.Labels{"host": "d"}, From: Normal, To: NoData},
+	}, current.Diff(previous), "new Normal alert instances have no transition")
+
+	require.Empty(t, current.Diff(current))
+}
+
+func TestResultsEqual(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(2)},
+		{Instance: data.Labels{"host": "b"}, State: NoData},
+		{Instance: data.Labels{"host": "c"}, State: Error, Value: nullableFloat(math.NaN())},
+	}
+
+	require.True(t, results.Equal(Results{
+		{Instance: data.Labels{"host": "c"}, State: Error, Value: nullableFloat(math.NaN())},
+		{Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(2), Firing: NewlyFiring},
+		{Instance: data.Labels{"host": "b"}, State: NoData},
+	}), "order and other fields don't matter")
+	require.True(t, Results{}.Equal(nil))
+
+	require.False(t, results.Equal(results[:2]))
+	require.False(t, results.Equal(Results{results[0], results[1], {Instance: data.Labels{"host": "d"}, State: Error, Value: nullableFloat(math.NaN())}}))
+	require.False(t, results.Equal(Results{results[0], results[0], results[1]}))
+	require.False(t, Results{results[0], results[0], results[1]}.Equal(results))
+	require.False(t, results.Equal(Results{{Instance: data.Labels{"host": "a"}, State: Normal, Value: nullableFloat(2)}, results[1], results[2]}))
+	require.False(t, results.Equal(Results{{Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(3)}, results[1], results[2]}))
+	require.False(t, results.Equal(Results{results[0], {Instance: data.Labels{"host": "b"}, State: NoData, Value: nullableFloat(0)}, results[2]}))
+
+	require.Empty(t, results.Diff(results))
+}
+
+func TestEvaluateWithHistory(t *testing.T) {
+	execResults := ExecutionResults{
+		Results: data.Frames{
+			data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(1)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "c"}, []*float64{nullableFloat(0)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "d"}, []*float64{nullableFloat(0)})),
+			data.NewFrame("", data.NewField("", data.Labels{"host": "e"}, []*float64{nullableFloat(1)})),
+		},
+	}
+	previous := Results{
+		{Instance: data.Labels{"host": "a", RefIDLabel: ""}, State: Normal},
+		{Instance: data.Labels{"host": "b", RefIDLabel: ""}, State: Alerting},
+		{Instance: data.Labels{"host": "c", RefIDLabel: ""}, State: Alerting},
+		{Instance: data.Labels{"host": "d", RefIDLabel: ""}, State: Normal},
+	}
+
+	results, err := EvaluateWithHistory(&Condition{}, &execResults, StrictEvaluation, previous)
+	require.NoError(t, err)
+
+	firing := make(map[string]Firing, len(results))
+	for _, r := range results {
+		firing[r.Instance["host"]] = r.Firing
+	}
+	require.Equal(t, map[string]Firing{
+		"a": NewlyFiring,
+		"b": StillFiring,
+		"c": Recovered,
+		"d": NotFiring,
+		"e": NewlyFiring,
+	}, firing)
+
+	t.Run("without previous results", func(t *testing.T) {
+		results, err := EvaluateWithHistory(&Condition{}, &execResults, StrictEvaluation, nil)
+		require.NoError(t, err)
+		require.Equal(t, NewlyFiring, results[0].Firing)
+		require.Equal(t, NotFiring, results[2].Firing)
+	})
+}
+
+func TestResultsIsFiring(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting},
+		{Instance: data.Labels{"host": "b"}, State: Normal},
+		{Instance: data.Labels{"host": "c"}, State: Alerting},
+	}
+	require.True(t, results.IsFiring())
+	require.Equal(t, 2, results.FiringCount())
+
+	results = Results{
+		{Instance: data.Labels{"host": "a"}, State: NoData},
+		{Instance: data.Labels{"host": "b"}, State: Error},
+	}
+	require.False(t, results.IsFiring())
+	require.Zero(t, results.FiringCount())
+	require.False(t, Results{}.IsFiring())
+}
+
+func TestResultsByState(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting},
+		{Instance: data.Labels{"host": "b"}, State: Normal},
+		{Instance: data.Labels{"host": "c"}, State: Alerting},
+		{Instance: data.Labels{"host": "d"}, State: NoData},
+	}
+
+	require.Equal(t, map[state][]data.Labels{
+		Alerting: {{"host": "a"}, {"host": "c"}},
+		Normal:   {{"host": "b"}},
+		NoData:   {{"host": "d"}},
+	}, results.ByState())
+
+	require.Empty(t, Results{}.ByState())
+}
+
+func TestResultFlatLabels(t *testing.T) {
+	r := result{Instance: data.Labels{
+		"topology.kubernetes.io/zone": "eu-west-1a",
+		"app.kubernetes.io/name":      "api",
+		"host":                        "a",
+		"dc_rack":                     "r1",
+		"dc.rack":                     "r2",
+	}}
+
+	require.Equal(t, map[string]string{
+		"topology_kubernetes_io_zone": "eu-west-1a",
+		"app_kubernetes_io_name":      "api",
+		"host":                        "a",
+		"dc_rack":                     "r2",
+	}, r.FlatLabels("_"))
+	require.Empty(t, result{}.FlatLabels("_"))
+}
+
+func TestResultsGroupBy(t *testing.T) {
+	results := Results{
+		{Instance: data.Labels{"datacenter": "eu", "host": "a"}, State: Alerting},
+		{Instance: data.Labels{"datacenter": "us", "host": "b"}, State: Alerting},
+		{Instance: data.Labels{"datacenter": "eu", "host": "c"}, State: Normal},
+		{Instance: data.Labels{"host": "d"}, State: Alerting},
+	}
+
+	require.Equal(t, []ResultGroup{
+		{Labels: data.Labels{"datacenter": "eu"}, Results: Results{results[0], results[2]}},
+		{Labels: data.Labels{"datacenter": "us"}, Results: Results{results[1]}},
+		{Labels: data.Labels{"datacenter": ""}, Results: Results{results[3]}},
+	}, results.GroupBy("datacenter"))
+
+	require.Equal(t, []ResultGroup{{Labels: data.Labels{}, Results: results}}, results.GroupBy())
+	require.Empty(t, Results{}.GroupBy("datacenter"))
+}
+
+func TestInstanceKey(t *testing.T) {
+	names := []string{"host", "cluster", "env", "region", "job"}
+	expected := instanceKey(data.Labels{"host": "a", "cluster": "b", "env": "c", "region": "d", "job": "e"})
+	require.Equal(t, `"cluster"="b","env"="c","host"="a","job"="e","region"="d"`, expected)
+
+	values := map[string]string{"host": "a", "cluster": "b", "env": "c", "region": "d", "job": "e"}
+	for i := 0; i < 10; i++ {
+		rand.Shuffle(len(names), func(i, j int) {
+			names[i], names[j] = names[j], names[i]
+		})
+		labels := data.Labels{}
+		for _, name := range names {
+			labels[name] = values[name]
+		}
+		require.Equal(t, expected, instanceKey(labels))
+	}
+
+	require.NotEqual(t, instanceKey(data.Labels{"a": "1, b=2"}), instanceKey(data.Labels{"a": "1", "b": "2"}))
+	require.Empty(t, instanceKey(nil))
+}
+
+func TestEvaluateExecutionResultShuffledLabels(t *testing.T) {
+	execResults := ExecutionResults{
+		ResultsByRefID: map[string]data.Frames{
+			"A": {
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a", "env": "prod"}, []*float64{nullableFloat(1)})),
+				data.NewFrame("", data.NewField("", data.Labels{"a": "1, b=2"}, []*float64{nullableFloat(1)})),
+				data.NewFrame("", data.NewField("", data.Labels{"a": "1", "b": "2"}, []*float64{nullableFloat(1)})),
+			},
+			"B": {
+				data.NewFrame("", data.NewField("", data.Labels{"env": "prod", "host": "a"}, []*float64{nullableFloat(1)})),
+			},
+		},
+	}
+
+	c := Condition{RefIDs: []string{"A", "B"}, Combinator: And}
+	results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, Alerting, results[0].State)
+	require.Equal(t, Normal, results[1].State)
+	require.Equal(t, Normal, results[2].State)
+}
+
+func TestEvaluateExecutionResultRefIDLabel(t *testing.T) {
+	t.Run("alert instances are labeled with the evaluated refID", func(t *testing.T) {
+		labels := data.Labels{"host": "a"}
+		execResults := ExecutionResults{
+			Results: data.Frames{
+				data.NewFrame("", data.NewField("", labels, []*float64{nullableFloat(1)})),
+				data.NewFrame("", data.NewField("", data.Labels{RefIDLabel: "query"}, []*float64{nullableFloat(1)})),
+			},
+		}
+
+		results, err := EvaluateExecutionResult(&Condition{RefID: "A"}, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+		require.Equal(t, data.Labels{"host": "a", RefIDLabel: "A"}, results[0].Instance)
+		require.Equal(t, data.Labels{RefIDLabel: "query"}, results[1].Instance)
+		require.Equal(t, data.Labels{"host": "a"}, labels)
+	})
+
+	t.Run("combined alert instances are labeled with the refIDs they're alerting for", func(t *testing.T) {
+		execResults := ExecutionResults{
+			ResultsByRefID: map[string]data.Frames{
+				"A": {
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+					data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(0)})),
+				},
+				"B": {
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(0)})),
+					data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(0)})),
+				},
+				"C": {
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(1)})),
+				},
+			},
+		}
+
+		c := Condition{RefIDs: []string{"A", "B", "C"}, Combinator: Or}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+
+		refIDs := make(map[string]string, len(results))
+		for _, r := range results {
+			refIDs[r.Instance["host"]] = r.Instance[RefIDLabel]
+		}
+		require.Equal(t, map[string]string{"a": "A,C", "b": "A,B"}, refIDs)
+	})
+}
+
+func TestResultsJSON(t *testing.T) {
+	evaluatedAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	results := Results{
+		{Instance: data.Labels{"service": "api", "host": "a"}, State: Alerting, Value: nullableFloat(42.5), EvaluatedAt: evaluatedAt, Severity: "critical"},
+		{Instance: data.Labels{"host": "b"}, State: NoData, EvaluatedAt: evaluatedAt},
+		{Instance: data.Labels{"host": "c"}, State: Error, Value: nullableFloat(math.Inf(1)), EvaluatedAt: evaluatedAt, Error: errors.New("non-finite value: +Inf")},
+		{State: Normal, Value: nullableFloat(0), EvaluatedAt: evaluatedAt},
+	}
+
+	b, err := json.Marshal(results)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"labels": {"host": "a", "service": "api"}, "state": "Alerting", "value": 42.5, "evaluatedAt": "2020-11-27T06:05:01Z", "severity": "critical"},
+		{"labels": {"host": "b"}, "state": "NoData", "value": null, "evaluatedAt": "2020-11-27T06:05:01Z"},
+		{"labels": {"host": "c"}, "state": "Error", "value": "+Inf", "evaluatedAt": "2020-11-27T06:05:01Z", "error": "non-finite value: +Inf"},
+		{"labels": null, "state": "Normal", "value": 0, "evaluatedAt": "2020-11-27T06:05:01Z"}
+	]`, string(b))
+
+	other, err := json.Marshal(Results{{Instance: data.Labels{"host": "a", "service": "api"}, State: Alerting, Value: nullableFloat(42.5), EvaluatedAt: evaluatedAt, Severity: "critical"}})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), strings.TrimSuffix(string(other), "]")), "labels are encoded in a stable order")
+
+	var decoded Results
+	err = json.Unmarshal(b, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, results, decoded)
+
+	t.Run("invalid states and values are rejected", func(t *testing.T) {
+		var decoded Results
+		err := json.Unmarshal([]byte(`[{"state": "Pending", "value": null}]`), &decoded)
+		require.EqualError(t, err, `invalid alert instance state: "Pending"`)
+
+		err = json.Unmarshal([]byte(`[{"state": "Normal", "value": "42"}]`), &decoded)
+		require.EqualError(t, err, `invalid alert instance value: "42"`)
+	})
+}
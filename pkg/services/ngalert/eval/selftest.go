@@ -0,0 +1,133 @@
+package eval
+
+import (
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// selfTestWindow is the recent window a condition is executed over by SelfTest,
+// so that checking it is cheap for its datasources.
+const selfTestWindow = 5 * time.Minute
+
+// SelfTestCheck is a check of a condition performed by SelfTest.
+type SelfTestCheck string
+
+const (
+	// SelfTestValidate checks that the condition is valid.
+	SelfTestValidate SelfTestCheck = "validate"
+	// SelfTestExecute checks that the queries and expressions of the condition execute.
+	SelfTestExecute SelfTestCheck = "execute"
+	// SelfTestResolveRefID checks that the evaluated RefIDs of the condition return frames.
+	SelfTestResolveRefID SelfTestCheck = "resolve_ref_id"
+	// SelfTestEvaluate checks that the frames of the evaluated RefIDs can be evaluated.
+	SelfTestEvaluate SelfTestCheck = "evaluate"
+)
+
+// SelfTestStatus is the outcome of a check of a condition.
+type SelfTestStatus string
+
+const (
+	// SelfTestPassed is the status of a successful check.
+	SelfTestPassed SelfTestStatus = "passed"
+	// SelfTestFailed is the status of a check that found a problem, described by its error.
+	SelfTestFailed SelfTestStatus = "failed"
+	// SelfTestSkipped is the status of the checks following a failed one.
+	SelfTestSkipped SelfTestStatus = "skipped"
+)
+
+// SelfTestStep is the outcome of a check of a condition, along with the reason it failed.
+type SelfTestStep struct {
+	Check  SelfTestCheck  `json:"check"`
+	Status SelfTestStatus `json:"status"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Diagnostic is the outcome of the checks of a condition performed by SelfTest, in order.
+type Diagnostic struct {
+	Steps []SelfTestStep `json:"steps"`
+
+	// TimeRange is the window the condition was executed over.
+	TimeRange backend.TimeRange `json:"timeRange"`
+
+	// ErrorsByRefID contains the errors of the failed queries and expressions, evaluated or not.
+	ErrorsByRefID map[string]string `json:"errorsByRefId,omitempty"`
+
+	// Instances is the number of evaluated alert instances.
+	Instances int `json:"instances"`
+}
+
+// Healthy returns whether every check of the condition passed.
+func (d *Diagnostic) Healthy() bool {
+	for _, s := range d.Steps {
+		if s.Status != SelfTestPassed {
+			return false
+		}
+	}
+	return len(d.Steps) > 0
+}
+
+// record records the outcome of a check, which failed if the error is set.
+func (d *Diagnostic) record(check SelfTestCheck, err error) {
+	step := SelfTestStep{Check: check, Status: SelfTestPassed}
+	if err != nil {
+		step.Status = SelfTestFailed
+		step.Error = err.Error()
+	}
+	d.Steps = append(d.Steps, step)
+}
+
+// skip records the remaining checks as skipped.
+func (d *Diagnostic) skip(checks ...SelfTestCheck) {
+	for _, check := range checks {
+		d.Steps = append(d.Steps, SelfTestStep{Check: check, Status: SelfTestSkipped})
+	}
+}
+
+// SelfTest checks the condition end to end by executing it over a small recent window, bypassing
+// the cache, and evaluating its results strictly, so that misconfigured conditions can be surfaced
+// before they evaluate to Error or NoData. It reports whether the condition is valid, whether its
+// queries and expressions execute, whether its evaluated RefIDs return frames, and whether those
+// frames can be evaluated. Checks following a failed one are skipped.
+func (c *Condition) SelfTest(ctx AlertExecCtx) *Diagnostic {
+	d := &Diagnostic{}
+	ctx.Cache = nil
+	ctx.IncludeIntermediateResults = false
+
+	if err := c.Validate(); err != nil {
+		d.record(SelfTestValidate, err)
+		d.skip(SelfTestExecute, SelfTestResolveRefID, SelfTestEvaluate)
+		return d
+	}
+	d.record(SelfTestValidate, nil)
+
+	execResults, err := c.ExecuteAt(ctx, ctx.now(), selfTestWindow)
+	if execResults != nil {
+		d.TimeRange = execResults.TimeRange
+		if len(execResults.ErrorsByRefID) > 0 {
+			d.ErrorsByRefID = make(map[string]string, len(execResults.ErrorsByRefID))
+			for refID, resErr := range execResults.ErrorsByRefID {
+				d.ErrorsByRefID[refID] = resErr.Error()
+			}
+		}
+	}
+	// the queries executed even if the evaluated RefIDs returned no frames
+	if err != nil && !errors.Is(err, ErrNoResults) {
+		d.record(SelfTestExecute, err)
+		d.skip(SelfTestResolveRefID, SelfTestEvaluate)
+		return d
+	}
+	d.record(SelfTestExecute, nil)
+
+	d.record(SelfTestResolveRefID, err)
+	if err != nil {
+		d.skip(SelfTestEvaluate)
+		return d
+	}
+
+	evalResults, err := EvaluateExecutionResult(c, execResults, StrictEvaluation)
+	d.record(SelfTestEvaluate, err)
+	d.Instances = len(evalResults)
+	return d
+}
@@ -0,0 +1,92 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionSelfTest(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Date(2021, time.January, 8, 12, 0, 0, 0, time.UTC))
+
+	newCtx := func(responses backend.Responses) AlertExecCtx {
+		ctx := AlertExecCtx{Ctx: context.Background(), Clock: mockClock}
+		ctx.TransformClient = TransformFunc(func(context.Context, *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+			return &backend.QueryDataResponse{Responses: responses}, nil
+		})
+		return ctx
+	}
+
+	c := Condition{
+		RefID: "A",
+		QueriesAndExpressions: []AlertQuery{{
+			RefID:             "A",
+			RelativeTimeRange: RelativeTimeRange{From: Duration(time.Hour)},
+			Model:             json.RawMessage(`{"datasource": "fake", "datasourceId": 1}`),
+		}},
+		Threshold: &Threshold{Operator: GreaterThan, Value: 1},
+	}
+
+	statuses := func(d *Diagnostic) []SelfTestStatus {
+		s := make([]SelfTestStatus, 0, len(d.Steps))
+		for _, step := range d.Steps {
+			s = append(s, step.Status)
+		}
+		return s
+	}
+
+	t.Run("a condition with evaluable frames is healthy", func(t *testing.T) {
+		d := c.SelfTest(newCtx(backend.Responses{
+			"A": {Frames: data.Frames{data.NewFrame("", data.NewField("", nil, []float64{2}))}},
+		}))
+		require.True(t, d.Healthy())
+		require.Equal(t, []SelfTestStatus{SelfTestPassed, SelfTestPassed, SelfTestPassed, SelfTestPassed}, statuses(d))
+		require.Equal(t, backend.TimeRange{From: mockClock.Now().Add(-selfTestWindow), To: mockClock.Now()}, d.TimeRange)
+		require.Equal(t, 1, d.Instances)
+	})
+
+	t.Run("an invalid condition skips the other checks", func(t *testing.T) {
+		c := c
+		c.RefID = "B"
+		d := c.SelfTest(newCtx(nil))
+		require.False(t, d.Healthy())
+		require.Equal(t, []SelfTestStatus{SelfTestFailed, SelfTestSkipped, SelfTestSkipped, SelfTestSkipped}, statuses(d))
+		require.Equal(t, `condition refID "B" does not match any query or expression`, d.Steps[0].Error)
+	})
+
+	t.Run("a failed query fails the execution", func(t *testing.T) {
+		d := c.SelfTest(newCtx(backend.Responses{"A": {Error: errors.New("datasource is unreachable")}}))
+		require.False(t, d.Healthy())
+		require.Equal(t, []SelfTestStatus{SelfTestPassed, SelfTestFailed, SelfTestSkipped, SelfTestSkipped}, statuses(d))
+		require.Equal(t, "query failed for refID A: datasource is unreachable", d.Steps[1].Error)
+		require.Equal(t, map[string]string{"A": "datasource is unreachable"}, d.ErrorsByRefID)
+	})
+
+	t.Run("a refID without frames doesn't resolve", func(t *testing.T) {
+		d := c.SelfTest(newCtx(backend.Responses{}))
+		require.False(t, d.Healthy())
+		require.Equal(t, SelfTestResolveRefID, d.Steps[2].Check)
+		require.Equal(t, []SelfTestStatus{SelfTestPassed, SelfTestPassed, SelfTestFailed, SelfTestSkipped}, statuses(d))
+		require.Equal(t, "no GEL results for refID A", d.Steps[2].Error)
+	})
+
+	t.Run("frames that cannot be evaluated fail the evaluation", func(t *testing.T) {
+		d := c.SelfTest(newCtx(backend.Responses{
+			"A": {Frames: data.Frames{
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []float64{1})),
+				data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []float64{2})),
+			}},
+		}))
+		require.False(t, d.Healthy())
+		require.Equal(t, []SelfTestStatus{SelfTestPassed, SelfTestPassed, SelfTestPassed, SelfTestFailed}, statuses(d))
+		require.Contains(t, d.Steps[3].Error, "frame cannot uniquely be identified by its labels")
+	})
+}
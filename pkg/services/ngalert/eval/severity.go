@@ -0,0 +1,59 @@
+package eval
+
+import "fmt"
+
+// Severity is the name of a severity level of alerting instances, such as "warning" or "critical".
+type Severity string
+
+// SeverityLevel is a severity level and the threshold the value of an alert instance
+// should satisfy to reach it.
+type SeverityLevel struct {
+	Severity  Severity  `json:"severity"`
+	Threshold Threshold `json:"threshold"`
+}
+
+// validateSeverities checks that the severity levels are named, unique and have a supported threshold.
+func validateSeverities(levels []SeverityLevel) error {
+	names := make(map[Severity]struct{}, len(levels))
+	for i, l := range levels {
+		if l.Severity == "" {
+			return fmt.Errorf("severity level %d has no severity", i)
+		}
+		if _, ok := names[l.Severity]; ok {
+			return fmt.Errorf("severity %q is used by more than one severity level", l.Severity)
+		}
+		names[l.Severity] = struct{}{}
+
+		if err := l.Threshold.validate(); err != nil {
+			return fmt.Errorf("severity %q: %w", l.Severity, err)
+		}
+	}
+	return nil
+}
+
+// severity returns the highest severity whose threshold the value satisfies,
+// or an empty severity if it satisfies none.
+func (c *Condition) severity(val float64) Severity {
+	for i := len(c.Severities) - 1; i >= 0; i-- {
+		if c.Severities[i].Threshold.isAlerting(val) {
+			return c.Severities[i].Severity
+		}
+	}
+	return ""
+}
+
+// severityRank returns the rank of the severity among the Severities of the condition.
+func (c *Condition) severityRank(s Severity) int {
+	return severityRank(c.Severities, s)
+}
+
+// severityRank returns the position of the severity among the severity levels, starting at 1,
+// so that higher severities have a higher rank. An unknown or empty severity has rank 0.
+func severityRank(levels []SeverityLevel, s Severity) int {
+	for i, l := range levels {
+		if l.Severity == s {
+			return i + 1
+		}
+	}
+	return 0
+}
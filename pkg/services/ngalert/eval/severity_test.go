@@ -0,0 +1,83 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateExecutionResultWithSeverities(t *testing.T) {
+	severities := []SeverityLevel{
+		{Severity: "warning", Threshold: Threshold{Operator: GreaterThan, Value: 70}},
+		{Severity: "critical", Threshold: Threshold{Operator: GreaterThan, Value: 90}},
+	}
+
+	testCases := []struct {
+		desc             string
+		value            float64
+		expectedState    state
+		expectedSeverity Severity
+	}{
+		{
+			desc:          "a value below every threshold is normal",
+			value:         50,
+			expectedState: Normal,
+		},
+		{
+			desc:             "a value above the lowest threshold is alerting with the lowest severity",
+			value:            80,
+			expectedState:    Alerting,
+			expectedSeverity: "warning",
+		},
+		{
+			desc:             "a value above every threshold is alerting with the highest severity",
+			value:            95,
+			expectedState:    Alerting,
+			expectedSeverity: "critical",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			execResults := ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(tc.value)})),
+				},
+			}
+
+			c := Condition{Severities: severities}
+			results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, tc.expectedState, results[0].State)
+			require.Equal(t, tc.expectedSeverity, results[0].Severity)
+			require.Equal(t, nullableFloat(tc.value), results[0].Value)
+		})
+	}
+
+	t.Run("combined alert instances have their highest severity", func(t *testing.T) {
+		execResults := ExecutionResults{
+			ResultsByRefID: map[string]data.Frames{
+				"A": {
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(80)})),
+					data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(95)})),
+				},
+				"B": {
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{nullableFloat(95)})),
+					data.NewFrame("", data.NewField("", data.Labels{"host": "b"}, []*float64{nullableFloat(50)})),
+				},
+			},
+		}
+
+		c := Condition{RefIDs: []string{"A", "B"}, Combinator: And, Severities: severities}
+		results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+		require.NoError(t, err)
+
+		severitiesByHost := make(map[string]Severity, len(results))
+		for _, r := range results {
+			severitiesByHost[r.Instance["host"]] = r.Severity
+		}
+		require.Equal(t, map[string]Severity{"a": "critical", "b": ""}, severitiesByHost)
+	})
+}
@@ -0,0 +1,56 @@
+package eval
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// StateTracker tracks since when the alert instances of successive evaluations of a condition
+// have been alerting, for alerting UIs to show "firing since".
+// It's safe for concurrent use, and should be used for the evaluations of a single condition.
+type StateTracker struct {
+	mu sync.Mutex
+	// firingSince is the evaluation time each alerting instance first evaluated to Alerting.
+	firingSince map[string]time.Time
+}
+
+// NewStateTracker returns a StateTracker without any alerting instance.
+func NewStateTracker() *StateTracker {
+	return &StateTracker{
+		firingSince: make(map[string]time.Time),
+	}
+}
+
+// Update records the evaluation time of the alert instances that are newly alerting.
+// Any other state resets the alert instance, and so does its absence from the results.
+func (t *StateTracker) Update(evalResults Results) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	firingSince := make(map[string]time.Time, len(evalResults))
+	for _, r := range evalResults {
+		if r.State != Alerting {
+			continue
+		}
+
+		key := instanceKey(r.Instance)
+		since, ok := t.firingSince[key]
+		if !ok {
+			since = r.EvaluatedAt
+		}
+		firingSince[key] = since
+	}
+	t.firingSince = firingSince
+}
+
+// FiringSince returns the evaluation time since which the alert instance with the labels has been alerting,
+// and false if it wasn't alerting as of the last update.
+func (t *StateTracker) FiringSince(labels data.Labels) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since, ok := t.firingSince[instanceKey(labels)]
+	return since, ok
+}
@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateTracker(t *testing.T) {
+	start := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	a := data.Labels{"host": "a"}
+	b := data.Labels{"host": "b"}
+
+	tracker := NewStateTracker()
+	update := func(at time.Time, states map[string]state) {
+		results := make(Results, 0, len(states))
+		for host, s := range states {
+			results = append(results, result{Instance: data.Labels{"host": host}, State: s, EvaluatedAt: at})
+		}
+		tracker.Update(results)
+	}
+
+	_, ok := tracker.FiringSince(a)
+	require.False(t, ok)
+
+	update(start, map[string]state{"a": Alerting, "b": Normal})
+	update(start.Add(time.Minute), map[string]state{"a": Alerting, "b": Alerting})
+
+	since, ok := tracker.FiringSince(a)
+	require.True(t, ok)
+	require.Equal(t, start, since)
+	since, ok = tracker.FiringSince(b)
+	require.True(t, ok)
+	require.Equal(t, start.Add(time.Minute), since)
+
+	t.Run("recovered instances are reset", func(t *testing.T) {
+		update(start.Add(2*time.Minute), map[string]state{"a": Normal, "b": Alerting})
+		_, ok := tracker.FiringSince(a)
+		require.False(t, ok)
+
+		update(start.Add(3*time.Minute), map[string]state{"a": Alerting})
+		since, ok := tracker.FiringSince(a)
+		require.True(t, ok)
+		require.Equal(t, start.Add(3*time.Minute), since)
+		_, ok = tracker.FiringSince(b)
+		require.False(t, ok, "missing instances are reset")
+	})
+}
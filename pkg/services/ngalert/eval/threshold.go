@@ -0,0 +1,109 @@
+package eval
+
+import "fmt"
+
+// ThresholdOperator is the comparison operator of a threshold.
+type ThresholdOperator string
+
+const (
+	// GreaterThan is the ">" threshold operator.
+	GreaterThan ThresholdOperator = "gt"
+	// GreaterThanOrEqual is the ">=" threshold operator.
+	GreaterThanOrEqual ThresholdOperator = "gte"
+	// LessThan is the "<" threshold operator.
+	LessThan ThresholdOperator = "lt"
+	// LessThanOrEqual is the "<=" threshold operator.
+	LessThanOrEqual ThresholdOperator = "lte"
+	// Equal is the "==" threshold operator.
+	Equal ThresholdOperator = "eq"
+	// NotEqual is the "!=" threshold operator.
+	NotEqual ThresholdOperator = "neq"
+)
+
+// Threshold is the comparison applied to the value of each alert instance
+// to decide whether it's alerting.
+type Threshold struct {
+	Operator ThresholdOperator `json:"operator"`
+	Value    float64           `json:"value"`
+}
+
+// validate checks that the threshold operator is supported.
+func (t *Threshold) validate() error {
+	switch t.Operator {
+	case GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual, Equal, NotEqual:
+		return nil
+	default:
+		return fmt.Errorf("invalid threshold operator: %q", t.Operator)
+	}
+}
+
+// isAlerting returns true if the value satisfies the threshold.
+// A nil threshold is satisfied by any non-zero value.
+func (t *Threshold) isAlerting(val float64) bool {
+	if t == nil {
+		return val != 0
+	}
+
+	switch t.Operator {
+	case GreaterThan:
+		return val > t.Value
+	case GreaterThanOrEqual:
+		return val >= t.Value
+	case LessThan:
+		return val < t.Value
+	case LessThanOrEqual:
+		return val <= t.Value
+	case Equal:
+		return val == t.Value
+	case NotEqual:
+		return val != t.Value
+	default:
+		return false
+	}
+}
+
+// ThresholdRule is a named threshold, such as "too_high" or "too_low",
+// so that a single query can alert on several bounds.
+type ThresholdRule struct {
+	Name      string    `json:"name"`
+	Threshold Threshold `json:"threshold"`
+}
+
+// validateThresholdRules checks that the threshold rules are named, unique and have a supported threshold.
+func validateThresholdRules(rules []ThresholdRule) error {
+	names := make(map[string]struct{}, len(rules))
+	for i, r := range rules {
+		if r.Name == "" {
+			return fmt.Errorf("threshold rule %d has no name", i)
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("threshold rule name %q is used by more than one threshold rule", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		if err := r.Threshold.validate(); err != nil {
+			return fmt.Errorf("threshold rule %q: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyThresholdRules evaluates the compared value of the alert instance against each threshold rule.
+// It returns an Alerting alert instance per matched rule, identified by the name of the rule
+// under the ThresholdRuleLabel along with its labels, or the Normal alert instance if none matched.
+func (c *Condition) applyThresholdRules(r result, val float64) []result {
+	var matched []result
+	for _, rule := range c.ThresholdRules {
+		if !rule.Threshold.isAlerting(val) {
+			continue
+		}
+		ruleResult := r
+		ruleResult.Instance = withLabel(r.Instance, ThresholdRuleLabel, rule.Name)
+		ruleResult.State = Alerting
+		matched = append(matched, ruleResult)
+	}
+	if len(matched) == 0 {
+		return []result{r}
+	}
+	return matched
+}
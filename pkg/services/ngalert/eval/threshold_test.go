@@ -0,0 +1,65 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateExecutionResultWithThresholdRules(t *testing.T) {
+	rules := []ThresholdRule{
+		{Name: "too_high", Threshold: Threshold{Operator: GreaterThan, Value: 90}},
+		{Name: "too_low", Threshold: Threshold{Operator: LessThan, Value: 10}},
+		{Name: "high", Threshold: Threshold{Operator: GreaterThan, Value: 70}},
+	}
+
+	testCases := []struct {
+		desc           string
+		value          *float64
+		expectedStates map[string]state
+	}{
+		{
+			desc:           "a value matching a single rule is alerting for that rule",
+			value:          nullableFloat(5),
+			expectedStates: map[string]state{"too_low": Alerting},
+		},
+		{
+			desc:           "a value matching several rules is alerting for each of them",
+			value:          nullableFloat(95),
+			expectedStates: map[string]state{"too_high": Alerting, "high": Alerting},
+		},
+		{
+			desc:           "a value matching no rule is normal",
+			value:          nullableFloat(50),
+			expectedStates: map[string]state{"": Normal},
+		},
+		{
+			desc:           "a null value is no data",
+			value:          nil,
+			expectedStates: map[string]state{"": NoData},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			execResults := ExecutionResults{
+				Results: data.Frames{
+					data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []*float64{tc.value})),
+				},
+			}
+
+			c := Condition{RefID: "A", ThresholdRules: rules}
+			results, err := EvaluateExecutionResult(&c, &execResults, StrictEvaluation)
+			require.NoError(t, err)
+
+			states := make(map[string]state, len(results))
+			for _, r := range results {
+				require.Equal(t, "a", r.Instance["host"])
+				require.Equal(t, tc.value, r.Value)
+				states[r.Instance[ThresholdRuleLabel]] = r.State
+			}
+			require.Equal(t, tc.expectedStates, states)
+		})
+	}
+}
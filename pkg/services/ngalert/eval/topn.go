@@ -0,0 +1,73 @@
+package eval
+
+import (
+	"math"
+	"sort"
+)
+
+// RankBy is the key alerting instances are ranked by.
+type RankBy string
+
+const (
+	// RankByValue ranks alerting instances by value, highest first.
+	RankByValue RankBy = "value"
+	// RankBySeverity ranks alerting instances by severity, highest first, then by value.
+	RankBySeverity RankBy = "severity"
+)
+
+// Ranking is how TopN ranks alerting instances.
+type Ranking struct {
+	By RankBy
+	// Severities are the severity levels ordered from the lowest to the highest, such as the
+	// Severities of the condition, which RankBySeverity ranks by. Other severities rank lowest.
+	Severities []SeverityLevel
+}
+
+// TopN returns the n highest ranked alerting instances and the number of the other alerting ones,
+// so that a notifier can summarize the rest instead of notifying each of them.
+// Instances without a value or with NaN rank lowest, and ties are ordered by labels.
+func (evalResults Results) TopN(n int, ranking Ranking) (Results, int) {
+	type ranked struct {
+		key      string
+		severity int
+		value    float64
+		r        result
+	}
+	alerting := make([]ranked, 0, len(evalResults))
+	for _, r := range evalResults {
+		if r.State != Alerting {
+			continue
+		}
+		e := ranked{key: instanceKey(r.Instance), value: math.Inf(-1), r: r}
+		if r.Value != nil && !math.IsNaN(*r.Value) {
+			e.value = *r.Value
+		}
+		if ranking.By == RankBySeverity {
+			e.severity = severityRank(ranking.Severities, r.Severity)
+		}
+		alerting = append(alerting, e)
+	}
+
+	sort.Slice(alerting, func(i, j int) bool {
+		a, b := alerting[i], alerting[j]
+		if a.severity != b.severity {
+			return a.severity > b.severity
+		}
+		if a.value != b.value {
+			return a.value > b.value
+		}
+		return a.key < b.key
+	})
+
+	if n < 0 {
+		n = 0
+	}
+	if n > len(alerting) {
+		n = len(alerting)
+	}
+	top := make(Results, 0, n)
+	for _, e := range alerting[:n] {
+		top = append(top, e.r)
+	}
+	return top, len(alerting) - n
+}
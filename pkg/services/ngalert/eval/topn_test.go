@@ -0,0 +1,64 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultsTopN(t *testing.T) {
+	severities := []SeverityLevel{{Severity: "warning"}, {Severity: "critical"}}
+	results := Results{
+		{Instance: data.Labels{"host": "a"}, State: Alerting, Value: nullableFloat(50), Severity: "critical"},
+		{Instance: data.Labels{"host": "b"}, State: Alerting, Value: nullableFloat(90), Severity: "warning"},
+		{Instance: data.Labels{"host": "c"}, State: Normal, Value: nullableFloat(100)},
+		{Instance: data.Labels{"host": "d"}, State: Alerting, Value: nullableFloat(70), Severity: "warning"},
+		{Instance: data.Labels{"host": "e"}, State: Alerting, Value: nullableFloat(math.NaN())},
+		{Instance: data.Labels{"host": "f"}, State: Alerting, Value: nullableFloat(60), Severity: "critical"},
+	}
+
+	hosts := func(results Results) []string {
+		hosts := make([]string, 0, len(results))
+		for _, r := range results {
+			hosts = append(hosts, r.Instance["host"])
+		}
+		return hosts
+	}
+
+	t.Run("by value", func(t *testing.T) {
+		top, rest := results.TopN(3, Ranking{By: RankByValue})
+		require.Equal(t, []string{"b", "d", "f"}, hosts(top))
+		require.Equal(t, 2, rest)
+	})
+
+	t.Run("by severity", func(t *testing.T) {
+		top, rest := results.TopN(3, Ranking{By: RankBySeverity, Severities: severities})
+		require.Equal(t, []string{"f", "a", "b"}, hosts(top))
+		require.Equal(t, 2, rest)
+	})
+
+	t.Run("more than the alerting instances", func(t *testing.T) {
+		top, rest := results.TopN(10, Ranking{By: RankByValue})
+		require.Equal(t, []string{"b", "d", "f", "a", "e"}, hosts(top))
+		require.Zero(t, rest)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		top, rest := results.TopN(0, Ranking{By: RankByValue})
+		require.Empty(t, top)
+		require.Equal(t, 5, rest)
+	})
+
+	t.Run("ties are ordered by labels", func(t *testing.T) {
+		tied := make(Results, 0, 10)
+		for i := 9; i >= 0; i-- {
+			tied = append(tied, result{Instance: data.Labels{"host": fmt.Sprint(i)}, State: Alerting, Value: nullableFloat(1)})
+		}
+		top, rest := tied.TopN(2, Ranking{By: RankByValue})
+		require.Equal(t, []string{"0", "1"}, hosts(top))
+		require.Equal(t, 8, rest)
+	})
+}
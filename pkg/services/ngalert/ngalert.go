@@ -1,6 +1,9 @@
 package ngalert
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/grafana/grafana/pkg/services/ngalert/eval"
 
 	"github.com/grafana/grafana/pkg/api/routing"
@@ -20,6 +23,7 @@ type AlertNG struct {
 	RouteRegister   routing.RouteRegister    `inject:""`
 	SQLStore        *sqlstore.SQLStore       `inject:""`
 	log             log.Logger
+	metrics         *eval.Metrics
 }
 
 func init() {
@@ -29,6 +33,7 @@ func init() {
 // Init initializes the AlertingService.
 func (ng *AlertNG) Init() error {
 	ng.log = log.New("ngalert")
+	ng.metrics = eval.DefaultMetrics()
 
 	ng.registerAPIEndpoints()
 
@@ -84,8 +89,18 @@ func (ng *AlertNG) LoadAlertCondition(alertDefinitionID int64, signedInUser *mod
 		return nil, err
 	}
 
-	return &eval.Condition{
+	return loadCondition(alertDefinition)
+}
+
+// loadCondition returns the Condition of the alert definition, migrated from the version of the schema
+// it was stored with to the current one.
+func loadCondition(alertDefinition *AlertDefinition) (*eval.Condition, error) {
+	b, err := json.Marshal(condition{
 		RefID:                 alertDefinition.Condition,
 		QueriesAndExpressions: alertDefinition.Data,
-	}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the condition of alert definition %d: %w", alertDefinition.Id, err)
+	}
+	return eval.UnmarshalCondition(b)
 }
@@ -0,0 +1,41 @@
+// +build integration
+
+package ngalert
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ngalert/eval"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAlertCondition(t *testing.T) {
+	ng := setupTestEnv(t)
+	alertDefinition := createTestAlertDefinition(t, ng)
+
+	c, err := ng.LoadAlertCondition(alertDefinition.Id, &models.SignedInUser{OrgId: 1}, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.Version, "the stored condition is migrated to the current version")
+	require.Equal(t, "A", c.RefID)
+	require.Empty(t, c.RefIDs, "a single RefID isn't combined")
+	require.Len(t, c.QueriesAndExpressions, 1)
+	require.Equal(t, alertDefinition.Data[0].RelativeTimeRange, c.QueriesAndExpressions[0].RelativeTimeRange)
+	require.JSONEq(t, string(alertDefinition.Data[0].Model), string(c.QueriesAndExpressions[0].Model))
+
+	results, err := eval.EvaluateExecutionResult(c, &eval.ExecutionResults{
+		Results: data.Frames{data.NewFrame("", data.NewField("", data.Labels{"host": "a"}, []float64{1}))},
+	}, eval.StrictEvaluation)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, data.Labels{"host": "a", eval.RefIDLabel: "A"}, results[0].Instance)
+
+	b, err := json.Marshal(c)
+	require.NoError(t, err)
+	roundTripped, err := eval.UnmarshalCondition(b)
+	require.NoError(t, err)
+	require.Equal(t, c.RefID, roundTripped.RefID)
+	require.Equal(t, c.Version, roundTripped.Version)
+}
@@ -5,15 +5,24 @@ import (
 
 	"github.com/grafana/grafana/pkg/expr"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ngalert/eval"
 )
 
 // validateAlertDefinition validates that the alert definition contains at least one alert query
-// and that alert queries refer to existing datasources.
+// that the condition refers to one of them and that alert queries refer to existing datasources.
 func (ng *AlertNG) validateAlertDefinition(alertDefinition *AlertDefinition, signedInUser *models.SignedInUser, skipCache bool) error {
 	if len(alertDefinition.Data) == 0 {
 		return fmt.Errorf("no queries or expressions are found")
 	}
 
+	condition := eval.Condition{
+		RefID:                 alertDefinition.Condition,
+		QueriesAndExpressions: alertDefinition.Data,
+	}
+	if err := condition.Validate(); err != nil {
+		return err
+	}
+
 	for _, query := range alertDefinition.Data {
 		datasourceID, err := query.GetDatasource()
 		if err != nil {
@@ -0,0 +1,54 @@
+package shorturls
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// maxUserAgentLength is the maximum length of recorded user agents, as stored in the database.
+const maxUserAgentLength = 255
+
+// accessLogEnabled returns true if the visits of short URLs are recorded.
+func (s ShortURLService) accessLogEnabled() bool {
+	return s.Cfg != nil && s.Cfg.ShortLinkAccessLogEnabled
+}
+
+// RecordShortURLAccess records a visit of cmd.ShortUrl with the client IP address and user agent
+// of the request, if the access log is enabled. Otherwise it does nothing, since it writes a row per visit.
+func (s ShortURLService) RecordShortURLAccess(ctx context.Context, cmd *models.RecordShortUrlAccessCommand) error {
+	if !s.accessLogEnabled() {
+		return nil
+	}
+
+	userAgent := cmd.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	access := &models.ShortUrlAccess{
+		ShortUrlId: cmd.ShortUrl.Id,
+		OrgId:      cmd.ShortUrl.OrgId,
+		UserId:     cmd.UserId,
+		ClientIp:   cmd.ClientIp,
+		UserAgent:  userAgent,
+		AccessedAt: getTime().Unix(),
+	}
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		_, err := session.Insert(access)
+		return err
+	})
+}
+
+// DeleteShortURLAccesses deletes the visits of short URLs recorded before cmd.OlderThan.
+func (s ShortURLService) DeleteShortURLAccesses(ctx context.Context, cmd *models.DeleteShortUrlAccessesCommand) error {
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var rawSql = "DELETE FROM short_url_access WHERE accessed_at < ?"
+		if result, err := session.Exec(rawSql, cmd.OlderThan.Unix()); err != nil {
+			return err
+		} else if cmd.NumDeleted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+package shorturls
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortURLAccessLog(t *testing.T) {
+	origGetTime := getTime
+	t.Cleanup(func() {
+		getTime = origGetTime
+	})
+
+	accessedAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	getTime = func() time.Time {
+		return accessedAt
+	}
+
+	user := &models.SignedInUser{UserId: 1, OrgId: 1}
+	sqlStore := sqlstore.InitTestDB(t)
+	service := ShortURLService{SQLStore: sqlStore}
+	shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?audited=true")
+	require.NoError(t, err)
+
+	accesses := func(t *testing.T) []models.ShortUrlAccess {
+		var accesses []models.ShortUrlAccess
+		err := sqlStore.WithDbSession(context.Background(), func(dbSession *sqlstore.DBSession) error {
+			return dbSession.Where("short_url_id=?", shortURL.Id).Asc("id").Find(&accesses)
+		})
+		require.NoError(t, err)
+		return accesses
+	}
+
+	t.Run("Accesses aren't recorded by default", func(t *testing.T) {
+		cmd := models.RecordShortUrlAccessCommand{ShortUrl: shortURL, UserId: 1, ClientIp: "10.0.0.1", UserAgent: "curl/7.64.1"}
+		err := service.RecordShortURLAccess(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Empty(t, accesses(t))
+	})
+
+	t.Run("Accesses are recorded once enabled", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore, Cfg: &setting.Cfg{ShortLinkAccessLogEnabled: true}}
+
+		cmd := models.RecordShortUrlAccessCommand{ShortUrl: shortURL, UserId: 1, ClientIp: "10.0.0.1", UserAgent: "curl/7.64.1"}
+		err := service.RecordShortURLAccess(context.Background(), &cmd)
+		require.NoError(t, err)
+		cmd = models.RecordShortUrlAccessCommand{ShortUrl: shortURL, ClientIp: "10.0.0.2", UserAgent: strings.Repeat("a", 300)}
+		err = service.RecordShortURLAccess(context.Background(), &cmd)
+		require.NoError(t, err)
+
+		recorded := accesses(t)
+		require.Len(t, recorded, 2)
+		require.Equal(t, int64(1), recorded[0].OrgId)
+		require.Equal(t, int64(1), recorded[0].UserId)
+		require.Equal(t, "10.0.0.1", recorded[0].ClientIp)
+		require.Equal(t, "curl/7.64.1", recorded[0].UserAgent)
+		require.Equal(t, accessedAt.Unix(), recorded[0].AccessedAt)
+		require.Len(t, recorded[1].UserAgent, maxUserAgentLength)
+	})
+
+	t.Run("Accesses are deleted after their retention", func(t *testing.T) {
+		cmd := models.DeleteShortUrlAccessesCommand{OlderThan: accessedAt}
+		err := service.DeleteShortURLAccesses(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Zero(t, cmd.NumDeleted)
+
+		cmd = models.DeleteShortUrlAccessesCommand{OlderThan: accessedAt.Add(time.Second)}
+		err = service.DeleteShortURLAccesses(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cmd.NumDeleted)
+		require.Empty(t, accesses(t))
+	})
+}
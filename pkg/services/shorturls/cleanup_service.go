@@ -0,0 +1,119 @@
+package shorturls
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// unvisitedLifetime is the duration short URLs that have never been visited are kept after their creation.
+const unvisitedLifetime = 7 * 24 * time.Hour
+
+// defaultCleanupInterval is the interval between cleanups if it's not configured.
+const defaultCleanupInterval = 10 * time.Minute
+
+func init() {
+	registry.RegisterService(&ShortURLCleanupService{})
+}
+
+// ShortURLCleanupService periodically deletes the stale short URLs: the expired ones, the ones never visited
+// within unvisitedLifetime of their creation and, if configured, the ones not visited again since
+// the inactive lifetime. It also deletes the expired idempotency keys of short URL creations
+// and the recorded visits older than the access log retention.
+type ShortURLCleanupService struct {
+	Cfg             *setting.Cfg     `inject:""`
+	ShortURLService *ShortURLService `inject:""`
+
+	log log.Logger
+
+	mu      sync.Mutex
+	lastRun CleanupRun
+}
+
+// CleanupRun is the outcome of a cleanup, for health checks.
+type CleanupRun struct {
+	// At is the time of the cleanup. It's zero if there hasn't been any cleanup yet.
+	At time.Time
+	// NumDeleted is the number of short URLs deleted by the cleanup.
+	NumDeleted int64
+	// Err is the reason of the failure of the cleanup, if it failed.
+	Err error
+}
+
+func (s *ShortURLCleanupService) Init() error {
+	s.log = log.New("shorturls.cleanup")
+	return nil
+}
+
+// Run deletes the stale short URLs every cleanup interval until the context is done.
+func (s *ShortURLCleanupService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Cleanup(ctx); err != nil {
+				s.log.Error("Failed to delete stale short URLs", "error", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Cleanup deletes the stale short URLs once and records the outcome as the last run.
+func (s *ShortURLCleanupService) Cleanup(ctx context.Context) error {
+	now := getTime()
+	cmd := models.DeleteShortUrlCommand{
+		OlderThan: now.Add(-unvisitedLifetime),
+	}
+	if s.Cfg != nil && s.Cfg.ShortLinkInactiveLifetime > 0 {
+		cmd.LastSeenOlderThan = now.Add(-s.Cfg.ShortLinkInactiveLifetime)
+	}
+	err := s.ShortURLService.DeleteStaleShortURLs(ctx, &cmd)
+
+	s.mu.Lock()
+	s.lastRun = CleanupRun{At: now, NumDeleted: cmd.NumDeleted, Err: err}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	s.log.Debug("Deleted stale short URLs", "rows affected", cmd.NumDeleted)
+
+	keysCmd := models.DeleteExpiredShortUrlIdempotencyKeysCommand{}
+	if err := s.ShortURLService.DeleteExpiredIdempotencyKeys(ctx, &keysCmd); err != nil {
+		return err
+	}
+	s.log.Debug("Deleted expired short URL idempotency keys", "rows affected", keysCmd.NumDeleted)
+
+	if s.Cfg != nil && s.Cfg.ShortLinkAccessLogRetention > 0 {
+		accessesCmd := models.DeleteShortUrlAccessesCommand{OlderThan: now.Add(-s.Cfg.ShortLinkAccessLogRetention)}
+		if err := s.ShortURLService.DeleteShortURLAccesses(ctx, &accessesCmd); err != nil {
+			return err
+		}
+		s.log.Debug("Deleted short URL accesses", "rows affected", accessesCmd.NumDeleted)
+	}
+	return nil
+}
+
+// LastRun returns the outcome of the last cleanup.
+func (s *ShortURLCleanupService) LastRun() CleanupRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun
+}
+
+// interval returns the interval between cleanups.
+func (s *ShortURLCleanupService) interval() time.Duration {
+	if s.Cfg == nil || s.Cfg.ShortLinkCleanupInterval <= 0 {
+		return defaultCleanupInterval
+	}
+	return s.Cfg.ShortLinkCleanupInterval
+}
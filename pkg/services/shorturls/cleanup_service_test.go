@@ -0,0 +1,55 @@
+package shorturls
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortURLCleanupService(t *testing.T) {
+	origGetTime := getTime
+	t.Cleanup(func() {
+		getTime = origGetTime
+	})
+
+	user := &models.SignedInUser{UserId: 1, OrgId: 1}
+	sqlStore := sqlstore.InitTestDB(t)
+	service := &ShortURLService{SQLStore: sqlStore}
+	cleanupService := &ShortURLCleanupService{Cfg: &setting.Cfg{ShortLinkCleanupInterval: time.Hour}, ShortURLService: service}
+	require.NoError(t, cleanupService.Init())
+	require.Zero(t, cleanupService.LastRun())
+
+	createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	getTime = func() time.Time {
+		return createdAt
+	}
+	stale, err := service.CreateShortURL(context.Background(), user, "mock/path?stale=true")
+	require.NoError(t, err)
+	visited, err := service.CreateShortURL(context.Background(), user, "mock/path?stale=false")
+	require.NoError(t, err)
+	require.NoError(t, service.UpdateLastSeenAt(context.Background(), visited))
+
+	cleanedUpAt := createdAt.Add(unvisitedLifetime)
+	getTime = func() time.Time {
+		return cleanedUpAt
+	}
+	err = cleanupService.Cleanup(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, CleanupRun{At: cleanedUpAt, NumDeleted: 1}, cleanupService.LastRun())
+
+	_, err = service.GetShortURLByUID(context.Background(), user, stale.Uid)
+	require.Equal(t, models.ErrShortURLNotFound, err)
+	_, err = service.GetShortURLByUID(context.Background(), user, visited.Uid)
+	require.NoError(t, err)
+
+	t.Run("Run stops once the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.Equal(t, context.Canceled, cleanupService.Run(ctx))
+	})
+}
@@ -0,0 +1,151 @@
+package shorturls
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// idempotencyKeyLifetime is the duration during which repeating a short URL creation
+// with the same idempotency key returns the short URL created the first time.
+const idempotencyKeyLifetime = 24 * time.Hour
+
+// CreateShortURLIdempotently creates a short URL for cmd.Path like CreateShortURL, setting cmd.Result.
+// If cmd.IdempotencyKey is set, it's recorded for the user for idempotencyKeyLifetime, and repeating
+// the creation with the same key returns the short URL created the first time instead of a new one.
+// It returns models.ErrShortURLIdempotencyKeyReused if the key was used for another path.
+func (s ShortURLService) CreateShortURLIdempotently(ctx context.Context, cmd *models.CreateShortUrlCommand) error {
+	user := &models.SignedInUser{OrgId: cmd.OrgId, UserId: cmd.UserId}
+	if cmd.IdempotencyKey == "" {
+		shortURL, err := s.CreateShortURL(ctx, user, cmd.Path)
+		if err != nil {
+			return err
+		}
+		cmd.Result = shortURL
+		return nil
+	}
+
+	if len(cmd.IdempotencyKey) > models.MaxShortUrlIdempotencyKeyLength {
+		return models.ErrShortURLIdempotencyKeyTooLong
+	}
+	path, err := normalizePath(cmd.Path)
+	if err != nil {
+		return err
+	}
+
+	shortURL, err := s.getShortURLByIdempotencyKey(ctx, cmd, path)
+	if err == nil {
+		cmd.Result = shortURL
+		return nil
+	}
+	if !errors.Is(err, models.ErrShortURLNotFound) {
+		return err
+	}
+
+	if !s.RateLimiter.Allow(cmd.UserId, 1) {
+		return models.ErrShortURLRateLimited
+	}
+
+	for i := 0; i < maxUIDAttempts; i++ {
+		uid := s.newUID()
+		if err = s.validateUID(uid); err != nil {
+			continue
+		}
+
+		shortURL = s.newShortURL(cmd.OrgId, cmd.UserId, path, uid)
+		err = s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+			if err := s.insertShortURL(session, shortURL); err != nil {
+				return err
+			}
+			return recordIdempotencyKey(session, cmd, shortURL)
+		})
+		if err == nil {
+			cmd.Result = shortURL
+			return nil
+		}
+		if !errors.Is(err, models.ErrShortURLConflict) {
+			break
+		}
+	}
+
+	// A concurrent creation with the same key may have recorded it first
+	if shortURL, lookupErr := s.getShortURLByIdempotencyKey(ctx, cmd, path); lookupErr == nil {
+		cmd.Result = shortURL
+		return nil
+	}
+	return err
+}
+
+// getShortURLByIdempotencyKey returns the non-deleted short URL created by the user with the unexpired
+// idempotency key of the command. It returns models.ErrShortURLNotFound if there is none, and
+// models.ErrShortURLIdempotencyKeyReused if it's for another path than the normalized one.
+func (s ShortURLService) getShortURLByIdempotencyKey(ctx context.Context, cmd *models.CreateShortUrlCommand, path string) (*models.ShortUrl, error) {
+	var shortURL models.ShortUrl
+	err := s.SQLStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		var key models.ShortUrlIdempotencyKey
+		exists, err := dbSession.Where("org_id=? AND user_id=? AND idempotency_key=?", cmd.OrgId, cmd.UserId, cmd.IdempotencyKey).
+			And("created_at > ?", getTime().Add(-idempotencyKeyLifetime).Unix()).
+			Get(&key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrShortURLNotFound
+		}
+
+		exists, err = dbSession.Where("id=?", key.ShortUrlId).
+			And("(deleted_at IS NULL OR deleted_at = 0)").
+			Get(&shortURL)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrShortURLNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if shortURL.Path != path {
+		return nil, models.ErrShortURLIdempotencyKeyReused
+	}
+	return &shortURL, nil
+}
+
+// recordIdempotencyKey records the idempotency key of the command for the created short URL,
+// replacing the user's previous record of the key if it expired or its short URL is gone.
+func recordIdempotencyKey(session *sqlstore.DBSession, cmd *models.CreateShortUrlCommand, shortURL *models.ShortUrl) error {
+	now := getTime()
+	var rawSql = `DELETE FROM short_url_idempotency_key WHERE org_id = ? AND user_id = ? AND idempotency_key = ?
+		AND (created_at <= ? OR short_url_id NOT IN (SELECT id FROM short_url WHERE deleted_at IS NULL OR deleted_at = 0))`
+	if _, err := session.Exec(rawSql, cmd.OrgId, cmd.UserId, cmd.IdempotencyKey, now.Add(-idempotencyKeyLifetime).Unix()); err != nil {
+		return err
+	}
+
+	_, err := session.Insert(&models.ShortUrlIdempotencyKey{
+		OrgId:          cmd.OrgId,
+		UserId:         cmd.UserId,
+		IdempotencyKey: cmd.IdempotencyKey,
+		ShortUrlId:     shortURL.Id,
+		CreatedAt:      now.Unix(),
+	})
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys deletes the idempotency keys recorded more than idempotencyKeyLifetime ago.
+func (s ShortURLService) DeleteExpiredIdempotencyKeys(ctx context.Context, cmd *models.DeleteExpiredShortUrlIdempotencyKeysCommand) error {
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var rawSql = "DELETE FROM short_url_idempotency_key WHERE created_at <= ?"
+		if result, err := session.Exec(rawSql, getTime().Add(-idempotencyKeyLifetime).Unix()); err != nil {
+			return err
+		} else if cmd.NumDeleted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return nil
+	})
+}
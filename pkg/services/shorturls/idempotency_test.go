@@ -0,0 +1,101 @@
+package shorturls
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateShortURLIdempotently(t *testing.T) {
+	origGetTime := getTime
+	t.Cleanup(func() {
+		getTime = origGetTime
+	})
+
+	createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	getTime = func() time.Time {
+		return createdAt
+	}
+
+	sqlStore := sqlstore.InitTestDB(t)
+	service := ShortURLService{SQLStore: sqlStore}
+
+	cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 1, Path: "mock/path?retried=true", IdempotencyKey: "key"}
+	err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+	require.NoError(t, err)
+	created := cmd.Result
+	require.NotEmpty(t, created.Uid)
+
+	t.Run("Repeats return the created short URL", func(t *testing.T) {
+		cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 1, Path: "/mock/path?retried=true", IdempotencyKey: "key"}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, created.Id, cmd.Result.Id)
+		require.Equal(t, created.Uid, cmd.Result.Uid)
+	})
+
+	t.Run("Repeats for another path fail", func(t *testing.T) {
+		cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 1, Path: "mock/path?retried=false", IdempotencyKey: "key"}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.Equal(t, models.ErrShortURLIdempotencyKeyReused, err)
+	})
+
+	t.Run("Keys are scoped per user", func(t *testing.T) {
+		cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 2, Path: "mock/path?retried=true", IdempotencyKey: "key"}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.NotEqual(t, created.Uid, cmd.Result.Uid)
+	})
+
+	t.Run("Creations without a key aren't deduplicated", func(t *testing.T) {
+		cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 1, Path: "mock/path?retried=true"}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.NotEqual(t, created.Uid, cmd.Result.Uid)
+	})
+
+	t.Run("Too long keys are rejected", func(t *testing.T) {
+		cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 1, Path: "mock/path?retried=true",
+			IdempotencyKey: strings.Repeat("k", models.MaxShortUrlIdempotencyKeyLength+1)}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.Equal(t, models.ErrShortURLIdempotencyKeyTooLong, err)
+	})
+
+	t.Run("Keys can be reused once expired", func(t *testing.T) {
+		expiredAt := createdAt.Add(idempotencyKeyLifetime)
+		getTime = func() time.Time {
+			return expiredAt
+		}
+
+		cmd := models.CreateShortUrlCommand{OrgId: 1, UserId: 1, Path: "mock/path?retried=false", IdempotencyKey: "key"}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.NotEqual(t, created.Uid, cmd.Result.Uid)
+
+		getTime = func() time.Time {
+			return expiredAt.Add(idempotencyKeyLifetime)
+		}
+		keysCmd := models.DeleteExpiredShortUrlIdempotencyKeysCommand{}
+		err = service.DeleteExpiredIdempotencyKeys(context.Background(), &keysCmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), keysCmd.NumDeleted)
+	})
+
+	t.Run("Keys of deleted short URLs can be reused", func(t *testing.T) {
+		cmd := models.CreateShortUrlCommand{OrgId: 3, UserId: 3, Path: "mock/path?deleted=true", IdempotencyKey: "key"}
+		err := service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.NoError(t, err)
+		deleted := cmd.Result
+		err = service.DeleteShortURL(context.Background(), &models.DeleteShortUrlByUidCommand{OrgId: 3, Uid: deleted.Uid})
+		require.NoError(t, err)
+
+		err = service.CreateShortURLIdempotently(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.NotEqual(t, deleted.Uid, cmd.Result.Uid)
+	})
+}
@@ -0,0 +1,116 @@
+package shorturls
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// LastSeenBuffer coalesces the visits of short URLs and records them periodically in the ShortURLStore,
+// so that redirecting from a short URL doesn't wait for a database write.
+type LastSeenBuffer struct {
+	store         ShortURLStore
+	flushInterval time.Duration
+	log           log.Logger
+
+	mu     sync.Mutex
+	visits map[int64]*visits
+}
+
+// visits are the coalesced visits of a short URL since the last flush.
+type visits struct {
+	shortURL   models.ShortUrl
+	lastSeenAt time.Time
+	hits       int64
+}
+
+// NewLastSeenBuffer returns a LastSeenBuffer flushing the recorded visits to the store
+// every flushInterval once running.
+func NewLastSeenBuffer(store ShortURLStore, flushInterval time.Duration) *LastSeenBuffer {
+	return &LastSeenBuffer{
+		store:         store,
+		flushInterval: flushInterval,
+		log:           log.New("shorturls.lastseen"),
+		visits:        make(map[int64]*visits),
+	}
+}
+
+// Record records a visit of the short URL at seenAt to be written on the next flush.
+// Short URLs are identified by their id since their uid is only unique within an org.
+func (b *LastSeenBuffer) Record(shortURL *models.ShortUrl, seenAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v, ok := b.visits[shortURL.Id]
+	if !ok {
+		v = &visits{shortURL: *shortURL}
+		b.visits[shortURL.Id] = v
+	}
+	if seenAt.After(v.lastSeenAt) {
+		v.lastSeenAt = seenAt
+	}
+	v.hits++
+}
+
+// Run flushes the recorded visits every flush interval until the context is done,
+// then flushes the remaining ones.
+func (b *LastSeenBuffer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(ctx); err != nil {
+				b.log.Error("Failed to flush short URL visits", "error", err)
+			}
+		case <-ctx.Done():
+			if err := b.Flush(context.Background()); err != nil {
+				b.log.Error("Failed to flush short URL visits", "error", err)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// Flush writes the visits recorded since the last flush, with a single write per short URL.
+// The visits that fail to be written are recorded again to be retried on the next flush,
+// and the first failure is returned.
+func (b *LastSeenBuffer) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.visits
+	b.visits = make(map[int64]*visits)
+	b.mu.Unlock()
+
+	var firstErr error
+	for id, v := range pending {
+		if err := b.store.UpdateLastSeen(ctx, &v.shortURL, v.lastSeenAt, v.hits); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(pending, id)
+	}
+	if firstErr != nil {
+		b.restore(pending)
+	}
+	return firstErr
+}
+
+// restore merges visits that failed to be written with the ones recorded since.
+func (b *LastSeenBuffer) restore(pending map[int64]*visits) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, v := range pending {
+		if current, ok := b.visits[id]; ok {
+			current.hits += v.hits
+			continue
+		}
+		b.visits[id] = v
+	}
+}
@@ -0,0 +1,116 @@
+package shorturls
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastSeenBuffer(t *testing.T) {
+	origGetTime := getTime
+	t.Cleanup(func() {
+		getTime = origGetTime
+	})
+
+	user := &models.SignedInUser{UserId: 1, OrgId: 1}
+	sqlStore := sqlstore.InitTestDB(t)
+	service := ShortURLService{SQLStore: sqlStore}
+
+	shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?buffered=true")
+	require.NoError(t, err)
+	otherShortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?buffered=false")
+	require.NoError(t, err)
+
+	buffer := NewLastSeenBuffer(service.store(), time.Minute)
+	service.LastSeenBuffer = buffer
+
+	firstVisit := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		getTime = func() time.Time {
+			return firstVisit.Add(time.Duration(i) * time.Second)
+		}
+		err := service.UpdateLastSeenAt(context.Background(), shortURL)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(3), shortURL.HitCount)
+
+	t.Run("Visits aren't written until flushed", func(t *testing.T) {
+		existingShortURL, err := service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.NoError(t, err)
+		require.Zero(t, existingShortURL.LastSeenAt)
+		require.Zero(t, existingShortURL.HitCount)
+	})
+
+	t.Run("Flush writes the coalesced visits", func(t *testing.T) {
+		err := buffer.Flush(context.Background())
+		require.NoError(t, err)
+
+		existingShortURL, err := service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.NoError(t, err)
+		require.Equal(t, firstVisit.Add(2*time.Second).Unix(), existingShortURL.LastSeenAt)
+		require.Equal(t, int64(3), existingShortURL.HitCount)
+
+		otherExistingShortURL, err := service.GetShortURLByUID(context.Background(), user, otherShortURL.Uid)
+		require.NoError(t, err)
+		require.Zero(t, otherExistingShortURL.HitCount)
+
+		err = buffer.Flush(context.Background())
+		require.NoError(t, err)
+
+		existingShortURL, err = service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), existingShortURL.HitCount)
+	})
+
+	t.Run("Visits failing to be written are retried on the next flush", func(t *testing.T) {
+		store := &failingShortURLStore{ShortURLStore: service.store(), err: errors.New("unavailable")}
+		failingBuffer := NewLastSeenBuffer(store, time.Minute)
+		failingBuffer.Record(otherShortURL, firstVisit)
+
+		err := failingBuffer.Flush(context.Background())
+		require.Equal(t, store.err, err)
+
+		failingBuffer.Record(otherShortURL, firstVisit.Add(time.Second))
+		store.err = nil
+		err = failingBuffer.Flush(context.Background())
+		require.NoError(t, err)
+
+		otherExistingShortURL, err := service.GetShortURLByUID(context.Background(), user, otherShortURL.Uid)
+		require.NoError(t, err)
+		require.Equal(t, firstVisit.Add(time.Second).Unix(), otherExistingShortURL.LastSeenAt)
+		require.Equal(t, int64(2), otherExistingShortURL.HitCount)
+	})
+
+	t.Run("Init buffers visits if a flush interval is configured", func(t *testing.T) {
+		cfg := setting.NewCfg()
+		cfg.ShortLinkLastSeenFlushInterval = 10 * time.Second
+		bufferedService := ShortURLService{Cfg: cfg, SQLStore: sqlStore, Metrics: NewMetrics(prometheus.NewRegistry())}
+		require.NoError(t, bufferedService.Init())
+		require.NotNil(t, bufferedService.LastSeenBuffer)
+		require.Equal(t, 10*time.Second, bufferedService.LastSeenBuffer.flushInterval)
+
+		unbufferedService := ShortURLService{Cfg: setting.NewCfg(), SQLStore: sqlStore, Metrics: NewMetrics(prometheus.NewRegistry())}
+		require.NoError(t, unbufferedService.Init())
+		require.Nil(t, unbufferedService.LastSeenBuffer)
+	})
+}
+
+// failingShortURLStore is a ShortURLStore failing to record visits with its error, if set.
+type failingShortURLStore struct {
+	ShortURLStore
+	err error
+}
+
+func (s *failingShortURLStore) UpdateLastSeen(ctx context.Context, shortURL *models.ShortUrl, seenAt time.Time, hits int64) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.ShortURLStore.UpdateLastSeen(ctx, shortURL, seenAt, hits)
+}
@@ -0,0 +1,63 @@
+package shorturls
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics contains the instrumentation of short URL resolutions.
+// A nil *Metrics records nothing.
+type Metrics struct {
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+var (
+	defaultMetricsOnce sync.Once
+	defaultMetrics     *Metrics
+)
+
+// DefaultMetrics returns the short URL metrics registered with the default registerer,
+// which are only created and registered by the first call.
+func DefaultMetrics() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics = NewMetrics(prometheus.DefaultRegisterer)
+	})
+	return defaultMetrics
+}
+
+// NewMetrics creates the short URL metrics and registers them with the provided registerer.
+func NewMetrics(r prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "grafana",
+			Name:      "short_url_hits_total",
+			Help:      "The total number of short URLs resolved to their path.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "grafana",
+			Name:      "short_url_misses_total",
+			Help:      "The total number of short URLs not found, expired or deleted.",
+		}),
+	}
+
+	r.MustRegister(m.hits, m.misses)
+	return m
+}
+
+// observeHit records a resolved short URL.
+func (m *Metrics) observeHit() {
+	if m == nil {
+		return
+	}
+	m.hits.Inc()
+}
+
+// observeMiss records a short URL that couldn't be resolved.
+func (m *Metrics) observeMiss() {
+	if m == nil {
+		return
+	}
+	m.misses.Inc()
+}
@@ -0,0 +1,45 @@
+package shorturls
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	user := &models.SignedInUser{UserId: 1, OrgId: 1}
+	service := ShortURLService{SQLStore: sqlstore.InitTestDB(t), Metrics: NewMetrics(prometheus.NewRegistry())}
+
+	shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?metrics=true")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.NoError(t, err)
+	}
+	_, err = service.GetShortURLByUID(context.Background(), user, "missing")
+	require.Equal(t, models.ErrShortURLNotFound, err)
+
+	require.Equal(t, float64(2), testutil.ToFloat64(service.Metrics.hits))
+	require.Equal(t, float64(1), testutil.ToFloat64(service.Metrics.misses))
+}
+
+func TestShortURLServiceInitMetrics(t *testing.T) {
+	service := ShortURLService{}
+	require.NoError(t, service.Init())
+	require.Same(t, DefaultMetrics(), service.Metrics)
+
+	other := ShortURLService{}
+	require.NoError(t, other.Init(), "the default metrics are only registered once")
+	require.Same(t, service.Metrics, other.Metrics)
+
+	metrics := NewMetrics(prometheus.NewRegistry())
+	injected := ShortURLService{Metrics: metrics}
+	require.NoError(t, injected.Init())
+	require.Same(t, metrics, injected.Metrics)
+}
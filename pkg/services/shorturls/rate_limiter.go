@@ -0,0 +1,86 @@
+package shorturls
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRateLimiterBuckets is the number of users tracked by a RateLimiter above which
+// the buckets of users that aren't limited anymore are dropped.
+const maxRateLimiterBuckets = 10000
+
+// RateLimiter limits the rate of short URL creations of each user with a token bucket,
+// so that a user creating short URLs in a loop can't flood the table.
+// A nil *RateLimiter allows every creation.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+// bucket holds the tokens of a user at the time it was last updated.
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing each user to create up to burst short URLs at once,
+// refilled at rate short URLs per second.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[int64]*bucket),
+	}
+}
+
+// Allow returns true if the user can create n short URLs now, taking n tokens from their bucket.
+func (l *RateLimiter) Allow(userID int64, n int) bool {
+	if l == nil {
+		return true
+	}
+
+	now := getTime()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[userID]
+	if !ok {
+		if len(l.buckets) >= maxRateLimiterBuckets {
+			l.dropFullBuckets(now)
+		}
+		b = &bucket{tokens: l.burst, updatedAt: now}
+		l.buckets[userID] = b
+	}
+	b.refill(now, l.rate, l.burst)
+
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// refill adds the tokens accumulated since the bucket was last updated, up to burst.
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	if elapsed := now.Sub(b.updatedAt).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.updatedAt = now
+}
+
+// dropFullBuckets drops the buckets that are full by now, which behave like new ones.
+func (l *RateLimiter) dropFullBuckets(now time.Time) {
+	for userID, b := range l.buckets {
+		b.refill(now, l.rate, l.burst)
+		if b.tokens >= l.burst {
+			delete(l.buckets, userID)
+		}
+	}
+}
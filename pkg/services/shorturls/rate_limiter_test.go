@@ -0,0 +1,38 @@
+package shorturls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	origGetTime := getTime
+	t.Cleanup(func() {
+		getTime = origGetTime
+	})
+
+	now := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	getTime = func() time.Time {
+		return now
+	}
+
+	limiter := NewRateLimiter(1, 2)
+	require.True(t, limiter.Allow(1, 1))
+	require.True(t, limiter.Allow(1, 1))
+	require.False(t, limiter.Allow(1, 1))
+	require.True(t, limiter.Allow(2, 2), "users have their own bucket")
+	require.False(t, limiter.Allow(3, 3), "creations beyond the burst are never allowed")
+
+	now = now.Add(time.Second)
+	require.True(t, limiter.Allow(1, 1))
+	require.False(t, limiter.Allow(1, 1))
+
+	now = now.Add(time.Hour)
+	require.True(t, limiter.Allow(1, 2), "buckets are refilled up to the burst")
+	require.False(t, limiter.Allow(1, 1))
+
+	var nilLimiter *RateLimiter
+	require.True(t, nilLimiter.Allow(1, 100))
+}
@@ -2,32 +2,263 @@ package shorturls
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/registry"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
-	"github.com/grafana/grafana/pkg/util"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 var getTime = time.Now
+var generateUID = GenerateShortURLUID
+
+// maxUIDsPerQuery is the maximum number of uids looked up by a single query,
+// below the limit of bound parameters of SQLite.
+const maxUIDsPerQuery = 500
+
+// maxUIDAttempts is the number of uids generated for a new short URL before giving up on conflicts.
+const maxUIDAttempts = 3
 
 func init() {
 	registry.RegisterService(&ShortURLService{})
 }
 
 type ShortURLService struct {
+	Cfg      *setting.Cfg       `inject:""`
 	SQLStore *sqlstore.SQLStore `inject:""`
+
+	// Metrics records the short URL resolutions, if set. Init sets the DefaultMetrics if it is missing.
+	Metrics *Metrics
+
+	// RateLimiter limits the rate of short URL creations of each user, if set.
+	RateLimiter *RateLimiter
+
+	// LastSeenBuffer records the visits of short URLs in batches, if set, instead of writing each visit
+	// before redirecting. The service flushes it periodically while running.
+	LastSeenBuffer *LastSeenBuffer
+
+	// UIDValidator validates the uids of created and resolved short URLs.
+	// If it's missing, ValidateShortURLUID is used.
+	UIDValidator UIDValidator
+
+	// Store stores the short URLs created, resolved, visited and deleted one by one, if set,
+	// e.g. to back them with a key-value store. If it's missing, they're stored in the SQLStore.
+	Store ShortURLStore
 }
 
 func (s *ShortURLService) Init() error {
+	if s.Metrics == nil {
+		s.Metrics = DefaultMetrics()
+	}
+	if s.Cfg != nil && s.Cfg.ShortLinkCreationRateLimit > 0 {
+		limit := s.Cfg.ShortLinkCreationRateLimit
+		s.RateLimiter = NewRateLimiter(float64(limit)/time.Minute.Seconds(), limit)
+	}
+	if s.LastSeenBuffer == nil && s.Cfg != nil && s.Cfg.ShortLinkLastSeenFlushInterval > 0 {
+		s.LastSeenBuffer = NewLastSeenBuffer(s.store(), s.Cfg.ShortLinkLastSeenFlushInterval)
+	}
+	return nil
+}
+
+// Run flushes the visits recorded by the LastSeenBuffer periodically until the context is done,
+// if visits are buffered.
+func (s *ShortURLService) Run(ctx context.Context) error {
+	if s.LastSeenBuffer == nil {
+		return nil
+	}
+	return s.LastSeenBuffer.Run(ctx)
+}
+
+// normalizePath validates that the path is relative to the Grafana root and returns it as stored,
+// without surrounding spaces nor leading slash, so that equivalent paths are deduplicated.
+// It returns models.ErrShortURLBadRequest for absolute URLs and paths escaping the Grafana root,
+// and models.ErrShortURLPathTooLong for paths longer than models.MaxShortUrlPathLength.
+func normalizePath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if len(strings.TrimPrefix(p, "/")) > models.MaxShortUrlPathLength {
+		return "", models.ErrShortURLPathTooLong
+	}
+	// Browsers treat backslashes as slashes, so that "/\\evil.com" is a protocol-relative URL.
+	if strings.HasPrefix(p, "//") || strings.Contains(p, "\\") {
+		return "", models.ErrShortURLBadRequest
+	}
+
+	u, err := url.Parse(p)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return "", models.ErrShortURLBadRequest
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == ".." {
+			return "", models.ErrShortURLBadRequest
+		}
+	}
+
+	return strings.TrimPrefix(p, "/"), nil
+}
+
+// uidLength returns the length of the generated uids of new short URLs.
+func (s ShortURLService) uidLength() int {
+	if s.Cfg == nil || s.Cfg.ShortLinkUIDLength <= 0 {
+		return DefaultUIDLength
+	}
+	return s.Cfg.ShortLinkUIDLength
+}
+
+// caseInsensitiveUIDs returns true if uids are generated lowercase and resolved regardless of their case.
+func (s ShortURLService) caseInsensitiveUIDs() bool {
+	return s.Cfg != nil && s.Cfg.ShortLinkCaseInsensitiveUIDs
+}
+
+// newUID generates a uid for a new short URL, lowercase if uids are case-insensitive.
+func (s ShortURLService) newUID() string {
+	uid := generateUID(s.uidLength())
+	if s.caseInsensitiveUIDs() {
+		uid = strings.ToLower(uid)
+	}
+	return uid
+}
+
+// store returns the Store if set, otherwise the store of the short URLs in the SQLStore.
+func (s ShortURLService) store() ShortURLStore {
+	if s.Store != nil {
+		return s.Store
+	}
+	return &sqlShortURLStore{sqlStore: s.SQLStore, caseInsensitiveUIDs: s.caseInsensitiveUIDs()}
+}
+
+// validateUID validates the uid with the UIDValidator.
+// It returns an error wrapping models.ErrShortURLInvalidUID if the uid is invalid.
+func (s ShortURLService) validateUID(uid string) error {
+	validate := s.UIDValidator
+	if validate == nil {
+		validate = ValidateShortURLUID
+	}
+	if err := validate(uid); err != nil {
+		return fmt.Errorf("%w: %s", models.ErrShortURLInvalidUID, err)
+	}
 	return nil
 }
 
+// maxLifetime returns the duration short URLs remain valid after their creation.
+// Zero means short URLs never expire.
+func (s ShortURLService) maxLifetime() time.Duration {
+	if s.Cfg == nil {
+		return 0
+	}
+	return s.Cfg.ShortLinkMaxLifetime
+}
+
+// GetShortURLByUID resolves the short URL of the org by its uid, regardless of its case if uids are case-insensitive.
+// It returns an error wrapping models.ErrShortURLInvalidUID if the uid is rejected by the UIDValidator,
+// models.ErrShortURLNotFound if it doesn't exist or is deleted, and models.ErrShortURLExpired if it's expired.
+// With case-insensitive uids, it returns models.ErrShortURLUIDCaseConflict if several uids only differ by case
+// from the uid and none is exactly it.
 func (s ShortURLService) GetShortURLByUID(ctx context.Context, user *models.SignedInUser, uid string) (*models.ShortUrl, error) {
-	var shortURL models.ShortUrl
+	if err := s.validateUID(uid); err != nil {
+		return nil, err
+	}
+
+	shortURL, err := s.store().GetByUID(ctx, user.OrgId, uid)
+	if err == nil && shortURL.DeletedAt != 0 {
+		err = models.ErrShortURLNotFound
+	}
+	if err == nil && shortURL.ExpiresAt != 0 && shortURL.ExpiresAt <= getTime().Unix() {
+		err = models.ErrShortURLExpired
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrShortURLNotFound) || errors.Is(err, models.ErrShortURLExpired) {
+			s.Metrics.observeMiss()
+		}
+		return nil, err
+	}
+
+	s.Metrics.observeHit()
+	return shortURL, nil
+}
+
+// getShortURLByUID gets the short URL of the org with the uid, preferring the exact uid if uids
+// are case-insensitive and several only differ by case.
+func getShortURLByUID(dbSession *sqlstore.DBSession, orgID int64, uid string, caseInsensitiveUIDs bool, shortURL *models.ShortUrl) (bool, error) {
+	if !caseInsensitiveUIDs {
+		return dbSession.Where("org_id=? AND uid=?", orgID, uid).Get(shortURL)
+	}
+
+	var shortURLs []*models.ShortUrl
+	if err := dbSession.Where("org_id=? AND LOWER(uid)=?", orgID, strings.ToLower(uid)).Find(&shortURLs); err != nil {
+		return false, err
+	}
+	switch len(shortURLs) {
+	case 0:
+		return false, nil
+	case 1:
+		*shortURL = *shortURLs[0]
+		return true, nil
+	}
+	for _, candidate := range shortURLs {
+		if candidate.Uid == uid {
+			*shortURL = *candidate
+			return true, nil
+		}
+	}
+	return false, models.ErrShortURLUIDCaseConflict
+}
+
+// GetShortURLPathsByUIDs resolves the paths of the short URLs of the org by their uid, setting query.Result
+// to the path of each uid. Uids of short URLs that don't exist, are expired or are deleted are left out.
+func (s ShortURLService) GetShortURLPathsByUIDs(ctx context.Context, query *models.GetShortUrlPathsByUidsQuery) error {
+	paths := make(map[string]string, len(query.Uids))
 	err := s.SQLStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
-		exists, err := dbSession.Where("org_id=? AND uid=?", user.OrgId, uid).Get(&shortURL)
+		for start := 0; start < len(query.Uids); start += maxUIDsPerQuery {
+			end := start + maxUIDsPerQuery
+			if end > len(query.Uids) {
+				end = len(query.Uids)
+			}
+
+			shortURLs := make([]*models.ShortUrl, 0, end-start)
+			err := dbSession.Where("org_id=?", query.OrgId).
+				In("uid", query.Uids[start:end]).
+				And("(expires_at IS NULL OR expires_at = 0 OR expires_at > ?)", getTime().Unix()).
+				And("(deleted_at IS NULL OR deleted_at = 0)").
+				Cols("uid", "path").
+				Find(&shortURLs)
+			if err != nil {
+				return err
+			}
+			for _, shortURL := range shortURLs {
+				paths[shortURL.Uid] = shortURL.Path
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	query.Result = paths
+	return nil
+}
+
+// GetShortURLByPath returns the most recent non-expired short URL created by the user in the org for the path.
+// It returns models.ErrShortURLNotFound if there is none.
+func (s ShortURLService) GetShortURLByPath(ctx context.Context, user *models.SignedInUser, path string) (*models.ShortUrl, error) {
+	path, err := normalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var shortURL models.ShortUrl
+	err = s.SQLStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		exists, err := dbSession.Where("org_id=? AND created_by=? AND path=?", user.OrgId, user.UserId, path).
+			And("(expires_at IS NULL OR expires_at = 0 OR expires_at > ?)", getTime().Unix()).
+			And("(deleted_at IS NULL OR deleted_at = 0)").
+			Desc("created_at", "id").
+			Get(&shortURL)
 		if err != nil {
 			return err
 		}
@@ -44,44 +275,493 @@ func (s ShortURLService) GetShortURLByUID(ctx context.Context, user *models.Sign
 	return &shortURL, nil
 }
 
+// GetOrCreateShortURL returns the user's existing short URL for the path if there is one,
+// otherwise it creates a new one.
+func (s ShortURLService) GetOrCreateShortURL(ctx context.Context, user *models.SignedInUser, path string) (*models.ShortUrl, error) {
+	shortURL, err := s.GetShortURLByPath(ctx, user, path)
+	if err == nil {
+		return shortURL, nil
+	}
+	if !errors.Is(err, models.ErrShortURLNotFound) {
+		return nil, err
+	}
+
+	return s.CreateShortURL(ctx, user, path)
+}
+
+// GetShortURLsByUser returns the non-deleted short URLs created by the user in the org, most recent first.
+// If query.CreatedAfter or query.CreatedBefore are set, only the short URLs created in that time window are returned.
+// If query.Limit is set, at most query.Limit short URLs are returned starting at query.Offset.
+func (s ShortURLService) GetShortURLsByUser(ctx context.Context, query *models.GetShortUrlsByUserQuery) error {
+	return s.SQLStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		shortURLs := make([]*models.ShortUrl, 0)
+		sess := dbSession.Where("org_id=? AND created_by=?", query.OrgId, query.UserId).
+			And("(deleted_at IS NULL OR deleted_at = 0)")
+		if query.CreatedAfter > 0 {
+			sess = sess.And("created_at > ?", query.CreatedAfter)
+		}
+		if query.CreatedBefore > 0 {
+			sess = sess.And("created_at < ?", query.CreatedBefore)
+		}
+		sess = sess.Desc("created_at", "id")
+		if query.Limit > 0 {
+			sess = sess.Limit(query.Limit, query.Offset)
+		}
+		if err := sess.Find(&shortURLs); err != nil {
+			return err
+		}
+
+		query.Result = shortURLs
+		return nil
+	})
+}
+
+// GetShortURLStats returns the aggregate usage of the short URLs of the org, excluding deleted ones.
+func (s ShortURLService) GetShortURLStats(ctx context.Context, query *models.GetShortUrlStatsQuery) error {
+	now := getTime()
+	createdSince := now.AddDate(0, 0, -query.CreatedWithinDays).Unix()
+	return s.SQLStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		var rawSql = `SELECT
+			COUNT(*) AS total,
+			COALESCE(SUM(CASE WHEN expires_at IS NULL OR expires_at = 0 OR expires_at > ? THEN 1 ELSE 0 END), 0) AS active,
+			COALESCE(SUM(hit_count), 0) AS hits,
+			COALESCE(SUM(CASE WHEN created_at > ? THEN 1 ELSE 0 END), 0) AS created_recently
+			FROM short_url WHERE org_id = ? AND (deleted_at IS NULL OR deleted_at = 0)`
+
+		var stats models.ShortUrlStats
+		if _, err := dbSession.SQL(rawSql, now.Unix(), createdSince, query.OrgId).Get(&stats); err != nil {
+			return err
+		}
+
+		query.Result = &stats
+		return nil
+	})
+}
+
+// UpdateLastSeenAt records a visit of the short URL,
+// updating its last seen time and incrementing its hit count.
+// If the service has a LastSeenBuffer, the visit is stored on its next flush.
 func (s ShortURLService) UpdateLastSeenAt(ctx context.Context, shortURL *models.ShortUrl) error {
-	shortURL.LastSeenAt = getTime().Unix()
-	return s.SQLStore.WithTransactionalDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
-		_, err := dbSession.ID(shortURL.Id).Update(shortURL)
+	seenAt := getTime()
+	if s.LastSeenBuffer != nil {
+		s.LastSeenBuffer.Record(shortURL, seenAt)
+	} else if err := s.store().UpdateLastSeen(ctx, shortURL, seenAt, 1); err != nil {
+		return err
+	}
+
+	shortURL.LastSeenAt = seenAt.Unix()
+	shortURL.HitCount++
+	return nil
+}
+
+// UpdateShortURLPath changes the path of an existing short URL of the org, keeping its uid,
+// and sets cmd.Result to the updated short URL. Only the user who created it can update it.
+// It returns models.ErrShortURLNotFound if it doesn't exist or is deleted, models.ErrShortURLExpired
+// if it's expired, and models.ErrShortURLForbidden if it was created by another user.
+func (s ShortURLService) UpdateShortURLPath(ctx context.Context, cmd *models.UpdateShortUrlPathCommand) error {
+	path, err := normalizePath(cmd.Path)
+	if err != nil {
+		return err
+	}
+
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var shortURL models.ShortUrl
+		exists, err := session.Where("org_id=? AND uid=?", cmd.OrgId, cmd.Uid).Get(&shortURL)
 		if err != nil {
 			return err
 		}
+		if !exists || shortURL.DeletedAt != 0 {
+			return models.ErrShortURLNotFound
+		}
+		now := getTime().Unix()
+		if shortURL.ExpiresAt != 0 && shortURL.ExpiresAt <= now {
+			return models.ErrShortURLExpired
+		}
+		if shortURL.CreatedBy != cmd.UserId {
+			return models.ErrShortURLForbidden
+		}
 
+		shortURL.Path = path
+		shortURL.UpdatedAt = now
+		if _, err := session.ID(shortURL.Id).Cols("path", "updated_at").Update(&shortURL); err != nil {
+			return err
+		}
+
+		cmd.Result = &shortURL
 		return nil
 	})
 }
 
+// TransferShortURLOwnership transfers the short URLs of the org with the uids in cmd.Uids to the user
+// cmd.UserId in a single transaction, e.g. when their dashboard is transferred, and moves them to the org
+// cmd.NewOrgId, if set. It sets cmd.NumTransferred to the number of transferred short URLs.
+// It returns models.ErrShortURLNotFound if any of them doesn't exist or is deleted,
+// and models.ErrShortURLConflict if any uid is already used in the new org, in which case none is transferred.
+func (s ShortURLService) TransferShortURLOwnership(ctx context.Context, cmd *models.TransferShortUrlOwnershipCommand) error {
+	uids := make([]string, 0, len(cmd.Uids))
+	seen := make(map[string]struct{}, len(cmd.Uids))
+	for _, uid := range cmd.Uids {
+		if _, ok := seen[uid]; ok {
+			continue
+		}
+		seen[uid] = struct{}{}
+		uids = append(uids, uid)
+	}
+
+	orgID := cmd.OrgId
+	if cmd.NewOrgId != 0 {
+		orgID = cmd.NewOrgId
+	}
+
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var numTransferred int64
+		for start := 0; start < len(uids); start += maxUIDsPerQuery {
+			end := start + maxUIDsPerQuery
+			if end > len(uids) {
+				end = len(uids)
+			}
+			batch := uids[start:end]
+
+			count, err := session.Where("org_id=?", cmd.OrgId).
+				In("uid", batch).
+				And("(deleted_at IS NULL OR deleted_at = 0)").
+				Count(&models.ShortUrl{})
+			if err != nil {
+				return err
+			}
+			if count != int64(len(batch)) {
+				return models.ErrShortURLNotFound
+			}
+
+			if orgID != cmd.OrgId {
+				exists, err := session.Where("org_id=?", orgID).In("uid", batch).Exist(&models.ShortUrl{})
+				if err != nil {
+					return err
+				}
+				if exists {
+					return models.ErrShortURLConflict
+				}
+			}
+
+			transferred, err := session.Where("org_id=?", cmd.OrgId).
+				In("uid", batch).
+				Cols("created_by", "org_id", "updated_at").
+				Update(&models.ShortUrl{CreatedBy: cmd.UserId, OrgId: orgID, UpdatedAt: getTime().Unix()})
+			if err != nil {
+				return err
+			}
+			numTransferred += transferred
+		}
+
+		cmd.NumTransferred = numTransferred
+		return nil
+	})
+}
+
+// CreateShortURL creates a short URL for the path, generating a new uid up to maxUIDAttempts times
+// if the generated one is already used or is rejected by the UIDValidator.
+// It returns models.ErrShortURLBadRequest if the path isn't relative to the Grafana root.
 func (s ShortURLService) CreateShortURL(ctx context.Context, user *models.SignedInUser, path string) (*models.ShortUrl, error) {
-	now := time.Now().Unix()
-	shortURL := models.ShortUrl{
-		OrgId:     user.OrgId,
-		Uid:       util.GenerateShortUID(),
+	path, err := normalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if !s.RateLimiter.Allow(user.UserId, 1) {
+		return nil, models.ErrShortURLRateLimited
+	}
+
+	for i := 0; i < maxUIDAttempts; i++ {
+		uid := s.newUID()
+		if err = s.validateUID(uid); err != nil {
+			continue
+		}
+
+		var shortURL *models.ShortUrl
+		shortURL, err = s.createShortURLWithUID(ctx, user, path, uid)
+		if !errors.Is(err, models.ErrShortURLConflict) {
+			return shortURL, err
+		}
+	}
+	return nil, err
+}
+
+// CreateShortURLs creates a short URL for each of cmd.Paths in a single transaction,
+// setting cmd.Result to the created short URLs in the same order.
+// If any of them can't be created, none is.
+func (s ShortURLService) CreateShortURLs(ctx context.Context, cmd *models.CreateShortUrlsBatchCommand) error {
+	paths := make([]string, 0, len(cmd.Paths))
+	for _, p := range cmd.Paths {
+		path, err := normalizePath(p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	if !s.RateLimiter.Allow(cmd.UserId, len(paths)) {
+		return models.ErrShortURLRateLimited
+	}
+
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		shortURLs := make([]*models.ShortUrl, 0, len(paths))
+		for _, path := range paths {
+			var err error
+			for i := 0; i < maxUIDAttempts; i++ {
+				uid := s.newUID()
+				if err = s.validateUID(uid); err != nil {
+					continue
+				}
+
+				shortURL := s.newShortURL(cmd.OrgId, cmd.UserId, path, uid)
+				if err = s.insertShortURL(session, shortURL); err == nil {
+					shortURLs = append(shortURLs, shortURL)
+					break
+				}
+				if !errors.Is(err, models.ErrShortURLConflict) {
+					return err
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		cmd.Result = shortURLs
+		return nil
+	})
+}
+
+// newShortURL returns a short URL created now for the normalized path with the provided uid.
+func (s ShortURLService) newShortURL(orgID int64, userID int64, path string, uid string) *models.ShortUrl {
+	now := getTime()
+	shortURL := &models.ShortUrl{
+		OrgId:     orgID,
+		Uid:       uid,
 		Path:      path,
-		CreatedBy: user.UserId,
-		CreatedAt: now,
+		CreatedBy: userID,
+		CreatedAt: now.Unix(),
+	}
+	if maxLifetime := s.maxLifetime(); maxLifetime > 0 {
+		shortURL.ExpiresAt = now.Add(maxLifetime).Unix()
+	}
+	return shortURL
+}
+
+// createShortURLWithUID creates a short URL for the normalized path with the provided uid.
+// It returns models.ErrShortURLConflict if the uid is already used in the org.
+func (s ShortURLService) createShortURLWithUID(ctx context.Context, user *models.SignedInUser, path string, uid string) (*models.ShortUrl, error) {
+	shortURL := s.newShortURL(user.OrgId, user.UserId, path, uid)
+	if err := s.store().Create(ctx, shortURL); err != nil {
+		return nil, err
+	}
+
+	return shortURL, nil
+}
+
+// insertShortURL inserts the short URL and sets its id.
+// It returns models.ErrShortURLConflict if the uid is already used in the org, and
+// models.ErrShortURLUIDCaseConflict if uids are case-insensitive and a uid only differing by case is.
+func (s ShortURLService) insertShortURL(session *sqlstore.DBSession, shortURL *models.ShortUrl) error {
+	return insertShortURL(session, s.SQLStore.Dialect, shortURL, s.caseInsensitiveUIDs())
+}
+
+// insertShortURL inserts the short URL and sets its id, checking the uids differing by case
+// from its uid if uids are case-insensitive.
+// The uid is only checked first as a fast path: the unique index on the org and uid of short URLs decides
+// between concurrent creations, so that the creation losing the race gets a conflict too.
+func insertShortURL(session *sqlstore.DBSession, dialect migrator.Dialect, shortURL *models.ShortUrl, caseInsensitiveUIDs bool) error {
+	exists, err := session.Where("org_id=? AND uid=?", shortURL.OrgId, shortURL.Uid).Exist(&models.ShortUrl{})
+	if err != nil {
+		return err
+	}
+	if exists {
+		return models.ErrShortURLConflict
+	}
+	if caseInsensitiveUIDs {
+		exists, err := session.Where("org_id=? AND LOWER(uid)=?", shortURL.OrgId, strings.ToLower(shortURL.Uid)).Exist(&models.ShortUrl{})
+		if err != nil {
+			return err
+		}
+		if exists {
+			return models.ErrShortURLUIDCaseConflict
+		}
 	}
 
-	err := s.SQLStore.WithDbSession(ctx, func(session *sqlstore.DBSession) error {
-		_, err := session.Insert(&shortURL)
+	if err := insertShortURLRow(session, dialect, shortURL); err != nil {
 		return err
-	})
+	}
+	if shortURL.Id != 0 {
+		return nil
+	}
+
+	// Not every driver returns the auto-incremented id of inserted rows
+	var inserted models.ShortUrl
+	exists, err = session.Where("org_id=? AND uid=?", shortURL.OrgId, shortURL.Uid).Cols("id").Get(&inserted)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if !exists {
+		return models.ErrShortURLNotFound
 	}
+	shortURL.Id = inserted.Id
+	return nil
+}
 
-	return &shortURL, nil
+// insertShortURLRow inserts the row of the short URL, returning models.ErrShortURLConflict
+// if the unique index on the org and uid of short URLs rejects it.
+func insertShortURLRow(session *sqlstore.DBSession, dialect migrator.Dialect, shortURL *models.ShortUrl) error {
+	if _, err := session.Insert(shortURL); err != nil {
+		if dialect.IsUniqueConstraintViolation(err) {
+			return models.ErrShortURLConflict
+		}
+		return err
+	}
+	return nil
 }
 
+// ExportShortURLs sets query.Result to the short URLs of the org, preserving their uids, so that they can
+// be imported in another Grafana instance with ImportShortURLs. Deleted short URLs are left out.
+func (s ShortURLService) ExportShortURLs(ctx context.Context, query *models.ExportShortUrlsQuery) error {
+	return s.SQLStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		shortURLs := make([]*models.ShortUrl, 0)
+		err := dbSession.Where("org_id=?", query.OrgId).
+			And("(deleted_at IS NULL OR deleted_at = 0)").
+			OrderBy("id").
+			Find(&shortURLs)
+		if err != nil {
+			return err
+		}
+
+		exports := make([]*models.ShortUrlExport, 0, len(shortURLs))
+		for _, shortURL := range shortURLs {
+			exports = append(exports, &models.ShortUrlExport{
+				Uid:        shortURL.Uid,
+				Path:       shortURL.Path,
+				CreatedBy:  shortURL.CreatedBy,
+				CreatedAt:  shortURL.CreatedAt,
+				LastSeenAt: shortURL.LastSeenAt,
+				ExpiresAt:  shortURL.ExpiresAt,
+				HitCount:   shortURL.HitCount,
+			})
+		}
+		query.Result = exports
+		return nil
+	})
+}
+
+// ImportShortURLs imports exported short URLs into the org in a single transaction, preserving their uids
+// so that existing links keep working, and sets cmd.Result to the imported and the skipped uids.
+// Short URLs whose uid already exists for the same path are updated with the imported visits and expiry,
+// so that an import can be repeated, while those whose uid is used for another path are skipped.
+// The users who created the short URLs are kept as is.
+// It returns an error wrapping models.ErrShortURLInvalidUID if any uid is rejected by the UIDValidator,
+// or a path validation error if any path is invalid, in which case none is imported.
+func (s ShortURLService) ImportShortURLs(ctx context.Context, cmd *models.ImportShortUrlsCommand) error {
+	shortURLs := make([]*models.ShortUrl, 0, len(cmd.ShortUrls))
+	for _, export := range cmd.ShortUrls {
+		if err := s.validateUID(export.Uid); err != nil {
+			return err
+		}
+		path, err := normalizePath(export.Path)
+		if err != nil {
+			return err
+		}
+		shortURLs = append(shortURLs, &models.ShortUrl{
+			OrgId:      cmd.OrgId,
+			Uid:        export.Uid,
+			Path:       path,
+			CreatedBy:  export.CreatedBy,
+			CreatedAt:  export.CreatedAt,
+			LastSeenAt: export.LastSeenAt,
+			ExpiresAt:  export.ExpiresAt,
+			HitCount:   export.HitCount,
+		})
+	}
+
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		report := &models.ShortUrlImportReport{Imported: []string{}, Skipped: []string{}}
+		for _, shortURL := range shortURLs {
+			var existing models.ShortUrl
+			exists, err := session.Where("org_id=? AND uid=?", cmd.OrgId, shortURL.Uid).Get(&existing)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case !exists:
+				err := s.insertShortURL(session, shortURL)
+				if errors.Is(err, models.ErrShortURLUIDCaseConflict) {
+					report.Skipped = append(report.Skipped, shortURL.Uid)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			case existing.Path == shortURL.Path && existing.DeletedAt == 0:
+				shortURL.Id = existing.Id
+				if _, err := session.ID(existing.Id).Cols("last_seen_at", "expires_at", "hit_count").Update(shortURL); err != nil {
+					return err
+				}
+			default:
+				report.Skipped = append(report.Skipped, shortURL.Uid)
+				continue
+			}
+			report.Imported = append(report.Imported, shortURL.Uid)
+		}
+
+		cmd.Result = report
+		return nil
+	})
+}
+
+// DeleteStaleShortURLs deletes the short URLs that have never been visited since cmd.OlderThan,
+// the ones that haven't been visited again since cmd.LastSeenOlderThan (if set) and the expired ones.
 func (s ShortURLService) DeleteStaleShortURLs(ctx context.Context, cmd *models.DeleteShortUrlCommand) error {
+	return s.store().DeleteStale(ctx, cmd)
+}
+
+// DeleteShortURL soft deletes the short URL so that it can't be visited anymore
+// while keeping it for auditing until it's purged.
+// It returns models.ErrShortURLNotFound if there is no such short URL or if it's already deleted.
+func (s ShortURLService) DeleteShortURL(ctx context.Context, cmd *models.DeleteShortUrlByUidCommand) error {
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var rawSql = "UPDATE short_url SET deleted_at = ? WHERE org_id = ? AND uid = ? AND (deleted_at IS NULL OR deleted_at = 0)"
+
+		result, err := session.Exec(rawSql, getTime().Unix(), cmd.OrgId, cmd.Uid)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return models.ErrShortURLNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteShortURLsByUser permanently deletes the short URLs created by the user in every org,
+// e.g. when the user account is deleted.
+func (s ShortURLService) DeleteShortURLsByUser(ctx context.Context, cmd *models.DeleteShortUrlsByUserCommand) error {
+	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var rawSql = "DELETE FROM short_url WHERE created_by = ?"
+
+		if result, err := session.Exec(rawSql, cmd.UserId); err != nil {
+			return err
+		} else if cmd.NumDeleted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// PurgeDeletedShortURLs permanently deletes the short URLs soft deleted before cmd.DeletedBefore.
+func (s ShortURLService) PurgeDeletedShortURLs(ctx context.Context, cmd *models.PurgeDeletedShortUrlsCommand) error {
 	return s.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
-		var rawSql = "DELETE FROM short_url WHERE created_at <= ? AND (last_seen_at IS NULL OR last_seen_at = 0)"
+		var rawSql = "DELETE FROM short_url WHERE deleted_at > 0 AND deleted_at <= ?"
 
-		if result, err := session.Exec(rawSql, cmd.OlderThan.Unix()); err != nil {
+		if result, err := session.Exec(rawSql, cmd.DeletedBefore.Unix()); err != nil {
 			return err
 		} else if cmd.NumDeleted, err = result.RowsAffected(); err != nil {
 			return err
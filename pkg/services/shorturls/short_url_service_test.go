@@ -2,11 +2,15 @@ package shorturls
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,6 +50,15 @@ func TestShortURLService(t *testing.T) {
 			updatedShortURL, err := service.GetShortURLByUID(context.Background(), user, existingShortURL.Uid)
 			require.NoError(t, err)
 			require.Equal(t, expectedTime.Unix(), updatedShortURL.LastSeenAt)
+			require.Equal(t, int64(1), updatedShortURL.HitCount)
+
+			err = service.UpdateLastSeenAt(context.Background(), updatedShortURL)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), updatedShortURL.HitCount)
+
+			updatedShortURL, err = service.GetShortURLByUID(context.Background(), user, existingShortURL.Uid)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), updatedShortURL.HitCount)
 		})
 
 		t.Run("and stale short urls can be deleted", func(t *testing.T) {
@@ -74,6 +87,715 @@ func TestShortURLService(t *testing.T) {
 		})
 	})
 
+	t.Run("Short URLs expire after their max lifetime", func(t *testing.T) {
+		origGetTime := getTime
+		t.Cleanup(func() {
+			getTime = origGetTime
+		})
+
+		createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+		getTime = func() time.Time {
+			return createdAt
+		}
+
+		service := ShortURLService{SQLStore: sqlStore, Cfg: &setting.Cfg{ShortLinkMaxLifetime: time.Hour}}
+
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?expiring=true")
+		require.NoError(t, err)
+		require.Equal(t, createdAt.Add(time.Hour).Unix(), shortURL.ExpiresAt)
+
+		_, err = service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.NoError(t, err)
+
+		getTime = func() time.Time {
+			return createdAt.Add(time.Hour)
+		}
+
+		expiredShortURL, err := service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.Equal(t, models.ErrShortURLExpired, err)
+		require.Nil(t, expiredShortURL)
+
+		cmd := models.DeleteShortUrlCommand{OlderThan: createdAt.Add(-time.Hour)}
+		err = service.DeleteStaleShortURLs(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), cmd.NumDeleted)
+	})
+
+	t.Run("Visited short URLs are deleted once inactive", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?inactive=true")
+		require.NoError(t, err)
+		err = service.UpdateLastSeenAt(context.Background(), shortURL)
+		require.NoError(t, err)
+
+		cmd := models.DeleteShortUrlCommand{OlderThan: time.Unix(shortURL.CreatedAt, 0)}
+		err = service.DeleteStaleShortURLs(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), cmd.NumDeleted)
+
+		cmd = models.DeleteShortUrlCommand{
+			OlderThan:         time.Unix(shortURL.CreatedAt, 0),
+			LastSeenOlderThan: time.Unix(shortURL.LastSeenAt, 0),
+		}
+		err = service.DeleteStaleShortURLs(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.NotZero(t, cmd.NumDeleted)
+
+		_, err = service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.Equal(t, models.ErrShortURLNotFound, err)
+	})
+
+	t.Run("User cannot look up short URLs of another org", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+
+		shortURL, err := service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 1, OrgId: 1}, "mock/path?org=1")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), shortURL.OrgId)
+
+		_, err = service.GetShortURLByUID(context.Background(), &models.SignedInUser{UserId: 2, OrgId: 2}, shortURL.Uid)
+		require.Equal(t, models.ErrShortURLNotFound, err)
+	})
+
+	t.Run("Short URL uid conflicts are retried with a new uid", func(t *testing.T) {
+		origGenerateUID := generateUID
+		t.Cleanup(func() {
+			generateUID = origGenerateUID
+		})
+
+		service := ShortURLService{SQLStore: sqlStore}
+
+		existingShortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?conflict=true")
+		require.NoError(t, err)
+
+		_, err = service.createShortURLWithUID(context.Background(), user, "mock/path", existingShortURL.Uid)
+		require.Equal(t, models.ErrShortURLConflict, err)
+
+		uids := []string{existingShortURL.Uid, existingShortURL.Uid, "newuid"}
+		generateUID = func(int) string {
+			uid := uids[0]
+			uids = uids[1:]
+			return uid
+		}
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path")
+		require.NoError(t, err)
+		require.Equal(t, "newuid", shortURL.Uid)
+
+		generateUID = func(int) string {
+			return existingShortURL.Uid
+		}
+		_, err = service.CreateShortURL(context.Background(), user, "mock/path")
+		require.Equal(t, models.ErrShortURLConflict, err)
+	})
+
+	t.Run("Short URL uids are validated", func(t *testing.T) {
+		origGenerateUID := generateUID
+		t.Cleanup(func() {
+			generateUID = origGenerateUID
+		})
+
+		service := ShortURLService{SQLStore: sqlStore, UIDValidator: func(uid string) error {
+			if strings.ContainsAny(uid, "0O1l") {
+				return fmt.Errorf("uid contains ambiguous characters")
+			}
+			return nil
+		}}
+
+		uids := []string{"ambiguous0", "unambiguous"}
+		generateUID = func(int) string {
+			uid := uids[0]
+			uids = uids[1:]
+			return uid
+		}
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?validated=true")
+		require.NoError(t, err)
+		require.Equal(t, "unambiguous", shortURL.Uid, "rejected uids are generated again")
+
+		generateUID = func(int) string {
+			return "ambiguous0"
+		}
+		_, err = service.CreateShortURL(context.Background(), user, "mock/path?validated=false")
+		require.True(t, errors.Is(err, models.ErrShortURLInvalidUID))
+		require.EqualError(t, err, "short URL uid is invalid: uid contains ambiguous characters")
+
+		_, err = service.GetShortURLByUID(context.Background(), user, "ambiguous0")
+		require.True(t, errors.Is(err, models.ErrShortURLInvalidUID))
+		_, err = ShortURLService{SQLStore: sqlStore}.GetShortURLByUID(context.Background(), user, "in/valid")
+		require.True(t, errors.Is(err, models.ErrShortURLInvalidUID))
+	})
+
+	t.Run("Short URL uids have the configured length", func(t *testing.T) {
+		cfg := setting.NewCfg()
+		cfg.ShortLinkUIDLength = 16
+		service := ShortURLService{SQLStore: sqlStore, Cfg: cfg}
+
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?length=16")
+		require.NoError(t, err)
+		require.Len(t, shortURL.Uid, 16)
+
+		service = ShortURLService{SQLStore: sqlStore}
+		shortURL, err = service.CreateShortURL(context.Background(), user, "mock/path?length=default")
+		require.NoError(t, err)
+		require.Len(t, shortURL.Uid, DefaultUIDLength)
+	})
+
+	t.Run("Created short URLs are fully populated", func(t *testing.T) {
+		origGetTime := getTime
+		t.Cleanup(func() {
+			getTime = origGetTime
+		})
+
+		createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+		getTime = func() time.Time {
+			return createdAt
+		}
+
+		cfg := setting.NewCfg()
+		cfg.ShortLinkMaxLifetime = time.Hour
+		service := ShortURLService{SQLStore: sqlStore, Cfg: cfg}
+
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?populated=true")
+		require.NoError(t, err)
+		require.NotZero(t, shortURL.Id)
+		require.Equal(t, createdAt.Unix(), shortURL.CreatedAt)
+		require.Equal(t, createdAt.Add(time.Hour).Unix(), shortURL.ExpiresAt)
+
+		existingShortURL, err := service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.NoError(t, err)
+		require.Equal(t, shortURL, existingShortURL)
+	})
+
+	t.Run("User can list their short URLs", func(t *testing.T) {
+		origGetTime := getTime
+		t.Cleanup(func() {
+			getTime = origGetTime
+		})
+
+		service := ShortURLService{SQLStore: sqlStore}
+		listUser := &models.SignedInUser{UserId: 10, OrgId: 1}
+		createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+
+		uids := make([]string, 0)
+		for i := 0; i < 3; i++ {
+			getTime = func() time.Time {
+				return createdAt.Add(time.Duration(i) * time.Minute)
+			}
+			shortURL, err := service.CreateShortURL(context.Background(), listUser, "mock/path?list=true")
+			require.NoError(t, err)
+			uids = append(uids, shortURL.Uid)
+		}
+		_, err := service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 11, OrgId: 1}, "mock/path?list=true")
+		require.NoError(t, err)
+
+		query := models.GetShortUrlsByUserQuery{OrgId: 1, UserId: 10}
+		err = service.GetShortURLsByUser(context.Background(), &query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 3)
+		require.Equal(t, uids[2], query.Result[0].Uid)
+		require.Equal(t, uids[0], query.Result[2].Uid)
+
+		query = models.GetShortUrlsByUserQuery{OrgId: 1, UserId: 10, Limit: 1, Offset: 1}
+		err = service.GetShortURLsByUser(context.Background(), &query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 1)
+		require.Equal(t, uids[1], query.Result[0].Uid)
+
+		query = models.GetShortUrlsByUserQuery{OrgId: 1, UserId: 10, CreatedAfter: createdAt.Unix()}
+		err = service.GetShortURLsByUser(context.Background(), &query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 2)
+		require.Equal(t, uids[2], query.Result[0].Uid)
+		require.Equal(t, uids[1], query.Result[1].Uid)
+
+		query = models.GetShortUrlsByUserQuery{
+			OrgId:         1,
+			UserId:        10,
+			CreatedAfter:  createdAt.Unix(),
+			CreatedBefore: createdAt.Add(2 * time.Minute).Unix(),
+		}
+		err = service.GetShortURLsByUser(context.Background(), &query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 1)
+		require.Equal(t, uids[1], query.Result[0].Uid)
+	})
+
+	t.Run("Short URLs are reused for the same path", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+		dedupUser := &models.SignedInUser{UserId: 20, OrgId: 1}
+
+		shortURL, err := service.GetOrCreateShortURL(context.Background(), dedupUser, "mock/path?dedup=true")
+		require.NoError(t, err)
+
+		sameShortURL, err := service.GetOrCreateShortURL(context.Background(), dedupUser, "  mock/path?dedup=true ")
+		require.NoError(t, err)
+		require.Equal(t, shortURL.Uid, sameShortURL.Uid)
+
+		otherUserShortURL, err := service.GetOrCreateShortURL(context.Background(), &models.SignedInUser{UserId: 21, OrgId: 1}, "mock/path?dedup=true")
+		require.NoError(t, err)
+		require.NotEqual(t, shortURL.Uid, otherUserShortURL.Uid)
+
+		_, err = service.GetShortURLByPath(context.Background(), dedupUser, "mock/path?dedup=false")
+		require.Equal(t, models.ErrShortURLNotFound, err)
+	})
+
+	t.Run("User can create short URLs in batch", func(t *testing.T) {
+		origGenerateUID := generateUID
+		t.Cleanup(func() {
+			generateUID = origGenerateUID
+		})
+
+		service := ShortURLService{SQLStore: sqlStore}
+		batchUser := &models.SignedInUser{UserId: 30, OrgId: 1}
+
+		cmd := models.CreateShortUrlsBatchCommand{
+			OrgId:  batchUser.OrgId,
+			UserId: batchUser.UserId,
+			Paths:  []string{"mock/path?batch=1", "/mock/path?batch=2", "mock/path?batch=3"},
+		}
+		err := service.CreateShortURLs(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Len(t, cmd.Result, 3)
+		require.Equal(t, "mock/path?batch=2", cmd.Result[1].Path)
+		for _, shortURL := range cmd.Result {
+			existingShortURL, err := service.GetShortURLByUID(context.Background(), batchUser, shortURL.Uid)
+			require.NoError(t, err)
+			require.Equal(t, shortURL.Path, existingShortURL.Path)
+		}
+
+		t.Run("and none is created if any fails", func(t *testing.T) {
+			uids := []string{"batchuid", cmd.Result[0].Uid, cmd.Result[0].Uid, cmd.Result[0].Uid}
+			generateUID = func(int) string {
+				uid := uids[0]
+				uids = uids[1:]
+				return uid
+			}
+			failingCmd := models.CreateShortUrlsBatchCommand{
+				OrgId:  batchUser.OrgId,
+				UserId: batchUser.UserId,
+				Paths:  []string{"mock/path?batch=4", "mock/path?batch=5"},
+			}
+			err := service.CreateShortURLs(context.Background(), &failingCmd)
+			require.Equal(t, models.ErrShortURLConflict, err)
+			require.Empty(t, failingCmd.Result)
+
+			_, err = service.GetShortURLByUID(context.Background(), batchUser, "batchuid")
+			require.Equal(t, models.ErrShortURLNotFound, err)
+
+			failingCmd.Paths = []string{"mock/path?batch=6", "http://evil.com"}
+			err = service.CreateShortURLs(context.Background(), &failingCmd)
+			require.Equal(t, models.ErrShortURLBadRequest, err)
+		})
+	})
+
+	t.Run("Short URLs of a user are deleted with the user", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+		deletedUser := &models.SignedInUser{UserId: 40, OrgId: 1}
+
+		shortURL, err := service.CreateShortURL(context.Background(), deletedUser, "mock/path?user=deleted")
+		require.NoError(t, err)
+		otherOrgShortURL, err := service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 40, OrgId: 2}, "mock/path?user=deleted")
+		require.NoError(t, err)
+		otherUserShortURL, err := service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 41, OrgId: 1}, "mock/path?user=deleted")
+		require.NoError(t, err)
+
+		cmd := models.DeleteShortUrlsByUserCommand{UserId: 40}
+		err = service.DeleteShortURLsByUser(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cmd.NumDeleted)
+
+		_, err = service.GetShortURLByUID(context.Background(), deletedUser, shortURL.Uid)
+		require.Equal(t, models.ErrShortURLNotFound, err)
+		_, err = service.GetShortURLByUID(context.Background(), &models.SignedInUser{UserId: 40, OrgId: 2}, otherOrgShortURL.Uid)
+		require.Equal(t, models.ErrShortURLNotFound, err)
+		_, err = service.GetShortURLByUID(context.Background(), &models.SignedInUser{UserId: 41, OrgId: 1}, otherUserShortURL.Uid)
+		require.NoError(t, err)
+	})
+
+	t.Run("Short URL stats are aggregated per org", func(t *testing.T) {
+		origGetTime := getTime
+		t.Cleanup(func() {
+			getTime = origGetTime
+		})
+
+		now := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+		statsUser := &models.SignedInUser{UserId: 1, OrgId: 50}
+		service := ShortURLService{SQLStore: sqlStore, Cfg: &setting.Cfg{ShortLinkMaxLifetime: 24 * time.Hour}}
+
+		create := func(createdAt time.Time, path string) *models.ShortUrl {
+			getTime = func() time.Time {
+				return createdAt
+			}
+			shortURL, err := service.CreateShortURL(context.Background(), statsUser, path)
+			require.NoError(t, err)
+			return shortURL
+		}
+		expired := create(now.AddDate(0, 0, -10), "mock/path?stats=expired")
+		visited := create(now.Add(-time.Hour), "mock/path?stats=visited")
+		create(now.Add(-time.Minute), "mock/path?stats=recent")
+		deleted := create(now.Add(-time.Minute), "mock/path?stats=deleted")
+
+		getTime = func() time.Time {
+			return now
+		}
+		for _, shortURL := range []*models.ShortUrl{expired, visited, visited} {
+			require.NoError(t, service.UpdateLastSeenAt(context.Background(), shortURL))
+		}
+		err := service.DeleteShortURL(context.Background(), &models.DeleteShortUrlByUidCommand{OrgId: deleted.OrgId, Uid: deleted.Uid})
+		require.NoError(t, err)
+		_, err = service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 1, OrgId: 51}, "mock/path?stats=other-org")
+		require.NoError(t, err)
+
+		query := models.GetShortUrlStatsQuery{OrgId: 50, CreatedWithinDays: 7}
+		err = service.GetShortURLStats(context.Background(), &query)
+		require.NoError(t, err)
+		require.Equal(t, &models.ShortUrlStats{Total: 3, Active: 2, Hits: 3, CreatedRecently: 2}, query.Result)
+
+		err = service.PurgeDeletedShortURLs(context.Background(), &models.PurgeDeletedShortUrlsCommand{DeletedBefore: now})
+		require.NoError(t, err)
+	})
+
+	t.Run("User can update the path of their short URLs", func(t *testing.T) {
+		origGetTime := getTime
+		t.Cleanup(func() {
+			getTime = origGetTime
+		})
+
+		service := ShortURLService{SQLStore: sqlStore}
+		owner := &models.SignedInUser{UserId: 60, OrgId: 1}
+		shortURL, err := service.CreateShortURL(context.Background(), owner, "mock/path?version=1")
+		require.NoError(t, err)
+
+		updatedAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+		getTime = func() time.Time {
+			return updatedAt
+		}
+
+		cmd := models.UpdateShortUrlPathCommand{OrgId: 1, UserId: 60, Uid: shortURL.Uid, Path: "/mock/path?version=2"}
+		err = service.UpdateShortURLPath(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, shortURL.Id, cmd.Result.Id)
+		require.Equal(t, "mock/path?version=2", cmd.Result.Path)
+		require.Equal(t, updatedAt.Unix(), cmd.Result.UpdatedAt)
+
+		existingShortURL, err := service.GetShortURLByUID(context.Background(), owner, shortURL.Uid)
+		require.NoError(t, err)
+		require.Equal(t, "mock/path?version=2", existingShortURL.Path)
+		require.Equal(t, updatedAt.Unix(), existingShortURL.UpdatedAt)
+
+		t.Run("but not of other users' short URLs", func(t *testing.T) {
+			cmd := models.UpdateShortUrlPathCommand{OrgId: 1, UserId: 61, Uid: shortURL.Uid, Path: "mock/path?version=3"}
+			err := service.UpdateShortURLPath(context.Background(), &cmd)
+			require.Equal(t, models.ErrShortURLForbidden, err)
+
+			cmd = models.UpdateShortUrlPathCommand{OrgId: 2, UserId: 60, Uid: shortURL.Uid, Path: "mock/path?version=3"}
+			err = service.UpdateShortURLPath(context.Background(), &cmd)
+			require.Equal(t, models.ErrShortURLNotFound, err)
+		})
+
+		t.Run("nor to an unsafe path", func(t *testing.T) {
+			cmd := models.UpdateShortUrlPathCommand{OrgId: 1, UserId: 60, Uid: shortURL.Uid, Path: "https://evil.com"}
+			err := service.UpdateShortURLPath(context.Background(), &cmd)
+			require.Equal(t, models.ErrShortURLBadRequest, err)
+		})
+	})
+
+	t.Run("Short URL creations are rate limited per user", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore, RateLimiter: NewRateLimiter(0, 2)}
+		limitedUser := &models.SignedInUser{UserId: 70, OrgId: 1}
+
+		cmd := models.CreateShortUrlsBatchCommand{OrgId: 1, UserId: 70, Paths: []string{"mock/path?limited=1", "mock/path?limited=2"}}
+		err := service.CreateShortURLs(context.Background(), &cmd)
+		require.NoError(t, err)
+
+		_, err = service.CreateShortURL(context.Background(), limitedUser, "mock/path?limited=3")
+		require.Equal(t, models.ErrShortURLRateLimited, err)
+
+		shortURL, err := service.GetOrCreateShortURL(context.Background(), limitedUser, "mock/path?limited=1")
+		require.NoError(t, err, "existing short URLs are still reused")
+		require.Equal(t, cmd.Result[0].Uid, shortURL.Uid)
+
+		_, err = service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 71, OrgId: 1}, "mock/path?limited=3")
+		require.NoError(t, err)
+	})
+
+	t.Run("User can resolve many short URLs at once", func(t *testing.T) {
+		origGetTime := getTime
+		t.Cleanup(func() {
+			getTime = origGetTime
+		})
+
+		createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+		getTime = func() time.Time {
+			return createdAt
+		}
+
+		service := ShortURLService{SQLStore: sqlStore}
+		resolvingUser := &models.SignedInUser{UserId: 80, OrgId: 1}
+		first, err := service.CreateShortURL(context.Background(), resolvingUser, "mock/path?bulk=1")
+		require.NoError(t, err)
+		second, err := service.CreateShortURL(context.Background(), resolvingUser, "mock/path?bulk=2")
+		require.NoError(t, err)
+		otherOrg, err := service.CreateShortURL(context.Background(), &models.SignedInUser{UserId: 80, OrgId: 2}, "mock/path?bulk=3")
+		require.NoError(t, err)
+		deleted, err := service.CreateShortURL(context.Background(), resolvingUser, "mock/path?bulk=4")
+		require.NoError(t, err)
+		err = service.DeleteShortURL(context.Background(), &models.DeleteShortUrlByUidCommand{OrgId: 1, Uid: deleted.Uid})
+		require.NoError(t, err)
+		expiringService := ShortURLService{SQLStore: sqlStore, Cfg: &setting.Cfg{ShortLinkMaxLifetime: time.Hour}}
+		expired, err := expiringService.CreateShortURL(context.Background(), resolvingUser, "mock/path?bulk=5")
+		require.NoError(t, err)
+
+		getTime = func() time.Time {
+			return createdAt.Add(time.Hour)
+		}
+
+		query := models.GetShortUrlPathsByUidsQuery{
+			OrgId: 1,
+			Uids:  []string{first.Uid, second.Uid, otherOrg.Uid, deleted.Uid, expired.Uid, "missing"},
+		}
+		err = service.GetShortURLPathsByUIDs(context.Background(), &query)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{first.Uid: "mock/path?bulk=1", second.Uid: "mock/path?bulk=2"}, query.Result)
+
+		err = service.PurgeDeletedShortURLs(context.Background(), &models.PurgeDeletedShortUrlsCommand{DeletedBefore: createdAt})
+		require.NoError(t, err)
+
+		t.Run("in batches", func(t *testing.T) {
+			uids := make([]string, 0, maxUIDsPerQuery+1)
+			for i := 0; i < maxUIDsPerQuery; i++ {
+				uids = append(uids, fmt.Sprintf("missing%d", i))
+			}
+			query := models.GetShortUrlPathsByUidsQuery{OrgId: 1, Uids: append(uids, second.Uid)}
+			err := service.GetShortURLPathsByUIDs(context.Background(), &query)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{second.Uid: "mock/path?bulk=2"}, query.Result)
+		})
+	})
+
+	t.Run("Short URLs can be exported and imported in another org", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+		exportingUser := &models.SignedInUser{UserId: 90, OrgId: 90}
+		first, err := service.CreateShortURL(context.Background(), exportingUser, "mock/path?export=1")
+		require.NoError(t, err)
+		require.NoError(t, service.UpdateLastSeenAt(context.Background(), first))
+		second, err := service.CreateShortURL(context.Background(), exportingUser, "mock/path?export=2")
+		require.NoError(t, err)
+		deleted, err := service.CreateShortURL(context.Background(), exportingUser, "mock/path?export=3")
+		require.NoError(t, err)
+		err = service.DeleteShortURL(context.Background(), &models.DeleteShortUrlByUidCommand{OrgId: 90, Uid: deleted.Uid})
+		require.NoError(t, err)
+
+		query := models.ExportShortUrlsQuery{OrgId: 90}
+		err = service.ExportShortURLs(context.Background(), &query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 2)
+		require.Equal(t, first.Uid, query.Result[0].Uid)
+		require.Equal(t, "mock/path?export=1", query.Result[0].Path)
+		require.Equal(t, int64(1), query.Result[0].HitCount)
+		require.Equal(t, second.Uid, query.Result[1].Uid)
+
+		importingUser := &models.SignedInUser{UserId: 90, OrgId: 91}
+		conflicting, err := service.createShortURLWithUID(context.Background(), importingUser, "mock/path?export=other", second.Uid)
+		require.NoError(t, err)
+
+		cmd := models.ImportShortUrlsCommand{OrgId: 91, ShortUrls: query.Result}
+		err = service.ImportShortURLs(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, &models.ShortUrlImportReport{Imported: []string{first.Uid}, Skipped: []string{second.Uid}}, cmd.Result)
+
+		imported, err := service.GetShortURLByUID(context.Background(), importingUser, first.Uid)
+		require.NoError(t, err)
+		require.Equal(t, first.Path, imported.Path)
+		require.Equal(t, first.CreatedAt, imported.CreatedAt)
+		require.Equal(t, int64(1), imported.HitCount)
+		notImported, err := service.GetShortURLByUID(context.Background(), importingUser, second.Uid)
+		require.NoError(t, err)
+		require.Equal(t, conflicting.Path, notImported.Path)
+
+		t.Run("repeatedly", func(t *testing.T) {
+			require.NoError(t, service.UpdateLastSeenAt(context.Background(), first))
+			err := service.ExportShortURLs(context.Background(), &query)
+			require.NoError(t, err)
+
+			cmd := models.ImportShortUrlsCommand{OrgId: 91, ShortUrls: query.Result}
+			err = service.ImportShortURLs(context.Background(), &cmd)
+			require.NoError(t, err)
+			require.Equal(t, []string{first.Uid}, cmd.Result.Imported)
+
+			imported, err := service.GetShortURLByUID(context.Background(), importingUser, first.Uid)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), imported.HitCount)
+		})
+
+		t.Run("but not with invalid short URLs", func(t *testing.T) {
+			cmd := models.ImportShortUrlsCommand{OrgId: 92, ShortUrls: []*models.ShortUrlExport{
+				{Uid: "valid", Path: "mock/path?export=4"},
+				{Uid: "in/valid", Path: "mock/path?export=5"},
+			}}
+			err := service.ImportShortURLs(context.Background(), &cmd)
+			require.True(t, errors.Is(err, models.ErrShortURLInvalidUID))
+
+			cmd = models.ImportShortUrlsCommand{OrgId: 92, ShortUrls: []*models.ShortUrlExport{{Uid: "valid", Path: "https://evil.com"}}}
+			err = service.ImportShortURLs(context.Background(), &cmd)
+			require.Equal(t, models.ErrShortURLBadRequest, err)
+
+			query := models.ExportShortUrlsQuery{OrgId: 92}
+			err = service.ExportShortURLs(context.Background(), &query)
+			require.NoError(t, err)
+			require.Empty(t, query.Result)
+		})
+
+		err = service.PurgeDeletedShortURLs(context.Background(), &models.PurgeDeletedShortUrlsCommand{DeletedBefore: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+	})
+
+	t.Run("Short URL ownership can be transferred", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+		owner := &models.SignedInUser{UserId: 100, OrgId: 100}
+		first, err := service.CreateShortURL(context.Background(), owner, "mock/path?transfer=1")
+		require.NoError(t, err)
+		second, err := service.CreateShortURL(context.Background(), owner, "mock/path?transfer=2")
+		require.NoError(t, err)
+
+		cmd := models.TransferShortUrlOwnershipCommand{OrgId: 100, Uids: []string{first.Uid, second.Uid, first.Uid}, UserId: 101}
+		err = service.TransferShortURLOwnership(context.Background(), &cmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cmd.NumTransferred)
+
+		transferred, err := service.GetShortURLByUID(context.Background(), owner, first.Uid)
+		require.NoError(t, err)
+		require.Equal(t, int64(101), transferred.CreatedBy)
+		require.Equal(t, "mock/path?transfer=1", transferred.Path)
+
+		t.Run("to another org", func(t *testing.T) {
+			cmd := models.TransferShortUrlOwnershipCommand{OrgId: 100, Uids: []string{second.Uid}, UserId: 102, NewOrgId: 101}
+			err := service.TransferShortURLOwnership(context.Background(), &cmd)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), cmd.NumTransferred)
+
+			_, err = service.GetShortURLByUID(context.Background(), owner, second.Uid)
+			require.Equal(t, models.ErrShortURLNotFound, err)
+			transferred, err := service.GetShortURLByUID(context.Background(), &models.SignedInUser{UserId: 102, OrgId: 101}, second.Uid)
+			require.NoError(t, err)
+			require.Equal(t, int64(102), transferred.CreatedBy)
+
+			_, err = service.createShortURLWithUID(context.Background(), owner, "mock/path?transfer=3", second.Uid)
+			require.NoError(t, err)
+			cmd = models.TransferShortUrlOwnershipCommand{OrgId: 100, Uids: []string{first.Uid, second.Uid}, UserId: 102, NewOrgId: 101}
+			err = service.TransferShortURLOwnership(context.Background(), &cmd)
+			require.Equal(t, models.ErrShortURLConflict, err)
+		})
+
+		t.Run("only if every short URL exists", func(t *testing.T) {
+			cmd := models.TransferShortUrlOwnershipCommand{OrgId: 100, Uids: []string{first.Uid, "missing"}, UserId: 103}
+			err := service.TransferShortURLOwnership(context.Background(), &cmd)
+			require.Equal(t, models.ErrShortURLNotFound, err)
+
+			notTransferred, err := service.GetShortURLByUID(context.Background(), owner, first.Uid)
+			require.NoError(t, err)
+			require.Equal(t, int64(101), notTransferred.CreatedBy)
+		})
+	})
+
+	t.Run("Deleted short URLs are kept until purged", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+
+		shortURL, err := service.CreateShortURL(context.Background(), user, "mock/path?deleted=true")
+		require.NoError(t, err)
+
+		cmd := models.DeleteShortUrlByUidCommand{OrgId: shortURL.OrgId, Uid: shortURL.Uid}
+		err = service.DeleteShortURL(context.Background(), &cmd)
+		require.NoError(t, err)
+
+		_, err = service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+		require.Equal(t, models.ErrShortURLNotFound, err)
+
+		err = service.DeleteShortURL(context.Background(), &cmd)
+		require.Equal(t, models.ErrShortURLNotFound, err)
+
+		var count int64
+		err = sqlStore.WithDbSession(context.Background(), func(dbSession *sqlstore.DBSession) error {
+			var err error
+			count, err = dbSession.Where("uid=?", shortURL.Uid).Count(&models.ShortUrl{})
+			return err
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count)
+
+		purgeCmd := models.PurgeDeletedShortUrlsCommand{DeletedBefore: time.Now().Add(time.Minute)}
+		err = service.PurgeDeletedShortURLs(context.Background(), &purgeCmd)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purgeCmd.NumDeleted)
+	})
+
+	t.Run("Short URL uids can be case-insensitive", func(t *testing.T) {
+		origGenerateUID := generateUID
+		t.Cleanup(func() {
+			generateUID = origGenerateUID
+		})
+
+		service := ShortURLService{SQLStore: sqlStore}
+		insensitiveService := ShortURLService{SQLStore: sqlStore, Cfg: &setting.Cfg{ShortLinkCaseInsensitiveUIDs: true}}
+		caseUser := &models.SignedInUser{UserId: 120, OrgId: 120}
+
+		generateUID = func(int) string {
+			return "MixedCase"
+		}
+		shortURL, err := insensitiveService.CreateShortURL(context.Background(), caseUser, "mock/path?case=1")
+		require.NoError(t, err)
+		require.Equal(t, "mixedcase", shortURL.Uid)
+
+		resolved, err := insensitiveService.GetShortURLByUID(context.Background(), caseUser, "MIXEDcase")
+		require.NoError(t, err)
+		require.Equal(t, shortURL.Id, resolved.Id)
+		_, err = service.GetShortURLByUID(context.Background(), caseUser, "MIXEDcase")
+		require.Equal(t, models.ErrShortURLNotFound, err, "uids are case-sensitive by default")
+
+		t.Run("without colliding with uids differing by case", func(t *testing.T) {
+			upper, err := service.createShortURLWithUID(context.Background(), caseUser, "mock/path?case=2", "LegacyUID")
+			require.NoError(t, err)
+			lower, err := service.createShortURLWithUID(context.Background(), caseUser, "mock/path?case=3", "legacyuid")
+			require.NoError(t, err)
+
+			resolved, err := insensitiveService.GetShortURLByUID(context.Background(), caseUser, "LegacyUID")
+			require.NoError(t, err)
+			require.Equal(t, upper.Id, resolved.Id)
+			resolved, err = insensitiveService.GetShortURLByUID(context.Background(), caseUser, "legacyuid")
+			require.NoError(t, err)
+			require.Equal(t, lower.Id, resolved.Id)
+			_, err = insensitiveService.GetShortURLByUID(context.Background(), caseUser, "LEGACYUID")
+			require.Equal(t, models.ErrShortURLUIDCaseConflict, err)
+
+			_, err = insensitiveService.createShortURLWithUID(context.Background(), caseUser, "mock/path?case=4", "MIXEDCASE")
+			require.Equal(t, models.ErrShortURLUIDCaseConflict, err)
+			require.True(t, errors.Is(err, models.ErrShortURLConflict))
+
+			uids := []string{"MIXEDCASE", "OtherCase"}
+			generateUID = func(int) string {
+				uid := uids[0]
+				uids = uids[1:]
+				return uid
+			}
+			shortURL, err := insensitiveService.CreateShortURL(context.Background(), caseUser, "mock/path?case=5")
+			require.NoError(t, err, "conflicting generated uids are retried")
+			require.Equal(t, "othercase", shortURL.Uid)
+		})
+	})
+
+	t.Run("Concurrently created short URLs with the same uid conflict", func(t *testing.T) {
+		service := ShortURLService{SQLStore: sqlStore}
+		raceUser := &models.SignedInUser{UserId: 12, OrgId: 12}
+
+		_, err := service.createShortURLWithUID(context.Background(), raceUser, "mock/path?race=1", "raceduid")
+		require.NoError(t, err)
+
+		// the row of the creation losing the race is inserted after the uid was checked
+		err = sqlStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			return insertShortURLRow(session, sqlStore.Dialect, service.newShortURL(raceUser.OrgId, raceUser.UserId, "mock/path?race=2", "raceduid"))
+		})
+		require.True(t, errors.Is(err, models.ErrShortURLConflict))
+	})
+
 	t.Run("User cannot look up nonexistent short URLs", func(t *testing.T) {
 		service := ShortURLService{SQLStore: sqlStore}
 
@@ -83,3 +805,39 @@ func TestShortURLService(t *testing.T) {
 		require.Nil(t, shortURL)
 	})
 }
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		err      error
+	}{
+		{name: "relative path", path: "d/abc/dashboard?orgId=1", expected: "d/abc/dashboard?orgId=1"},
+		{name: "surrounding spaces", path: "  d/abc  ", expected: "d/abc"},
+		{name: "leading slash", path: "/d/abc", expected: "d/abc"},
+		{name: "dots in query", path: "d/abc?var=../x", expected: "d/abc?var=../x"},
+		{name: "protocol-relative URL", path: "//evil.com", err: models.ErrShortURLBadRequest},
+		{name: "protocol-relative URL with backslashes", path: "/\\evil.com", err: models.ErrShortURLBadRequest},
+		{name: "absolute URL", path: "http://evil.com/d/abc", err: models.ErrShortURLBadRequest},
+		{name: "absolute HTTPS URL", path: "https://evil.com", err: models.ErrShortURLBadRequest},
+		{name: "javascript URL", path: "javascript:alert(1)", err: models.ErrShortURLBadRequest},
+		{name: "parent directory", path: "../admin", err: models.ErrShortURLBadRequest},
+		{name: "nested parent directory", path: "d/../../admin", err: models.ErrShortURLBadRequest},
+		{name: "encoded parent directory", path: "d/%2e%2e/%2e%2e/admin", err: models.ErrShortURLBadRequest},
+		{name: "longest path", path: "/d/" + strings.Repeat("a", models.MaxShortUrlPathLength-2), expected: "d/" + strings.Repeat("a", models.MaxShortUrlPathLength-2)},
+		{name: "too long path", path: "d/" + strings.Repeat("a", models.MaxShortUrlPathLength-1), err: models.ErrShortURLPathTooLong},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := normalizePath(tc.path)
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, path)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package shorturls
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// ShortURLStore stores the short URLs created, resolved, visited and deleted one by one by the
+// ShortURLService, so that they can be backed by another store than the database, e.g. a key-value
+// store for high read volumes, or by a fake in tests. Batch operations, imports and transfers
+// still use the database.
+type ShortURLStore interface {
+	// Create stores the new short URL and sets its id.
+	// It returns models.ErrShortURLConflict if its uid is already used in its org.
+	Create(ctx context.Context, shortURL *models.ShortUrl) error
+	// GetByUID returns the short URL of the org with the uid, including deleted and expired ones.
+	// It returns models.ErrShortURLNotFound if there is none.
+	GetByUID(ctx context.Context, orgID int64, uid string) (*models.ShortUrl, error)
+	// UpdateLastSeen records hits visits of the short URL, the last one at seenAt,
+	// updating its last seen time and incrementing its hit count by hits.
+	UpdateLastSeen(ctx context.Context, shortURL *models.ShortUrl, seenAt time.Time, hits int64) error
+	// DeleteStale deletes the short URLs that have never been visited since cmd.OlderThan,
+	// the ones that haven't been visited again since cmd.LastSeenOlderThan (if set) and the expired ones,
+	// setting cmd.NumDeleted.
+	DeleteStale(ctx context.Context, cmd *models.DeleteShortUrlCommand) error
+}
+
+// sqlShortURLStore is the ShortURLStore storing short URLs in the short_url table of the database.
+type sqlShortURLStore struct {
+	sqlStore            *sqlstore.SQLStore
+	caseInsensitiveUIDs bool
+}
+
+func (s *sqlShortURLStore) Create(ctx context.Context, shortURL *models.ShortUrl) error {
+	return s.sqlStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		return insertShortURL(session, s.sqlStore.Dialect, shortURL, s.caseInsensitiveUIDs)
+	})
+}
+
+func (s *sqlShortURLStore) GetByUID(ctx context.Context, orgID int64, uid string) (*models.ShortUrl, error) {
+	var shortURL models.ShortUrl
+	err := s.sqlStore.WithDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		exists, err := getShortURLByUID(dbSession, orgID, uid, s.caseInsensitiveUIDs, &shortURL)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrShortURLNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &shortURL, nil
+}
+
+func (s *sqlShortURLStore) UpdateLastSeen(ctx context.Context, shortURL *models.ShortUrl, seenAt time.Time, hits int64) error {
+	return s.sqlStore.WithTransactionalDbSession(ctx, func(dbSession *sqlstore.DBSession) error {
+		var rawSql = "UPDATE short_url SET last_seen_at = ?, hit_count = hit_count + ? WHERE id = ?"
+		_, err := dbSession.Exec(rawSql, seenAt.Unix(), hits, shortURL.Id)
+		return err
+	})
+}
+
+func (s *sqlShortURLStore) DeleteStale(ctx context.Context, cmd *models.DeleteShortUrlCommand) error {
+	return s.sqlStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+		var rawSql = "DELETE FROM short_url WHERE (created_at <= ? AND (last_seen_at IS NULL OR last_seen_at = 0)) OR (expires_at > 0 AND expires_at <= ?)"
+		params := []interface{}{cmd.OlderThan.Unix(), getTime().Unix()}
+		if !cmd.LastSeenOlderThan.IsZero() {
+			rawSql += " OR (last_seen_at > 0 AND last_seen_at <= ?)"
+			params = append(params, cmd.LastSeenOlderThan.Unix())
+		}
+
+		if result, err := session.Exec(append([]interface{}{rawSql}, params...)...); err != nil {
+			return err
+		} else if cmd.NumDeleted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return nil
+	})
+}
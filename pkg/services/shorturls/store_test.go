@@ -0,0 +1,114 @@
+package shorturls
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeShortURLStore is a ShortURLStore keeping short URLs in memory.
+type fakeShortURLStore struct {
+	mu        sync.Mutex
+	nextID    int64
+	shortURLs map[int64]*models.ShortUrl
+}
+
+func newFakeShortURLStore() *fakeShortURLStore {
+	return &fakeShortURLStore{shortURLs: make(map[int64]*models.ShortUrl)}
+}
+
+func (s *fakeShortURLStore) Create(_ context.Context, shortURL *models.ShortUrl) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.shortURLs {
+		if existing.OrgId == shortURL.OrgId && existing.Uid == shortURL.Uid {
+			return models.ErrShortURLConflict
+		}
+	}
+	s.nextID++
+	shortURL.Id = s.nextID
+	stored := *shortURL
+	s.shortURLs[shortURL.Id] = &stored
+	return nil
+}
+
+func (s *fakeShortURLStore) GetByUID(_ context.Context, orgID int64, uid string) (*models.ShortUrl, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.shortURLs {
+		if existing.OrgId == orgID && existing.Uid == uid {
+			shortURL := *existing
+			return &shortURL, nil
+		}
+	}
+	return nil, models.ErrShortURLNotFound
+}
+
+func (s *fakeShortURLStore) UpdateLastSeen(_ context.Context, shortURL *models.ShortUrl, seenAt time.Time, hits int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.shortURLs[shortURL.Id]; ok {
+		existing.LastSeenAt = seenAt.Unix()
+		existing.HitCount += hits
+	}
+	return nil
+}
+
+func (s *fakeShortURLStore) DeleteStale(_ context.Context, cmd *models.DeleteShortUrlCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, existing := range s.shortURLs {
+		if existing.LastSeenAt == 0 && existing.CreatedAt <= cmd.OlderThan.Unix() {
+			delete(s.shortURLs, id)
+			cmd.NumDeleted++
+		}
+	}
+	return nil
+}
+
+func TestShortURLServiceWithStore(t *testing.T) {
+	origGetTime := getTime
+	t.Cleanup(func() {
+		getTime = origGetTime
+	})
+
+	createdAt := time.Date(2020, time.November, 27, 6, 5, 1, 0, time.UTC)
+	getTime = func() time.Time {
+		return createdAt
+	}
+
+	store := newFakeShortURLStore()
+	service := ShortURLService{Store: store}
+	user := &models.SignedInUser{UserId: 1, OrgId: 1}
+
+	shortURL, err := service.CreateShortURL(context.Background(), user, "/mock/path?stored=fake")
+	require.NoError(t, err)
+	require.Len(t, store.shortURLs, 1)
+
+	resolved, err := service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+	require.NoError(t, err)
+	require.Equal(t, "mock/path?stored=fake", resolved.Path)
+
+	require.NoError(t, service.UpdateLastSeenAt(context.Background(), resolved))
+	require.Equal(t, int64(1), resolved.HitCount)
+	require.Equal(t, int64(1), store.shortURLs[shortURL.Id].HitCount)
+
+	stale, err := service.CreateShortURL(context.Background(), user, "mock/path?stored=stale")
+	require.NoError(t, err)
+	cmd := models.DeleteShortUrlCommand{OlderThan: createdAt}
+	require.NoError(t, service.DeleteStaleShortURLs(context.Background(), &cmd))
+	require.Equal(t, int64(1), cmd.NumDeleted)
+
+	_, err = service.GetShortURLByUID(context.Background(), user, stale.Uid)
+	require.Equal(t, models.ErrShortURLNotFound, err)
+	_, err = service.GetShortURLByUID(context.Background(), user, shortURL.Uid)
+	require.NoError(t, err)
+}
@@ -0,0 +1,63 @@
+package shorturls
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/grafana/grafana/pkg/util"
+)
+
+const (
+	// Base62Alphabet is the URL-safe alphabet of generated short URL uids.
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// DefaultUIDLength is the length of generated short URL uids if it's not configured.
+	// There are 62^9 (more than 10^16) uids of this length.
+	DefaultUIDLength = 9
+
+	// MaxUIDLength is the maximum length of short URL uids, as stored in the database.
+	MaxUIDLength = 40
+)
+
+// GenerateShortURLUID generates a random short URL uid of the given length using the Base62Alphabet.
+func GenerateShortURLUID(length int) string {
+	return GenerateShortURLUIDFromAlphabet(length, Base62Alphabet)
+}
+
+// GenerateShortURLUIDFromAlphabet generates a random short URL uid of the given length
+// using the characters of the alphabet, from a cryptographically secure random source.
+// Longer uids and larger alphabets make collisions less likely. The alphabet should
+// only contain characters allowed by util.IsValidShortUID.
+func GenerateShortURLUIDFromAlphabet(length int, alphabet string) string {
+	max := big.NewInt(int64(len(alphabet)))
+	uid := make([]byte, length)
+	for i := range uid {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			// crypto/rand doesn't fail on supported platforms
+			panic(err)
+		}
+		uid[i] = alphabet[n.Int64()]
+	}
+	return string(uid)
+}
+
+// UIDValidator validates the format of a short URL uid, returning an error describing why it's invalid.
+// Deployments can provide their own, e.g. to reject ambiguous characters.
+type UIDValidator func(uid string) error
+
+// ValidateShortURLUID is the default UIDValidator. It accepts non-empty uids of at most MaxUIDLength
+// characters of the Base62Alphabet, as well as the "-" and "_" of uids generated by earlier versions.
+func ValidateShortURLUID(uid string) error {
+	if uid == "" {
+		return fmt.Errorf("uid is empty")
+	}
+	if len(uid) > MaxUIDLength {
+		return fmt.Errorf("uid is longer than %d characters", MaxUIDLength)
+	}
+	if !util.IsValidShortUID(uid) {
+		return fmt.Errorf("uid contains characters other than letters, digits, '-' and '_'")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package shorturls
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateShortURLUID(t *testing.T) {
+	uids := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		uid := GenerateShortURLUID(DefaultUIDLength)
+		require.Len(t, uid, DefaultUIDLength)
+		require.True(t, util.IsValidShortUID(uid))
+		require.False(t, uids[uid])
+		uids[uid] = true
+	}
+
+	require.Len(t, GenerateShortURLUID(MaxUIDLength), MaxUIDLength)
+	require.Empty(t, GenerateShortURLUID(0))
+
+	uid := GenerateShortURLUIDFromAlphabet(20, "ab")
+	require.Len(t, uid, 20)
+	require.Empty(t, strings.Trim(uid, "ab"))
+}
+
+func TestValidateShortURLUID(t *testing.T) {
+	require.NoError(t, ValidateShortURLUID("AbC123"))
+	require.NoError(t, ValidateShortURLUID("legacy-uid_1"))
+	require.NoError(t, ValidateShortURLUID(strings.Repeat("a", MaxUIDLength)))
+
+	require.EqualError(t, ValidateShortURLUID(""), "uid is empty")
+	require.EqualError(t, ValidateShortURLUID(strings.Repeat("a", MaxUIDLength+1)), "uid is longer than 40 characters")
+	require.EqualError(t, ValidateShortURLUID("in/valid"), "uid contains characters other than letters, digits, '-' and '_'")
+}
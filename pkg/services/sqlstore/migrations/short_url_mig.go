@@ -24,4 +24,63 @@ func addShortURLMigrations(mg *Migrator) {
 	mg.AddMigration("create short_url table v1", NewAddTableMigration(shortURLV1))
 
 	mg.AddMigration("add index short_url.org_id-uid", NewAddIndexMigration(shortURLV1, shortURLV1.Indices[0]))
+
+	mg.AddMigration("add expires_at column to short_url", NewAddColumnMigration(shortURLV1, &Column{
+		Name: "expires_at", Type: DB_Int, Nullable: true,
+	}))
+
+	mg.AddMigration("add hit_count column to short_url", NewAddColumnMigration(shortURLV1, &Column{
+		Name: "hit_count", Type: DB_BigInt, Nullable: false, Default: "0",
+	}))
+
+	mg.AddMigration("add deleted_at column to short_url", NewAddColumnMigration(shortURLV1, &Column{
+		Name: "deleted_at", Type: DB_Int, Nullable: true,
+	}))
+
+	mg.AddMigration("add updated_at column to short_url", NewAddColumnMigration(shortURLV1, &Column{
+		Name: "updated_at", Type: DB_Int, Nullable: true,
+	}))
+
+	shortURLIdempotencyKeyV1 := Table{
+		Name: "short_url_idempotency_key",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, Nullable: false, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "idempotency_key", Type: DB_NVarchar, Length: 128, Nullable: false},
+			{Name: "short_url_id", Type: DB_BigInt, Nullable: false},
+			{Name: "created_at", Type: DB_Int, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "user_id", "idempotency_key"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create short_url_idempotency_key table v1", NewAddTableMigration(shortURLIdempotencyKeyV1))
+
+	mg.AddMigration("add index short_url_idempotency_key.org_id-user_id-idempotency_key",
+		NewAddIndexMigration(shortURLIdempotencyKeyV1, shortURLIdempotencyKeyV1.Indices[0]))
+
+	shortURLAccessV1 := Table{
+		Name: "short_url_access",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, Nullable: false, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "short_url_id", Type: DB_BigInt, Nullable: false},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "client_ip", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "user_agent", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "accessed_at", Type: DB_Int, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"short_url_id"}},
+			{Cols: []string{"accessed_at"}},
+		},
+	}
+
+	mg.AddMigration("create short_url_access table v1", NewAddTableMigration(shortURLAccessV1))
+
+	mg.AddMigration("add index short_url_access.short_url_id", NewAddIndexMigration(shortURLAccessV1, shortURLAccessV1.Indices[0]))
+
+	mg.AddMigration("add index short_url_access.accessed_at", NewAddIndexMigration(shortURLAccessV1, shortURLAccessV1.Indices[1]))
 }
@@ -309,6 +309,24 @@ type Cfg struct {
 	// User
 	UserInviteMaxLifetime time.Duration
 
+	// Short links
+	ShortLinkMaxLifetime      time.Duration
+	ShortLinkInactiveLifetime time.Duration
+	ShortLinkUIDLength        int
+	// ShortLinkCreationRateLimit is the number of short links a user can create per minute, 0 if unlimited.
+	ShortLinkCreationRateLimit int
+	// ShortLinkCleanupInterval is the interval between deletions of stale short links.
+	ShortLinkCleanupInterval time.Duration
+	// ShortLinkCaseInsensitiveUIDs makes short link uids lowercase when created and resolved regardless of their case.
+	ShortLinkCaseInsensitiveUIDs bool
+	// ShortLinkAccessLogEnabled enables recording the client IP and user agent of each short link visit.
+	ShortLinkAccessLogEnabled bool
+	// ShortLinkAccessLogRetention is the duration recorded short link visits are kept.
+	ShortLinkAccessLogRetention time.Duration
+	// ShortLinkLastSeenFlushInterval is the interval between writes of the buffered short link visits,
+	// 0 if each visit is written before redirecting.
+	ShortLinkLastSeenFlushInterval time.Duration
+
 	// Annotations
 	AlertingAnnotationCleanupSetting   AnnotationCleanupSettings
 	DashboardAnnotationCleanupSettings AnnotationCleanupSettings
@@ -749,6 +767,9 @@ func (cfg *Cfg) Load(args *CommandLineArgs) error {
 	if err := readRenderingSettings(iniFile, cfg); err != nil {
 		return err
 	}
+	if err := readShortLinksSettings(iniFile, cfg); err != nil {
+		return err
+	}
 
 	cfg.TempDataLifetime = iniFile.Section("paths").Key("temp_data_lifetime").MustDuration(time.Second * 3600 * 24)
 	cfg.MetricsEndpointEnabled = iniFile.Section("metrics").Key("enabled").MustBool(true)
@@ -1177,6 +1198,64 @@ func readSnapshotsSettings(iniFile *ini.File) error {
 	return nil
 }
 
+func readShortLinksSettings(iniFile *ini.File, cfg *Cfg) error {
+	shortLinks := iniFile.Section("short_links")
+
+	maxLifetime, err := gtime.ParseDuration(valueAsString(shortLinks, "max_lifetime_duration", "0"))
+	if err != nil {
+		return err
+	}
+	cfg.ShortLinkMaxLifetime = maxLifetime
+
+	inactiveLifetime, err := gtime.ParseDuration(valueAsString(shortLinks, "inactive_lifetime_duration", "0"))
+	if err != nil {
+		return err
+	}
+	cfg.ShortLinkInactiveLifetime = inactiveLifetime
+
+	cfg.ShortLinkUIDLength = shortLinks.Key("uid_length").MustInt(9)
+	if cfg.ShortLinkUIDLength < 1 || cfg.ShortLinkUIDLength > 40 {
+		return fmt.Errorf("[short_links] uid_length should be between 1 and 40: %d", cfg.ShortLinkUIDLength)
+	}
+
+	cfg.ShortLinkCreationRateLimit = shortLinks.Key("creation_rate_limit").MustInt(0)
+	if cfg.ShortLinkCreationRateLimit < 0 {
+		return fmt.Errorf("[short_links] creation_rate_limit should not be negative: %d", cfg.ShortLinkCreationRateLimit)
+	}
+
+	cleanupInterval, err := gtime.ParseDuration(valueAsString(shortLinks, "cleanup_interval", "10m"))
+	if err != nil {
+		return err
+	}
+	if cleanupInterval <= 0 {
+		return fmt.Errorf("[short_links] cleanup_interval should be positive: %s", cleanupInterval)
+	}
+	cfg.ShortLinkCleanupInterval = cleanupInterval
+
+	cfg.ShortLinkCaseInsensitiveUIDs = shortLinks.Key("case_insensitive_uids").MustBool(false)
+
+	cfg.ShortLinkAccessLogEnabled = shortLinks.Key("access_log_enabled").MustBool(false)
+	accessLogRetention, err := gtime.ParseDuration(valueAsString(shortLinks, "access_log_retention", "30d"))
+	if err != nil {
+		return err
+	}
+	if accessLogRetention <= 0 {
+		return fmt.Errorf("[short_links] access_log_retention should be positive: %s", accessLogRetention)
+	}
+	cfg.ShortLinkAccessLogRetention = accessLogRetention
+
+	lastSeenFlushInterval, err := gtime.ParseDuration(valueAsString(shortLinks, "last_seen_flush_interval", "0"))
+	if err != nil {
+		return err
+	}
+	if lastSeenFlushInterval < 0 {
+		return fmt.Errorf("[short_links] last_seen_flush_interval should not be negative: %s", lastSeenFlushInterval)
+	}
+	cfg.ShortLinkLastSeenFlushInterval = lastSeenFlushInterval
+
+	return nil
+}
+
 func readServerSettings(iniFile *ini.File, cfg *Cfg) error {
 	server := iniFile.Section("server")
 	var err error